@@ -5,17 +5,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"path"
+	"strings"
+	"sync"
 
 	"github.com/containerd/platforms"
 	ggufparser "github.com/gpustack/gguf-parser-go"
+	intoto "github.com/in-toto/in-toto-golang/in_toto"
 	"github.com/moby/buildkit/client/llb"
 	"github.com/moby/buildkit/frontend"
 	"github.com/moby/buildkit/frontend/gateway/client"
+	gatewaypb "github.com/moby/buildkit/frontend/gateway/pb"
 	"github.com/moby/buildkit/frontend/subrequests/lint"
 	"github.com/moby/buildkit/frontend/subrequests/outline"
 	"github.com/moby/buildkit/frontend/subrequests/targets"
 	"github.com/moby/buildkit/solver/errdefs"
 	"github.com/moby/buildkit/solver/pb"
+	"github.com/moby/buildkit/solver/result"
+	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 
 	"github.com/gpustack/gguf-packer-go/buildkit/frontend/ggufpackerfile/ggufpackerfile2llb"
@@ -78,6 +84,8 @@ func Build(ctx context.Context, c client.Client) (_ *client.Result, err error) {
 		}
 	}()
 
+	var sboms sync.Map
+
 	rb, err := bc.Build(ctx, func(ctx context.Context, platform *specs.Platform, idx int) (client.Reference, *specs.Image, *specs.Image, error) {
 		opt := convertOpt
 		opt.TargetPlatform = platform
@@ -127,7 +135,12 @@ func Build(ctx context.Context, c client.Client) (_ *client.Result, err error) {
 			ps = append(ps, &pt.Cmd.Adapters[i])
 		}
 
+		img.Config.SchemaVersion = specs.SchemaVersion
 		img.Config.Size = 0
+		var (
+			detailAct   *llb.FileAction
+			detailPaths []string
+		)
 		for i := range ps {
 			if ps[i] == nil {
 				continue
@@ -181,8 +194,31 @@ func Build(ctx context.Context, c client.Client) (_ *client.Result, err error) {
 				return nil, nil, nil, errors.Wrapf(err, "failed to unmarshal parsing result")
 			}
 			m := gf.Metadata()
+			dn := ps[i].Type
+			if dn == "adapter" {
+				dn = fmt.Sprintf("adapter-%d", len(img.Config.Adapters))
+			}
+			dp := specs.GetDetailPath(dn)
+			{
+				cpOpt := &llb.CopyInfo{
+					CreateDestPath: true,
+					CreatedTime:    bc.Epoch,
+				}
+				if detailAct == nil {
+					detailAct = llb.Copy(pst, ps[i].Type+".json", "/"+dp, cpOpt)
+				} else {
+					detailAct = detailAct.Copy(pst, ps[i].Type+".json", "/"+dp, cpOpt)
+				}
+				detailPaths = append(detailPaths, dp)
+			}
 			mgf := specs.GGUFFile{
-				GGUFFile:          gf,
+				GGUFFile: specs.SummarizeGGUFFile(gf),
+				Detail: &specs.Descriptor{
+					MediaType: specs.MediaTypeGGUFFileDetail,
+					Digest:    digest.FromBytes(bs),
+					Size:      int64(len(bs)),
+					Path:      dp,
+				},
 				Architecture:      m.Architecture,
 				Parameters:        m.Parameters,
 				BitsPerWeight:     m.BitsPerWeight,
@@ -231,12 +267,92 @@ func Build(ctx context.Context, c client.Client) (_ *client.Result, err error) {
 			}
 		}
 
+		// Commit the full GGUF files into the last layer,
+		// so that the image config only needs to keep the summaries.
+		if detailAct != nil {
+			dst := pt.State.File(detailAct,
+				llb.WithCustomName(fmt.Sprintf("[%s] committing GGUF file details", id)),
+				ggufpackerfile2llb.Location(src.SourceMap, pt.Cmd.Location()))
+			ddef, err := dst.Marshal(ctx)
+			if err != nil {
+				return nil, nil, nil, errors.Wrapf(err, "failed to marshal committing LLB definition")
+			}
+			dr, err := c.Solve(ctx, client.SolveRequest{
+				Definition:   ddef.ToPB(),
+				CacheImports: bc.CacheImports,
+			})
+			if err != nil {
+				return nil, nil, nil, errors.Wrapf(err, "failed to solve committing LLB definition")
+			}
+			ref, err = dr.SingleRef()
+			if err != nil {
+				return nil, nil, nil, errors.Wrapf(err, "failed to get single committing ref")
+			}
+			img.History = append(img.History, specs.History{
+				CreatedBy: "DETAIL " + strings.Join(detailPaths, " ") + " # buildkit",
+				Comment:   ggufpackerfile2llb.HistoryComment,
+				Created:   bc.Epoch,
+			})
+		}
+
+		if bc.SBOM != nil {
+			bs, err := generateSBOM(img, pt.Lineage, bc.Epoch)
+			if err != nil {
+				return nil, nil, nil, errors.Wrapf(err, "failed to generate SBOM")
+			}
+			sboms.Store(id, bs)
+		}
+
 		return ref, img, baseImg, nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	if bc.SBOM != nil {
+		err = rb.EachPlatform(ctx, func(ctx context.Context, id string, _ specs.Platform) error {
+			v, ok := sboms.Load(id)
+			if !ok {
+				return nil
+			}
+			fp := "/" + SBOMName + ".spdx.json"
+			st := llb.Scratch().File(
+				llb.Mkfile(fp, 0o644, v.([]byte)),
+				llb.WithCustomName(fmt.Sprintf("[%s] generating SBOM", id)))
+			def, err := st.Marshal(ctx)
+			if err != nil {
+				return errors.Wrapf(err, "failed to marshal SBOM LLB definition")
+			}
+			r, err := c.Solve(ctx, client.SolveRequest{
+				Definition: def.ToPB(),
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to solve SBOM LLB definition")
+			}
+			ref, err := r.SingleRef()
+			if err != nil {
+				return errors.Wrapf(err, "failed to get single SBOM ref")
+			}
+			rb.AddAttestation(id, client.Attestation{
+				Kind: gatewaypb.AttestationKindInToto,
+				Ref:  ref,
+				Path: fp,
+				InToto: result.InTotoAttestation{
+					PredicateType: intoto.PredicateSPDX,
+				},
+				Metadata: map[string][]byte{
+					result.AttestationReasonKey:     []byte(result.AttestationReasonSBOM),
+					result.AttestationSBOMCore:      []byte(SBOMName),
+					result.AttestationInlineOnlyKey: []byte("true"),
+				},
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return rb.Finalize()
 }
 
@@ -0,0 +1,328 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+
+	"github.com/gpustack/gguf-packer-go/buildkit/frontend/ggufpackerfile/ggufpackerfile2llb"
+	specs "github.com/gpustack/gguf-packer-go/buildkit/frontend/specs/v1"
+)
+
+// SBOMName is the name of the SBOM file,
+// which must be the same as the core SBOM name of BuildKit.
+const SBOMName = "sbom"
+
+// The following types are the subset of the SPDX 2.3 JSON schema,
+// see https://spdx.github.io/spdx-spec/v2.3/.
+type (
+	spdxDocument struct {
+		SPDXVersion       string             `json:"spdxVersion"`
+		DataLicense       string             `json:"dataLicense"`
+		SPDXID            string             `json:"SPDXID"`
+		Name              string             `json:"name"`
+		DocumentNamespace string             `json:"documentNamespace"`
+		CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+		Packages          []spdxPackage      `json:"packages"`
+		Relationships     []spdxRelationship `json:"relationships"`
+	}
+
+	spdxCreationInfo struct {
+		Created  string   `json:"created"`
+		Creators []string `json:"creators"`
+	}
+
+	spdxPackage struct {
+		SPDXID                string            `json:"SPDXID"`
+		Name                  string            `json:"name"`
+		VersionInfo           string            `json:"versionInfo,omitempty"`
+		DownloadLocation      string            `json:"downloadLocation"`
+		FilesAnalyzed         bool              `json:"filesAnalyzed"`
+		Checksums             []spdxChecksum    `json:"checksums,omitempty"`
+		LicenseConcluded      string            `json:"licenseConcluded"`
+		LicenseDeclared       string            `json:"licenseDeclared"`
+		CopyrightText         string            `json:"copyrightText"`
+		Comment               string            `json:"comment,omitempty"`
+		PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+		ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+		Annotations           []spdxAnnotation  `json:"annotations,omitempty"`
+	}
+
+	spdxChecksum struct {
+		Algorithm     string `json:"algorithm"`
+		ChecksumValue string `json:"checksumValue"`
+	}
+
+	spdxExternalRef struct {
+		ReferenceCategory string `json:"referenceCategory"`
+		ReferenceType     string `json:"referenceType"`
+		ReferenceLocator  string `json:"referenceLocator"`
+	}
+
+	spdxAnnotation struct {
+		AnnotationDate string `json:"annotationDate"`
+		AnnotationType string `json:"annotationType"`
+		Annotator      string `json:"annotator"`
+		Comment        string `json:"comment"`
+	}
+
+	spdxRelationship struct {
+		SPDXElementID      string `json:"spdxElementId"`
+		RelationshipType   string `json:"relationshipType"`
+		RelatedSPDXElement string `json:"relatedSpdxElement"`
+	}
+)
+
+const spdxNoAssertion = "NOASSERTION"
+
+// generateSBOM generates the SPDX document of the given image,
+// which describes the lineage of all GGUF files.
+func generateSBOM(img *specs.Image, lineage ggufpackerfile2llb.Lineage, created *time.Time) ([]byte, error) {
+	ct := time.Now().UTC()
+	if created != nil {
+		ct = created.UTC()
+	}
+	cts := ct.Format(time.RFC3339)
+
+	doc := spdxDocument{
+		SPDXVersion: "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		SPDXID:      "SPDXRef-DOCUMENT",
+		Name:        "gguf-packer",
+		CreationInfo: spdxCreationInfo{
+			Created:  cts,
+			Creators: []string{"Tool: gguf-packer"},
+		},
+	}
+
+	// GGUF files.
+	var fileIDs []string
+	{
+		cfg := img.Config
+		gfs := []struct {
+			name string
+			file *specs.GGUFFile
+		}{
+			{"model", cfg.Model},
+			{"drafter", cfg.Drafter},
+			{"projector", cfg.Projector},
+		}
+		for i := range cfg.Adapters {
+			gfs = append(gfs, struct {
+				name string
+				file *specs.GGUFFile
+			}{fmt.Sprintf("adapter-%d", i), cfg.Adapters[i]})
+		}
+		for _, gf := range gfs {
+			if gf.file == nil {
+				continue
+			}
+			m := gf.file.Metadata()
+			id := "SPDXRef-GGUF-" + spdxIDSanitize(gf.name)
+			pkg := spdxPackage{
+				SPDXID:                id,
+				Name:                  gf.file.CmdParameterValue,
+				VersionInfo:           m.FileType.String(),
+				DownloadLocation:      spdxNoAssertion,
+				LicenseConcluded:      spdxNoAssertion,
+				LicenseDeclared:       toSPDXLicense(m.License),
+				CopyrightText:         spdxNoAssertion,
+				PrimaryPackagePurpose: "FILE",
+				Comment: fmt.Sprintf("%s %s, architecture %s, parameters %s, bits per weight %s",
+					gf.name, tenary(m.Name != "", m.Name, "GGUF file"), gf.file.Architecture, gf.file.Parameters, gf.file.BitsPerWeight),
+			}
+			if m.URL != "" {
+				pkg.DownloadLocation = m.URL
+			}
+			if gf.file.Detail != nil {
+				pkg.Annotations = append(pkg.Annotations, spdxAnnotation{
+					AnnotationDate: cts,
+					AnnotationType: "OTHER",
+					Annotator:      "Tool: gguf-packer",
+					Comment:        fmt.Sprintf("detail %s@%s", gf.file.Detail.Path, gf.file.Detail.Digest),
+				})
+			}
+			doc.Packages = append(doc.Packages, pkg)
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      doc.SPDXID,
+				RelationshipType:   "DESCRIBES",
+				RelatedSPDXElement: id,
+			})
+			fileIDs = append(fileIDs, id)
+		}
+	}
+
+	// Base image.
+	if b := lineage.Base; b != nil {
+		id := "SPDXRef-Base"
+		doc.Packages = append(doc.Packages, toSPDXImagePackage(id, *b, "base image"))
+		for _, fid := range fileIDs {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      fid,
+				RelationshipType:   "DESCENDANT_OF",
+				RelatedSPDXElement: id,
+			})
+		}
+	}
+
+	// Sources.
+	for i, src := range lineage.Sources {
+		id := fmt.Sprintf("SPDXRef-Source-%d", i)
+		pkg := spdxPackage{
+			SPDXID:                id,
+			Name:                  src.URI,
+			DownloadLocation:      spdxNoAssertion,
+			LicenseConcluded:      spdxNoAssertion,
+			LicenseDeclared:       spdxNoAssertion,
+			CopyrightText:         spdxNoAssertion,
+			Comment:               "added from " + src.Kind,
+			PrimaryPackagePurpose: tenary(src.Kind == "git", "SOURCE", "FILE"),
+		}
+		switch src.Kind {
+		case "http":
+			pkg.DownloadLocation = src.URI
+			if u, err := url.Parse(src.URI); err == nil {
+				pkg.Name = u.Host + u.Path
+			}
+		case "git":
+			pkg.DownloadLocation = "git+" + src.URI
+			if src.Revision != "" {
+				pkg.DownloadLocation += "@" + src.Revision
+				pkg.VersionInfo = src.Revision
+			}
+		}
+		if src.Checksum != "" {
+			pkg.Checksums = []spdxChecksum{toSPDXChecksum(src.Checksum)}
+		}
+		doc.Packages = append(doc.Packages, pkg)
+		for _, fid := range fileIDs {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      fid,
+				RelationshipType:   "GENERATED_FROM",
+				RelatedSPDXElement: id,
+			})
+		}
+	}
+
+	// Tools.
+	for i, tool := range lineage.Tools {
+		id := fmt.Sprintf("SPDXRef-Tool-%d", i)
+		pkg := toSPDXImagePackage(id, tool.Image, tool.Instruction+" tool image")
+		args := make([]string, 0, len(tool.Arguments))
+		for k, v := range tool.Arguments {
+			args = append(args, fmt.Sprintf("--%s=%s", k, v))
+		}
+		sort.Strings(args)
+		pkg.Annotations = append(pkg.Annotations, spdxAnnotation{
+			AnnotationDate: cts,
+			AnnotationType: "OTHER",
+			Annotator:      "Tool: gguf-packer",
+			Comment:        tool.Instruction + " " + strings.Join(args, " "),
+		})
+		doc.Packages = append(doc.Packages, pkg)
+		for _, fid := range fileIDs {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      id,
+				RelationshipType:   "BUILD_TOOL_OF",
+				RelatedSPDXElement: fid,
+			})
+		}
+	}
+
+	// Namespace, which is stable for the same content.
+	{
+		bs, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		doc.DocumentNamespace = "https://github.com/gpustack/gguf-packer-go/spdx/" + digest.FromBytes(bs).Encoded()
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func toSPDXImagePackage(id string, img ggufpackerfile2llb.LineageImage, comment string) spdxPackage {
+	pkg := spdxPackage{
+		SPDXID:                id,
+		Name:                  img.Name,
+		DownloadLocation:      spdxNoAssertion,
+		LicenseConcluded:      spdxNoAssertion,
+		LicenseDeclared:       spdxNoAssertion,
+		CopyrightText:         spdxNoAssertion,
+		Comment:               comment,
+		PrimaryPackagePurpose: "CONTAINER",
+	}
+	if img.Digest != "" {
+		pkg.VersionInfo = img.Digest.String()
+		pkg.Checksums = []spdxChecksum{toSPDXChecksum(img.Digest)}
+		repo, _, _ := strings.Cut(img.Name, ":")
+		if i := strings.LastIndex(repo, "/"); i >= 0 && strings.Count(repo[i:], ":") == 0 {
+			n := repo[i+1:]
+			pkg.ExternalRefs = []spdxExternalRef{
+				{
+					ReferenceCategory: "PACKAGE-MANAGER",
+					ReferenceType:     "purl",
+					ReferenceLocator: fmt.Sprintf("pkg:oci/%s@%s?repository_url=%s",
+						n, url.QueryEscape(img.Digest.String()), url.QueryEscape(repo)),
+				},
+			}
+		}
+	}
+	return pkg
+}
+
+func toSPDXChecksum(d digest.Digest) spdxChecksum {
+	return spdxChecksum{
+		Algorithm:     strings.ToUpper(d.Algorithm().String()),
+		ChecksumValue: d.Encoded(),
+	}
+}
+
+var spdxLicenses = map[string]string{
+	"apache-2.0":   "Apache-2.0",
+	"mit":          "MIT",
+	"bsd-2-clause": "BSD-2-Clause",
+	"bsd-3-clause": "BSD-3-Clause",
+	"gpl-2.0":      "GPL-2.0-only",
+	"gpl-3.0":      "GPL-3.0-only",
+	"lgpl-3.0":     "LGPL-3.0-only",
+	"agpl-3.0":     "AGPL-3.0-only",
+	"mpl-2.0":      "MPL-2.0",
+	"cc-by-4.0":    "CC-BY-4.0",
+	"cc-by-sa-4.0": "CC-BY-SA-4.0",
+	"cc-by-nc-4.0": "CC-BY-NC-4.0",
+	"openrail":     "OpenRAIL",
+	"unlicense":    "Unlicense",
+}
+
+// toSPDXLicense converts the GGUF general.license to the SPDX license expression,
+// unknown licenses are converted to the LicenseRef-* form.
+func toSPDXLicense(l string) string {
+	l = strings.TrimSpace(l)
+	if l == "" {
+		return spdxNoAssertion
+	}
+	if v, ok := spdxLicenses[strings.ToLower(l)]; ok {
+		return v
+	}
+	return "LicenseRef-" + spdxIDSanitize(l)
+}
+
+var spdxIDInvalidChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+func spdxIDSanitize(s string) string {
+	return spdxIDInvalidChars.ReplaceAllString(s, "-")
+}
+
+func tenary[T any](c bool, t, f T) T {
+	if c {
+		return t
+	}
+	return f
+}
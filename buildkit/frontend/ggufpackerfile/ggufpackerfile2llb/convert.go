@@ -45,11 +45,12 @@ import (
 	"github.com/gpustack/gguf-packer-go/buildkit/frontend/ggufpackerfile/parser"
 	"github.com/gpustack/gguf-packer-go/buildkit/frontend/ggufpackerui"
 	specs "github.com/gpustack/gguf-packer-go/buildkit/frontend/specs/v1"
+	"github.com/gpustack/gguf-packer-go/llamacpp"
 )
 
 const (
 	emptyImageName = "scratch"
-	historyComment = "buildkit.ggufpackerfile.v0"
+	HistoryComment = "buildkit.ggufpackerfile.v0"
 )
 
 var (
@@ -70,8 +71,9 @@ type ConvertOpt struct {
 }
 
 type ParseTarget struct {
-	State llb.State
-	Cmd   *instructions.CmdCommand
+	State   llb.State
+	Cmd     *instructions.CmdCommand
+	Lineage Lineage
 
 	IgnoreCache bool
 }
@@ -89,7 +91,10 @@ func ToLLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State, *specs.I
 		}
 		lbs := ds.image.Config.Labels
 		ct := time.Now()
-		if ds.image.Created != nil {
+		switch {
+		case ds.epoch != nil:
+			ct = *ds.epoch
+		case ds.image.Created != nil:
 			ct = *ds.image.Created
 		}
 		setLabel(lbs, ct.Format(time.RFC3339), "org.opencontainers.image.created")
@@ -101,6 +106,22 @@ func ToLLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State, *specs.I
 		}
 	}
 
+	var lineage Lineage
+	{
+		b := ds
+		for b.base != nil {
+			b = b.base
+		}
+		if b.stage.BaseName != emptyImageName {
+			bi := toLineageImage(b.stage.BaseName, b.stage.BaseDigest)
+			lineage.Base = &bi
+		}
+		for st := range allReachableStages(ds) {
+			lineage.merge(st.lineage)
+		}
+		lineage.sort()
+	}
+
 	var pt *ParseTarget
 	switch {
 	case ds.stage.CmdCommand != nil:
@@ -108,12 +129,14 @@ func ToLLB(ctx context.Context, dt []byte, opt ConvertOpt) (*llb.State, *specs.I
 		pt = &ParseTarget{
 			State:       ds.state,
 			Cmd:         ds.stage.CmdCommand,
+			Lineage:     lineage,
 			IgnoreCache: ds.ignoreCache,
 		}
 	case ds.baseImg != nil:
 		pt = &ParseTarget{
 			State:       ds.state,
 			Cmd:         &instructions.CmdCommand{Args: ds.baseImg.Config.Cmd},
+			Lineage:     lineage,
 			IgnoreCache: ds.ignoreCache,
 		}
 		if m := ds.baseImg.Config.Model; m != nil {
@@ -975,6 +998,21 @@ func dispatch(d *dispatchState, cmd command, opt dispatchOpt) (err error) {
 			sts[i] = st
 		}
 		err = dispatchConvert(d, c, &opt, sts)
+		if err == nil {
+			tool := cmd.sources[len(cmd.sources)-1]
+			args := map[string]string{
+				"class": c.Class,
+				"type":  c.Type,
+			}
+			if c.BaseModel != "" {
+				args["base"] = c.BaseModel
+			}
+			d.lineage.addTool(LineageTool{
+				Instruction: "CONVERT",
+				Image:       toLineageImage(tool.stage.BaseName, tool.stage.BaseDigest),
+				Arguments:   args,
+			})
+		}
 	case *instructions.LabelCommand:
 		err = dispatchLabel(d, c, opt.lint)
 	case *instructions.QuantizeCommand:
@@ -987,6 +1025,26 @@ func dispatch(d *dispatchState, cmd command, opt dispatchOpt) (err error) {
 			sts[i] = st
 		}
 		err = dispatchQuantize(d, c, &opt, sts)
+		if err == nil {
+			tool := cmd.sources[len(cmd.sources)-1]
+			args := map[string]string{
+				"type": c.Type,
+			}
+			if c.Imatrix != "" {
+				args["imatrix"] = c.Imatrix
+			}
+			if c.OutputTensorType != "" {
+				args["output-tensor-type"] = c.OutputTensorType
+			}
+			if c.TokenEmbeddingType != "" {
+				args["token-embedding-type"] = c.TokenEmbeddingType
+			}
+			d.lineage.addTool(LineageTool{
+				Instruction: "QUANTIZE",
+				Image:       toLineageImage(tool.stage.BaseName, tool.stage.BaseDigest),
+				Arguments:   args,
+			})
+		}
 	default:
 	}
 	return err
@@ -1015,6 +1073,7 @@ type dispatchState struct {
 	cmdTotal       int
 	prefixPlatform bool
 	outline        outlineCapture
+	lineage        Lineage
 	epoch          *time.Time
 
 	cmd instructionTracker
@@ -1175,6 +1234,7 @@ func dispatchCat(d *dispatchState, c *instructions.CatCommand, opt *dispatchOpt)
 
 		opts := []llb.CopyOption{&llb.CopyInfo{
 			CreateDestPath: true,
+			CreatedTime:    d.epoch,
 		}}
 
 		if a == nil {
@@ -1206,6 +1266,11 @@ func dispatchCmd(d *dispatchState, c *instructions.CmdCommand, lint *linter.Lint
 		return errors.New("command must point out the main model")
 	}
 
+	if _, err := llamacpp.ParseArgs(c.Args); err != nil {
+		msg := linter.RuleInvalidCmdArgument.Format(err.Error())
+		lint.Run(&linter.RuleInvalidCmdArgument, c.Location(), msg)
+	}
+
 	return commitToHistory(&d.image, fmt.Sprintf("CMD %q", c.Args), false, nil, d.epoch)
 }
 
@@ -1310,10 +1375,18 @@ func dispatchCopy(d *dispatchState, cfg copyConfig) error {
 			if cfg.keepGitDir {
 				gitOptions = append(gitOptions, llb.KeepGitDir())
 			}
+			if cfg.isAddCommand {
+				d.lineage.addSource(LineageSource{
+					Kind:     "git",
+					URI:      gitRef.Remote,
+					Revision: commit,
+				})
+			}
 			st := llb.Git(gitRef.Remote, commit, gitOptions...)
 			opts := append([]llb.CopyOption{&llb.CopyInfo{
 				Mode:           mode,
 				CreateDestPath: true,
+				CreatedTime:    d.epoch,
 			}}, copyOpt...)
 			if a == nil {
 				a = llb.Copy(st, "/", dest, opts...)
@@ -1338,11 +1411,17 @@ func dispatchCopy(d *dispatchState, cfg copyConfig) error {
 				}
 			}
 
+			d.lineage.addSource(LineageSource{
+				Kind:     "http",
+				URI:      src,
+				Checksum: cfg.checksum,
+			})
 			st := llb.HTTP(src, llb.Filename(f), llb.WithCustomName(pgName), llb.Checksum(cfg.checksum), dfCmd(cfg.params))
 
 			opts := append([]llb.CopyOption{&llb.CopyInfo{
 				Mode:           mode,
 				CreateDestPath: true,
+				CreatedTime:    d.epoch,
 			}}, copyOpt...)
 
 			if a == nil {
@@ -1352,6 +1431,12 @@ func dispatchCopy(d *dispatchState, cfg copyConfig) error {
 			}
 		} else {
 			_ = validateCopySourcePath(src, &cfg)
+			if cfg.isAddCommand {
+				d.lineage.addSource(LineageSource{
+					Kind: "context",
+					URI:  src,
+				})
+			}
 			var patterns []string
 			if cfg.parents {
 				// detect optional pivot point
@@ -1385,6 +1470,7 @@ func dispatchCopy(d *dispatchState, cfg copyConfig) error {
 				CreateDestPath:      true,
 				AllowWildcard:       true,
 				AllowEmptyWildcard:  true,
+				CreatedTime:         d.epoch,
 			}}, copyOpt...)
 
 			if a == nil {
@@ -1412,6 +1498,7 @@ func dispatchCopy(d *dispatchState, cfg copyConfig) error {
 		opts := append([]llb.CopyOption{&llb.CopyInfo{
 			Mode:           mode,
 			CreateDestPath: true,
+			CreatedTime:    d.epoch,
 		}}, copyOpt...)
 
 		if a == nil {
@@ -1551,11 +1638,28 @@ func dispatchConvert(d *dispatchState, c *instructions.ConvertCommand, opt *disp
 		runOpt = append(runOpt, llb.IgnoreCache)
 	}
 	run := sources[len(sources)-1].Run(runOpt...)
-	d.state = run.AddMount("/run/dest", d.state)
+	d.state = commitRunOutput(d, run, dest, pgName)
 
 	return commitToHistory(&d.image, commitMessage.String(), true, &d.state, d.epoch)
 }
 
+// commitRunOutput commits the output of the given run to the dispatch state,
+// if the epoch is specified, the output is copied with the epoch as the modification time,
+// so that the result layer is reproducible.
+func commitRunOutput(d *dispatchState, run llb.ExecState, dest, pgName string) llb.State {
+	if d.epoch == nil {
+		return run.AddMount("/run/dest", d.state)
+	}
+	out := run.AddMount("/run/dest", d.state)
+	return d.state.File(
+		llb.Copy(out, dest, dest, &llb.CopyInfo{
+			CreateDestPath: true,
+			CreatedTime:    d.epoch,
+		}),
+		llb.WithCustomName(pgName+" (rewriting timestamps)"),
+	)
+}
+
 func dispatchLabel(d *dispatchState, c *instructions.LabelCommand, lint *linter.Linter) error {
 	commitMessage := bytes.NewBufferString("LABEL")
 	if d.image.Config.Labels == nil {
@@ -1770,7 +1874,7 @@ func dispatchQuantize(d *dispatchState, c *instructions.QuantizeCommand, opt *di
 		runOpt = append(runOpt, llb.IgnoreCache)
 	}
 	run := sources[len(sources)-1].Run(runOpt...)
-	d.state = run.AddMount("/run/dest", d.state)
+	d.state = commitRunOutput(d, run, dest, pgName)
 
 	return commitToHistory(&d.image, commitMessage.String(), true, &d.state, d.epoch)
 }
@@ -1826,7 +1930,7 @@ func commitToHistory(img *specs.Image, msg string, withLayer bool, st *llb.State
 
 	img.History = append(img.History, specs.History{
 		CreatedBy:  msg,
-		Comment:    historyComment,
+		Comment:    HistoryComment,
 		EmptyLayer: !withLayer,
 		Created:    tm,
 	})
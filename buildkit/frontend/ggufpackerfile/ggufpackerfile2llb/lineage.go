@@ -0,0 +1,139 @@
+package ggufpackerfile2llb
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+)
+
+// Lineage records the sources and tools which produce the target.
+type Lineage struct {
+	// Base represents the base image of the target, if any.
+	Base *LineageImage
+	// Sources represents the sources added by ADD instructions.
+	Sources []LineageSource
+	// Tools represents the tools which are used by CONVERT and QUANTIZE instructions.
+	Tools []LineageTool
+}
+
+// LineageImage represents an image reference with its digest.
+type LineageImage struct {
+	Name   string
+	Digest digest.Digest
+}
+
+// LineageSource represents a source added by ADD instruction.
+type LineageSource struct {
+	// Kind represents the kind of the source, select from [http, git, context].
+	Kind string
+	// URI represents the location of the source.
+	URI string
+	// Revision represents the revision of the git source.
+	Revision string
+	// Checksum represents the checksum of the http source.
+	Checksum digest.Digest
+}
+
+// LineageTool represents a tool used by CONVERT or QUANTIZE instruction.
+type LineageTool struct {
+	// Instruction represents the instruction name, select from [CONVERT, QUANTIZE].
+	Instruction string
+	// Image represents the tool image.
+	Image LineageImage
+	// Arguments represents the arguments of the instruction,
+	// such as the type, class, base model, imatrix, etc.
+	Arguments map[string]string
+}
+
+func (l *Lineage) addSource(s LineageSource) {
+	if slices.Contains(l.Sources, s) {
+		return
+	}
+	l.Sources = append(l.Sources, s)
+}
+
+func (l *Lineage) addTool(t LineageTool) {
+	for i := range l.Tools {
+		if l.Tools[i].Instruction == t.Instruction && l.Tools[i].Image == t.Image &&
+			maps.Equal(l.Tools[i].Arguments, t.Arguments) {
+			return
+		}
+	}
+	l.Tools = append(l.Tools, t)
+}
+
+func (l *Lineage) merge(o Lineage) {
+	for i := range o.Sources {
+		l.addSource(o.Sources[i])
+	}
+	for i := range o.Tools {
+		l.addTool(o.Tools[i])
+	}
+}
+
+// sort sorts the sources and tools to keep the lineage stable.
+func (l *Lineage) sort() {
+	slices.SortStableFunc(l.Sources, func(a, b LineageSource) int {
+		return cmp.Or(
+			cmp.Compare(a.Kind, b.Kind),
+			cmp.Compare(a.URI, b.URI),
+			cmp.Compare(a.Revision, b.Revision),
+			cmp.Compare(a.Checksum, b.Checksum))
+	})
+	slices.SortStableFunc(l.Tools, func(a, b LineageTool) int {
+		return cmp.Or(
+			cmp.Compare(a.Instruction, b.Instruction),
+			cmp.Compare(a.Image.Name, b.Image.Name),
+			cmp.Compare(a.Image.Digest, b.Image.Digest),
+			compareArguments(a.Arguments, b.Arguments))
+	})
+}
+
+// compareArguments compares the given arguments by the keys in order,
+// an absent key is less than any value.
+func compareArguments(a, b map[string]string) int {
+	ks := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		ks = append(ks, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			ks = append(ks, k)
+		}
+	}
+	slices.Sort(ks)
+	for _, k := range ks {
+		av, aok := a[k]
+		bv, bok := b[k]
+		if c := cmp.Or(compareBool(aok, bok), cmp.Compare(av, bv)); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// toLineageImage splits the given image reference into name and digest.
+func toLineageImage(ref, dgst string) LineageImage {
+	n, d, _ := strings.Cut(ref, "@")
+	if dgst == "" {
+		dgst = d
+	}
+	return LineageImage{
+		Name:   n,
+		Digest: digest.Digest(dgst),
+	}
+}
@@ -125,4 +125,12 @@ var (
 			return fmt.Sprintf("Attempting to %s file %q that is excluded by .ggufpackerignore", cmd, file)
 		},
 	}
+	RuleInvalidCmdArgument = LinterRule[func(string) string]{
+		Name:        "InvalidCmdArgument",
+		Description: "CMD arguments should be valid for llama.cpp server",
+		URL:         "https://docs.gpustack.ai/overview/",
+		Format: func(reason string) string {
+			return fmt.Sprintf("CMD has invalid argument: %s", reason)
+		},
+	}
 )
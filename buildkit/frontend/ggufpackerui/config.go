@@ -13,6 +13,7 @@ import (
 	"github.com/distribution/reference"
 	controlapi "github.com/moby/buildkit/api/services/control"
 	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/frontend/attestations"
 	"github.com/moby/buildkit/frontend/gateway/client"
 	"github.com/moby/buildkit/solver/pb"
 	"github.com/moby/buildkit/util/flightcontrol"
@@ -78,6 +79,13 @@ type Config struct {
 	ConvertImage  string
 	QuantizeImage string
 	ParseImage    string
+
+	SBOM *SBOM
+}
+
+type SBOM struct {
+	// Parameters holds the parameters of the SBOM attestation request.
+	Parameters map[string]string
 }
 
 type Client struct {
@@ -250,6 +258,16 @@ func (bc *Client) init() error {
 	}
 	bc.Epoch = epoch
 
+	attests, err := attestations.Parse(opts)
+	if err != nil {
+		return err
+	}
+	if attrs, ok := attests[attestations.KeyTypeSbom]; ok {
+		bc.SBOM = &SBOM{
+			Parameters: attrs,
+		}
+	}
+
 	bc.BuildArgs = filter(opts, buildArgPrefix)
 	bc.Labels = filter(opts, labelPrefix)
 	bc.CacheIDNamespace = opts[keyCacheNSArg]
@@ -0,0 +1,19 @@
+//go:build ignore
+
+package main
+
+import (
+	"os"
+
+	specs "github.com/gpustack/gguf-packer-go/buildkit/frontend/specs/v1"
+)
+
+func main() {
+	bs, err := specs.JSONSchema()
+	if err != nil {
+		panic(err)
+	}
+	if err = os.WriteFile("schema.json", append(bs, '\n'), 0o644); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,62 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+
+	ggufparser "github.com/gpustack/gguf-parser-go"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// MediaTypeGGUFFileDetail is the media type of the full GGUF file referenced by GGUFFile.Detail.
+	MediaTypeGGUFFileDetail = "application/vnd.gpustack.gguf-packer.gguf.detail.v1+json"
+
+	// DetailDir is the directory to place the full GGUF files in the image.
+	DetailDir = ".gguf-packer"
+)
+
+// GetDetailPath returns the path of the full GGUF file with the given name.
+func GetDetailPath(name string) string {
+	return path.Join(DetailDir, name+".json")
+}
+
+// SummarizeGGUFFile returns a summary of the given GGUF file,
+// which elides the array items of the metadata and removes the tensor infos.
+func SummarizeGGUFFile(gf ggufparser.GGUFFile) ggufparser.GGUFFile {
+	sgf := gf
+	sgf.Header.MetadataKV = make(ggufparser.GGUFMetadataKVs, len(gf.Header.MetadataKV))
+	for i, kv := range gf.Header.MetadataKV {
+		if kv.ValueType == ggufparser.GGUFMetadataValueTypeArray {
+			av := kv.ValueArray()
+			av.Array = nil
+			kv.Value = av
+		}
+		sgf.Header.MetadataKV[i] = kv
+	}
+	sgf.TensorInfos = nil
+	return sgf
+}
+
+// IsSummarized returns true if the GGUF file is summarized.
+func (gf *GGUFFile) IsSummarized() bool {
+	return gf.Detail != nil && len(gf.TensorInfos) == 0
+}
+
+// Inflate fills the summarized GGUF file with the given content of the Detail.
+func (gf *GGUFFile) Inflate(bs []byte) error {
+	if gf.Detail == nil {
+		return errors.New("no detail to inflate")
+	}
+	if d := digest.FromBytes(bs); d != gf.Detail.Digest {
+		return fmt.Errorf("mismatched detail digest, expected %s but got %s", gf.Detail.Digest, d)
+	}
+	var f ggufparser.GGUFFile
+	if err := json.Unmarshal(bs, &f); err != nil {
+		return fmt.Errorf("unmarshalling detail: %w", err)
+	}
+	gf.GGUFFile = f
+	return nil
+}
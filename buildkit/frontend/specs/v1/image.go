@@ -4,6 +4,7 @@ import (
 	"time"
 
 	ggufparser "github.com/gpustack/gguf-parser-go"
+	"github.com/opencontainers/go-digest"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
@@ -31,6 +32,10 @@ type (
 	Platform = ocispec.Platform
 
 	ImageConfig struct {
+		// SchemaVersion represents the schema version of the config,
+		// zero means the config is created before versioning, which is upgraded to SchemaVersion1 by upgradeToV1.
+		SchemaVersion int `json:"SchemaVersion,omitempty"`
+
 		// Size represents the summarized size of all GGUFFiles.
 		Size ggufparser.GGUFBytesScalar `json:"Size,omitempty"`
 
@@ -58,8 +63,14 @@ type (
 	History = ocispec.History
 
 	GGUFFile struct {
+		// GGUFFile represents the GGUF file,
+		// it is summarized if the Detail is not nil,
+		// which means the large metadata arrays are elided and the tensor infos are removed.
 		ggufparser.GGUFFile `json:"GGUF"`
 
+		// Detail references the full GGUF file, which includes all metadata and tensor infos.
+		Detail *Descriptor `json:"Detail,omitempty"`
+
 		// Architecture represents what architecture the model implements.
 		Architecture string `json:"Architecture,omitempty"`
 
@@ -78,4 +89,19 @@ type (
 		// CmdParameterIndex indicates the index of the Cmd.
 		CmdParameterIndex int `json:"CmdParameterIndex,omitempty"`
 	}
+
+	// Descriptor describes a content-addressed blob inside the image layers.
+	Descriptor struct {
+		// MediaType represents the media type of the blob.
+		MediaType string `json:"MediaType"`
+
+		// Digest represents the digest of the blob.
+		Digest digest.Digest `json:"Digest"`
+
+		// Size represents the size of the blob in bytes.
+		Size int64 `json:"Size"`
+
+		// Path represents the path of the blob in the last layer of the image.
+		Path string `json:"Path"`
+	}
 )
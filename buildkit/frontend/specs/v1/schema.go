@@ -0,0 +1,132 @@
+package v1
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	ggufparser "github.com/gpustack/gguf-parser-go"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// SchemaID is the identifier of the JSON schema of the Image.
+const SchemaID = "https://github.com/gpustack/gguf-packer-go/buildkit/frontend/specs/v1/schema.json"
+
+// JSONSchema returns the JSON schema(draft 2020-12) of the Image.
+func JSONSchema() ([]byte, error) {
+	g := schemaGenerator{defs: map[string]any{}}
+	s := g.generate(reflect.TypeOf(Image{}))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["$id"] = SchemaID
+	s["title"] = "GGUF Packer Image Config"
+	s["$defs"] = g.defs
+	return json.MarshalIndent(s, "", "  ")
+}
+
+type schemaGenerator struct {
+	defs map[string]any
+}
+
+var schemaPackageAliases = map[string]string{
+	reflect.TypeOf(ocispec.Platform{}).PkgPath():    "ocispec",
+	reflect.TypeOf(ggufparser.GGUFFile{}).PkgPath(): "ggufparser",
+}
+
+var (
+	typeTime   = reflect.TypeOf(time.Time{})
+	typeDigest = reflect.TypeOf(digest.Digest(""))
+)
+
+func (g schemaGenerator) generate(t reflect.Type) map[string]any {
+	switch t {
+	case typeTime:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case typeDigest:
+		return map[string]any{"type": "string", "pattern": "^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.generate(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.generate(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.generate(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.generateStruct(t)
+		}
+		n := t.Name()
+		if pp := t.PkgPath(); pp != reflect.TypeOf(Image{}).PkgPath() {
+			if a, ok := schemaPackageAliases[pp]; ok {
+				pp = a
+			}
+			n = path.Base(pp) + "." + n
+		}
+		if _, ok := g.defs[n]; !ok {
+			g.defs[n] = true // Placeholder to avoid infinite recursion.
+			g.defs[n] = g.generateStruct(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + n}
+	default:
+		return map[string]any{}
+	}
+}
+
+func (g schemaGenerator) generateStruct(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	g.collectFields(t, props, &required)
+	s := map[string]any{
+		"type":       "object",
+		"properties": props,
+	}
+	if len(required) != 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func (g schemaGenerator) collectFields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		n, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && n == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.collectFields(ft, props, required)
+				continue
+			}
+		}
+		if n == "" {
+			n = f.Name
+		}
+		props[n] = g.generate(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			*required = append(*required, n)
+		}
+	}
+}
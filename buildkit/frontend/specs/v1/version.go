@@ -0,0 +1,174 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	ggufparser "github.com/gpustack/gguf-parser-go"
+)
+
+const (
+	// SchemaVersion1 is the initial schema version,
+	// which embeds the full GGUF file in the config.
+	SchemaVersion1 = 1
+
+	// SchemaVersion2 is the schema version which allows the GGUF file to be summarized,
+	// and references the full GGUF file via the Detail.
+	SchemaVersion2 = 2
+
+	// SchemaVersion is the current schema version.
+	SchemaVersion = SchemaVersion2
+)
+
+// upgrades holds the functions to upgrade the config from the index version to the next version.
+var upgrades = map[int]func(img *Image) error{
+	0:              upgradeToV1,
+	SchemaVersion1: upgradeToV2,
+}
+
+// ParseImage parses the given bytes as an Image,
+// upgrades it to the current schema version and validates it.
+func ParseImage(bs []byte) (img Image, err error) {
+	if err = json.Unmarshal(bs, &img); err != nil {
+		return img, fmt.Errorf("unmarshalling config: %w", err)
+	}
+	if err = Upgrade(&img); err != nil {
+		return img, fmt.Errorf("upgrading config: %w", err)
+	}
+	if err = img.Validate(); err != nil {
+		return img, fmt.Errorf("validating config: %w", err)
+	}
+	return img, nil
+}
+
+// Upgrade upgrades the given Image to the current schema version in place.
+func Upgrade(img *Image) error {
+	if img.Config.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("unsupported schema version %d, the latest is %d", img.Config.SchemaVersion, SchemaVersion)
+	}
+	for v := img.Config.SchemaVersion; v < SchemaVersion; v++ {
+		if err := upgrades[v](img); err != nil {
+			return fmt.Errorf("upgrading from schema version %d: %w", v, err)
+		}
+		img.Config.SchemaVersion = v + 1
+	}
+	return nil
+}
+
+// upgradeToV1 fills the fields derived from the GGUF metadata,
+// which may be missing in the configs created before versioning.
+func upgradeToV1(img *Image) error {
+	cfg := &img.Config
+	var size uint64
+	for _, gf := range cfg.GGUFFiles() {
+		if len(gf.Header.MetadataKV) == 0 {
+			continue
+		}
+		m := gf.Metadata()
+		if gf.Architecture == "" {
+			gf.Architecture = m.Architecture
+		}
+		if gf.Parameters == 0 {
+			gf.Parameters = m.Parameters
+		}
+		if gf.BitsPerWeight == 0 {
+			gf.BitsPerWeight = m.BitsPerWeight
+		}
+		if gf.FileType == 0 {
+			gf.FileType = m.FileType
+		}
+		size += uint64(gf.Size)
+	}
+	if cfg.Size == 0 {
+		cfg.Size = ggufparser.GGUFBytesScalar(size)
+	}
+	return nil
+}
+
+// upgradeToV2 does nothing,
+// as the full GGUF file is still allowed in SchemaVersion2.
+func upgradeToV2(_ *Image) error {
+	return nil
+}
+
+// GGUFFiles returns all non-nil GGUF files of the config,
+// in order of model, drafter, projector and adapters.
+func (c *ImageConfig) GGUFFiles() []*GGUFFile {
+	gfs := make([]*GGUFFile, 0, 3+len(c.Adapters))
+	for _, gf := range append([]*GGUFFile{c.Model, c.Drafter, c.Projector}, c.Adapters...) {
+		if gf != nil {
+			gfs = append(gfs, gf)
+		}
+	}
+	return gfs
+}
+
+// Validate validates the Image,
+// returns an error joined all violations if any.
+func (img *Image) Validate() error {
+	cfg := &img.Config
+
+	if cfg.Model == nil {
+		return errors.New("missing model")
+	}
+
+	var (
+		errs []error
+		size uint64
+	)
+	for _, gf := range []struct {
+		name string
+		file *GGUFFile
+	}{
+		{"model", cfg.Model},
+		{"drafter", cfg.Drafter},
+		{"projector", cfg.Projector},
+	} {
+		if gf.file == nil {
+			continue
+		}
+		errs = append(errs, gf.file.validate(gf.name, cfg.Cmd))
+		size += uint64(gf.file.Size)
+	}
+	for i, gf := range cfg.Adapters {
+		if gf == nil {
+			errs = append(errs, fmt.Errorf("adapter %d: missing", i))
+			continue
+		}
+		errs = append(errs, gf.validate(fmt.Sprintf("adapter %d", i), cfg.Cmd))
+		size += uint64(gf.Size)
+	}
+	if uint64(cfg.Size) != size {
+		errs = append(errs, fmt.Errorf("size %d is not equal to the sum of GGUF files %d", uint64(cfg.Size), size))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (gf *GGUFFile) validate(name string, cmd []string) error {
+	var errs []error
+	if gf.Architecture == "" {
+		errs = append(errs, errors.New("missing architecture"))
+	}
+	if len(gf.Header.MetadataKV) == 0 {
+		errs = append(errs, errors.New("missing metadata"))
+	}
+	if len(gf.TensorInfos) == 0 && gf.Detail == nil {
+		errs = append(errs, errors.New("missing tensor infos or detail"))
+	}
+	if gf.Detail != nil && gf.Detail.Digest.Validate() != nil {
+		errs = append(errs, fmt.Errorf("invalid detail digest %q", gf.Detail.Digest))
+	}
+	switch {
+	case gf.CmdParameterIndex < 0 || gf.CmdParameterIndex >= len(cmd):
+		errs = append(errs, fmt.Errorf("cmd parameter index %d is out of range [0, %d)", gf.CmdParameterIndex, len(cmd)))
+	case cmd[gf.CmdParameterIndex] != gf.CmdParameterValue:
+		errs = append(errs, fmt.Errorf("cmd parameter index %d points at %q, but expected %q",
+			gf.CmdParameterIndex, cmd[gf.CmdParameterIndex], gf.CmdParameterValue))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
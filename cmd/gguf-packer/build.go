@@ -0,0 +1,472 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	conreg "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	ggufpacker "github.com/gpustack/gguf-packer-go"
+	"github.com/gpustack/gguf-packer-go/buildkit/frontend/ggufpackerui"
+	"github.com/gpustack/gguf-packer-go/util/osx"
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/util/progress/progressui"
+	"github.com/spf13/cobra"
+	"github.com/tonistiigi/fsutil"
+	"golang.org/x/sync/errgroup"
+)
+
+const sourceDateEpochArg = "SOURCE_DATE_EPOCH"
+
+func build(app string) *cobra.Command {
+	var (
+		addr               = osx.Getenv("BUILDKIT_HOST", "unix:///run/buildkit/buildkitd.sock")
+		file               string
+		buildArgs          []string
+		target             string
+		tags               []string
+		push               bool
+		loadLocal          bool
+		insecure           bool
+		noCache            bool
+		progress           = string(progressui.AutoMode)
+		verifyReproducible bool
+	)
+
+	c := &cobra.Command{
+		Use:   "build [PATH]",
+		Short: "Build a model from a GGUFPackerfile via BuildKit.",
+		Long: `Build a model from a GGUFPackerfile via BuildKit.
+
+The build connects to a BuildKit daemon and runs the GGUFPackerfile frontend in-process,
+so neither the Docker CLI nor the gateway frontend image is required.`,
+		Example: sprintf(`  # Build the model of the current directory
+  %s build
+
+  # Build the model with a specific GGUFPackerfile
+  %[1]s build -f /path/to/GGUFPackerfile /path/to/dir
+
+  # Build the model and load it into the local store
+  %[1]s build -t gpustack/qwen2:0.5b-instruct --load-local
+
+  # Build the model and push it to the registry
+  %[1]s build -t gpustack/qwen2:0.5b-instruct --push
+
+  # Build the model with a remote BuildKit daemon
+  %[1]s build --addr tcp://buildkitd:1234 -t gpustack/qwen2:0.5b-instruct --load-local
+
+  # Verify the build is reproducible, which builds twice and diffs the manifests
+  %[1]s build --build-arg SOURCE_DATE_EPOCH=0 --verify-reproducible`, app),
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			bo, err := newBuildOptions(args, file, target, buildArgs)
+			if err != nil {
+				return err
+			}
+			if noCache {
+				bo.attrs["no-cache"] = ""
+			}
+
+			bc, err := bkclient.New(c.Context(), addr)
+			if err != nil {
+				return fmt.Errorf("connecting buildkit %s: %w", addr, err)
+			}
+			defer osx.Close(bc)
+
+			if verifyReproducible {
+				return verifyBuildReproducible(c, bc, bo, progress)
+			}
+
+			var rfs []name.Reference
+			for _, t := range tags {
+				rf, err := name.NewTag(t)
+				if err != nil {
+					return fmt.Errorf("parsing model reference %q: %w", t, err)
+				}
+				rfs = append(rfs, rf)
+			}
+			if (push || loadLocal) && len(rfs) == 0 {
+				return errors.New("--push or --load-local requires at least one tag")
+			}
+
+			var exps []bkclient.ExportEntry
+			if len(rfs) != 0 && (push || !loadLocal) {
+				ns := make([]string, len(rfs))
+				for i := range rfs {
+					ns[i] = rfs[i].Name()
+				}
+				exp := bkclient.ExportEntry{
+					Type: bkclient.ExporterImage,
+					Attrs: map[string]string{
+						"name": strings.Join(ns, ","),
+					},
+				}
+				if push {
+					exp.Attrs["push"] = "true"
+					if insecure {
+						exp.Attrs["registry.insecure"] = "true"
+					}
+				}
+				exps = append(exps, exp)
+			}
+			var ld string
+			if loadLocal {
+				ld, err = os.MkdirTemp("", "gguf-packer-build-")
+				if err != nil {
+					return fmt.Errorf("creating temporary directory: %w", err)
+				}
+				defer func() { _ = os.RemoveAll(ld) }()
+				exps = append(exps, bkclient.ExportEntry{
+					Type: bkclient.ExporterOCI,
+					Attrs: map[string]string{
+						"tar": "false",
+					},
+					OutputDir: ld,
+				})
+			}
+
+			if _, err = solveBuild(c.Context(), bc, bo, exps, progress); err != nil {
+				return err
+			}
+			if !loadLocal {
+				return nil
+			}
+
+			// Load into the local store.
+			img, err := retrieveOCIImageByLayout(ld)
+			if err != nil {
+				return err
+			}
+			if err = saveModel(c, rfs[0], img, false, nil); err != nil {
+				return err
+			}
+			// Link the other tags only, the layers are extracted by the first tag.
+			for _, rf := range rfs[1:] {
+				err = saveModel(c, rf, img, false, func(string) error { return nil })
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	c.Flags().StringVar(&addr, "addr", addr, "Specify the BuildKit daemon address, "+
+		"default from environment variable BUILDKIT_HOST.")
+	c.Flags().StringVarP(&file, "file", "f", file, "Specify the GGUFPackerfile, "+
+		"default is the GGUFPackerfile under PATH.")
+	c.Flags().StringArrayVar(&buildArgs, "build-arg", buildArgs, "Specify the build-time variables, in form of KEY=VALUE, "+
+		"or KEY to pass the variable of the environment, which must be set.")
+	c.Flags().StringVar(&target, "target", target, "Specify the target stage to build.")
+	c.Flags().StringArrayVarP(&tags, "tag", "t", tags, "Specify the model reference of the result, "+
+		"in form of [REGISTRY/]REPOSITORY[:TAG].")
+	c.Flags().BoolVar(&push, "push", push, "Push the result to the registry.")
+	c.Flags().BoolVar(&loadLocal, "load-local", loadLocal, "Load the result into the local store, "+
+		"instead of the image store of BuildKit or Docker.")
+	c.Flags().BoolVar(&insecure, "insecure", insecure, "Allow pushing to the registry without TLS.")
+	c.Flags().BoolVar(&noCache, "no-cache", noCache, "Do not use cache when building.")
+	c.Flags().StringVar(&progress, "progress", progress, "Specify the type of progress output, "+
+		"select from [auto, plain, tty, quiet, rawjson].")
+	c.Flags().BoolVar(&verifyReproducible, "verify-reproducible", verifyReproducible, "Build twice without cache, "+
+		"and verify the manifests are identical, requires SOURCE_DATE_EPOCH.")
+	return c
+}
+
+// verifyBuildReproducible builds twice, the second build ignores the cache,
+// then compares the manifests of the results.
+func verifyBuildReproducible(c *cobra.Command, bc *bkclient.Client, bo buildOptions, progress string) (err error) {
+	if _, ok := bo.attrs["build-arg:"+sourceDateEpochArg]; !ok {
+		return fmt.Errorf("verifying reproducible requires %s, "+
+			"please specify it by --build-arg or environment variable", sourceDateEpochArg)
+	}
+
+	var ds [2]string
+	for i := range ds {
+		ds[i], err = os.MkdirTemp("", "gguf-packer-build-")
+		if err != nil {
+			return fmt.Errorf("creating temporary directory: %w", err)
+		}
+		defer func(p string) { _ = os.RemoveAll(p) }(ds[i])
+
+		exp := bkclient.ExportEntry{
+			Type: bkclient.ExporterOCI,
+			Attrs: map[string]string{
+				"tar": "false",
+			},
+			OutputDir: ds[i],
+		}
+		if i != 0 {
+			bo.attrs["no-cache"] = ""
+		}
+		if _, err = solveBuild(c.Context(), bc, bo, []bkclient.ExportEntry{exp}, progress); err != nil {
+			return err
+		}
+	}
+
+	dfs, err := diffOCILayouts(ds[0], ds[1])
+	if err != nil {
+		return err
+	}
+	if len(dfs) == 0 {
+		if isTableFormat() {
+			fprintf(c.OutOrStdout(), "reproducible\n")
+			return nil
+		}
+		return render(c, []ociDifference{}, nil)
+	}
+	err = render(c, dfs, func() (hds, bds [][]any, border bool) {
+		bds = make([][]any, len(dfs))
+		for i := range dfs {
+			bds[i] = []any{dfs[i].Path, dfs[i].First, dfs[i].Second}
+		}
+		return [][]any{{"Path", "First Build", "Second Build"}}, bds, true
+	})
+	if err != nil {
+		return err
+	}
+	return errors.New("not reproducible")
+}
+
+// retrieveOCIImageByLayout returns the image from the given OCI layout,
+// which skips the attestation manifests.
+func retrieveOCIImageByLayout(p string) (conreg.Image, error) {
+	idx, err := layout.ImageIndexFromPath(p)
+	if err != nil {
+		return nil, fmt.Errorf("reading OCI layout %s: %w", p, err)
+	}
+	for {
+		im, err := idx.IndexManifest()
+		if err != nil {
+			return nil, fmt.Errorf("getting index manifest: %w", err)
+		}
+		ms := filterImageManifests(im.Manifests)
+		if len(ms) == 0 {
+			return nil, errors.New("empty model index")
+		}
+		if !ms[0].MediaType.IsIndex() {
+			img, err := idx.Image(ms[0].Digest)
+			if err != nil {
+				return nil, fmt.Errorf("getting model from index: %w", err)
+			}
+			return img, nil
+		}
+		idx, err = idx.ImageIndex(ms[0].Digest)
+		if err != nil {
+			return nil, fmt.Errorf("getting model index: %w", err)
+		}
+	}
+}
+
+type buildOptions struct {
+	attrs  map[string]string
+	mounts map[string]fsutil.FS
+}
+
+func newBuildOptions(args []string, file, target string, buildArgs []string) (bo buildOptions, err error) {
+	ctxDir := "."
+	if len(args) != 0 {
+		ctxDir = osx.InlineTilde(args[0])
+	}
+	if !osx.ExistsDir(ctxDir) {
+		return bo, fmt.Errorf("cannot find context directory %s", ctxDir)
+	}
+	if file == "" {
+		file = filepath.Join(ctxDir, ggufpackerui.DefaultGGUFPackerfileName)
+	} else {
+		file = osx.InlineTilde(file)
+	}
+	if !osx.ExistsFile(file) {
+		return bo, fmt.Errorf("cannot find GGUFPackerfile %s", file)
+	}
+
+	bo.attrs = map[string]string{
+		"filename":          filepath.Base(file),
+		"ggufpackerfilekey": "ggufpackerfile",
+	}
+	if target != "" {
+		bo.attrs["target"] = target
+	}
+	for _, ba := range buildArgs {
+		k, v, ok := strings.Cut(ba, "=")
+		if !ok {
+			v, ok = os.LookupEnv(k)
+			if !ok {
+				return bo, fmt.Errorf("invalid --build-arg %q, %s is not set in the environment", ba, k)
+			}
+		}
+		bo.attrs["build-arg:"+k] = v
+	}
+	if _, ok := bo.attrs["build-arg:"+sourceDateEpochArg]; !ok {
+		if v, ok := os.LookupEnv(sourceDateEpochArg); ok {
+			bo.attrs["build-arg:"+sourceDateEpochArg] = v
+		}
+	}
+
+	bo.mounts = map[string]fsutil.FS{}
+	for k, d := range map[string]string{
+		ggufpackerui.DefaultLocalNameContext: ctxDir,
+		"ggufpackerfile":                     filepath.Dir(file),
+	} {
+		bo.mounts[k], err = fsutil.NewFS(d)
+		if err != nil {
+			return bo, fmt.Errorf("opening %s: %w", d, err)
+		}
+	}
+	return bo, nil
+}
+
+// solveBuild builds with the in-process frontend,
+// and displays the progress in the given mode.
+func solveBuild(ctx context.Context, bc *bkclient.Client, bo buildOptions, exps []bkclient.ExportEntry, progress string) (*bkclient.SolveResponse, error) {
+	dp, err := progressui.NewDisplay(os.Stderr, progressui.DisplayMode(progress))
+	if err != nil {
+		return nil, fmt.Errorf("creating progress display: %w", err)
+	}
+
+	so := bkclient.SolveOpt{
+		Exports:       exps,
+		LocalMounts:   bo.mounts,
+		FrontendAttrs: bo.attrs,
+	}
+
+	var resp *bkclient.SolveResponse
+	ch := make(chan *bkclient.SolveStatus)
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		var err error
+		resp, err = bc.Build(ctx, so, "gguf-packer", ggufpacker.Build, ch)
+		return err
+	})
+	eg.Go(func() error {
+		_, err := dp.UpdateFrom(context.WithoutCancel(ctx), ch)
+		return err
+	})
+	if err = eg.Wait(); err != nil {
+		return nil, fmt.Errorf("building: %w", err)
+	}
+	return resp, nil
+}
+
+type ociDifference struct {
+	Path   string `json:"path"`
+	First  string `json:"first"`
+	Second string `json:"second"`
+}
+
+// diffOCILayouts compares the manifests of the given OCI layouts,
+// and returns the differences.
+func diffOCILayouts(first, second string) ([]ociDifference, error) {
+	var idxs [2]conreg.ImageIndex
+	for i, p := range []string{first, second} {
+		idx, err := layout.ImageIndexFromPath(p)
+		if err != nil {
+			return nil, fmt.Errorf("reading OCI layout %s: %w", p, err)
+		}
+		idxs[i] = idx
+	}
+	return diffOCIIndexes("index", idxs[0], idxs[1])
+}
+
+func diffOCIIndexes(path string, first, second conreg.ImageIndex) ([]ociDifference, error) {
+	var ims [2]*conreg.IndexManifest
+	for i, idx := range []conreg.ImageIndex{first, second} {
+		im, err := idx.IndexManifest()
+		if err != nil {
+			return nil, fmt.Errorf("getting index manifest: %w", err)
+		}
+		ims[i] = im
+	}
+	if len(ims[0].Manifests) != len(ims[1].Manifests) {
+		return []ociDifference{{
+			Path:   path + " manifests",
+			First:  fmt.Sprint(len(ims[0].Manifests)),
+			Second: fmt.Sprint(len(ims[1].Manifests)),
+		}}, nil
+	}
+
+	var dfs []ociDifference
+	for i := range ims[0].Manifests {
+		fm, sm := ims[0].Manifests[i], ims[1].Manifests[i]
+		if fm.Digest == sm.Digest {
+			continue
+		}
+		p := fmt.Sprintf("%s/%d", path, i)
+		if fm.Platform != nil {
+			p = fmt.Sprintf("%s/%s", path, fm.Platform)
+		}
+		dfs = append(dfs, ociDifference{Path: p, First: fm.Digest.String(), Second: sm.Digest.String()})
+		switch {
+		case fm.MediaType.IsIndex() && sm.MediaType.IsIndex():
+			fi, err := first.ImageIndex(fm.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("getting index %s: %w", fm.Digest, err)
+			}
+			si, err := second.ImageIndex(sm.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("getting index %s: %w", sm.Digest, err)
+			}
+			r, err := diffOCIIndexes(p, fi, si)
+			if err != nil {
+				return nil, err
+			}
+			dfs = append(dfs, r...)
+		case fm.MediaType.IsImage() && sm.MediaType.IsImage():
+			fi, err := first.Image(fm.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("getting image %s: %w", fm.Digest, err)
+			}
+			si, err := second.Image(sm.Digest)
+			if err != nil {
+				return nil, fmt.Errorf("getting image %s: %w", sm.Digest, err)
+			}
+			r, err := diffOCIImages(p, fi, si)
+			if err != nil {
+				return nil, err
+			}
+			dfs = append(dfs, r...)
+		}
+	}
+	return dfs, nil
+}
+
+func diffOCIImages(path string, first, second conreg.Image) ([]ociDifference, error) {
+	var ms [2]*conreg.Manifest
+	for i, img := range []conreg.Image{first, second} {
+		m, err := img.Manifest()
+		if err != nil {
+			return nil, fmt.Errorf("getting manifest: %w", err)
+		}
+		ms[i] = m
+	}
+
+	var dfs []ociDifference
+	if ms[0].Config.Digest != ms[1].Config.Digest {
+		dfs = append(dfs, ociDifference{
+			Path:   path + "/config",
+			First:  ms[0].Config.Digest.String(),
+			Second: ms[1].Config.Digest.String(),
+		})
+	}
+	if len(ms[0].Layers) != len(ms[1].Layers) {
+		return append(dfs, ociDifference{
+			Path:   path + " layers",
+			First:  fmt.Sprint(len(ms[0].Layers)),
+			Second: fmt.Sprint(len(ms[1].Layers)),
+		}), nil
+	}
+	for i := range ms[0].Layers {
+		if ms[0].Layers[i].Digest == ms[1].Layers[i].Digest {
+			continue
+		}
+		dfs = append(dfs, ociDifference{
+			Path:   fmt.Sprintf("%s/layer/%d", path, i),
+			First:  ms[0].Layers[i].Digest.String(),
+			Second: ms[1].Layers[i].Digest.String(),
+		})
+	}
+	return dfs, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggufparser "github.com/gpustack/gguf-parser-go"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+func compare(app string) *cobra.Command {
+	var (
+		insecure bool
+		force    bool
+		ef       = newEstimateFlags()
+		inJson   bool
+		inCsv    bool
+	)
+
+	c := &cobra.Command{
+		Use:   "compare MODEL...",
+		Short: "Compare the memory usage and quality of several models side by side.",
+		Example: sprintf(`  # Compare models
+  %s compare gpustack/qwen2:7b-instruct-q4-k-m gpustack/qwen2:7b-instruct-q5-k-m
+
+  # Compare models with the same flags
+  %[1]s compare gpustack/qwen2:7b-instruct-q4-k-m gpustack/llama3.1:8b-instruct-q4-0 --ctx-size 8192 --flash-attn
+
+  # Compare models with the maximum tokens per second
+  %[1]s compare gpustack/qwen2:7b-instruct-q4-k-m gpustack/qwen2:7b-instruct-q5-k-m --device-metric "10TFLOPS;400GBps"
+
+  # Compare models and output as CSV
+  %[1]s compare gpustack/qwen2:7b-instruct-q4-k-m gpustack/qwen2:7b-instruct-q5-k-m --format csv`, app),
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			switch {
+			case inJson && inCsv:
+				return errors.New("--json and --csv are mutually exclusive")
+			case inJson:
+				outputFormat = "json"
+			case inCsv:
+				outputFormat = "csv"
+			}
+
+			var cos crane.Options
+			{
+				co := []crane.Option{
+					getAuthnKeychainOption(),
+				}
+				if insecure {
+					co = append(co, crane.Insecure)
+				}
+				cos = crane.GetOptions(co...)
+			}
+
+			eopts, err := ef.options()
+			if err != nil {
+				return err
+			}
+			var (
+				mmap                      = !ef.noMMap
+				platformRAM, platformVRAM = ef.platformFootprints()
+			)
+
+			// Estimate all models under the same flags,
+			// ignoring the CMD of each model.
+			cis := make(compareItems, len(args))
+			eg := errgroup.Group{}
+			for i := range args {
+				i := i
+				eg.Go(func() error {
+					model := args[i]
+					rf, err := name.NewTag(model, cos.Name...)
+					if err != nil {
+						return fmt.Errorf("parsing model reference %q: %w", model, err)
+					}
+					cf, err := retrieveConfigByOCIReference(force, true, rf, cos.Remote...)
+					if err != nil {
+						return fmt.Errorf("retrieving model %q: %w", model, err)
+					}
+					m := cf.Config.Model
+					if m == nil {
+						return fmt.Errorf("model %q has no model file", model)
+					}
+					mopts := withEstimateAuxiliaries(cf.Config, eopts, -1)
+					cis[i] = compareItem{
+						Model:         model,
+						Architecture:  m.Architecture,
+						Parameters:    m.Parameters,
+						BitsPerWeight: m.BitsPerWeight,
+						FileType:      m.FileType,
+						Estimate:      m.EstimateLLaMACppRun(mopts...).Summarize(mmap, platformRAM, platformVRAM),
+					}
+					return nil
+				})
+			}
+			if err = eg.Wait(); err != nil {
+				return err
+			}
+
+			return render(c, cis, func() (hds, bds [][]any, border bool) {
+				hds = [][]any{
+					{"Model", "Arch", "Params", "BPW", "File Type", "Context Size", "Full Offloaded"},
+					{"Model", "Arch", "Params", "BPW", "File Type", "Context Size", "Full Offloaded"},
+				}
+				withTPS := cis[0].Estimate.Items[0].MaximumTokensPerSecond != nil
+				if withTPS {
+					hds[0] = append(hds[0], "Max TPS")
+					hds[1] = append(hds[1], "Max TPS")
+				}
+				hds[0] = append(hds[0], "RAM", "RAM")
+				hds[1] = append(hds[1], "UMA", "NonUMA")
+				for _, v := range cis[0].Estimate.Items[0].VRAMs {
+					var hd string
+					if v.Remote {
+						hd = fmt.Sprintf("RPC %d (V)RAM", v.Position)
+					} else {
+						hd = fmt.Sprintf("VRAM %d", v.Position)
+					}
+					hds[0] = append(hds[0], hd, hd)
+					hds[1] = append(hds[1], "UMA", "NonUMA")
+				}
+				bds = make([][]any, len(cis))
+				for i := range cis {
+					esi := cis[i].Estimate.Items[0]
+					bds[i] = []any{
+						cis[i].Model,
+						sprintf(cis[i].Architecture),
+						sprintf(cis[i].Parameters),
+						sprintf(cis[i].BitsPerWeight),
+						sprintf(cis[i].FileType),
+						sprintf(cis[i].Estimate.ContextSize),
+						sprintf(tenary(esi.FullOffloaded, "Yes", "No")),
+					}
+					if withTPS {
+						bds[i] = append(bds[i], sprintf(tenary(esi.MaximumTokensPerSecond != nil, esi.MaximumTokensPerSecond, "N/A")))
+					}
+					bds[i] = append(bds[i], sprintf(esi.RAM.UMA), sprintf(esi.RAM.NonUMA))
+					for _, v := range esi.VRAMs {
+						bds[i] = append(bds[i], sprintf(v.UMA), sprintf(v.NonUMA))
+					}
+				}
+				return hds, bds, true
+			})
+		},
+	}
+	c.Flags().BoolVar(&insecure, "insecure", insecure, "Allow model references to be fetched without TLS.")
+	c.Flags().BoolVar(&force, "force", force, "Always estimate the models from the registry.")
+	ef.addFlags(c.Flags())
+	c.Flags().BoolVar(&inJson, "json", inJson, "Output as JSON.")
+	c.Flags().BoolVar(&inCsv, "csv", inCsv, "Output as CSV.")
+	_ = c.Flags().MarkDeprecated("json", "use --format json instead")
+	_ = c.Flags().MarkDeprecated("csv", "use --format csv instead")
+	return c
+}
+
+type (
+	// compareItem holds the comparison result of a model.
+	compareItem struct {
+		Model         string                                `json:"model"`
+		Architecture  string                                `json:"architecture"`
+		Parameters    ggufparser.GGUFParametersScalar       `json:"parameters"`
+		BitsPerWeight ggufparser.GGUFBitsPerWeightScalar    `json:"bitsPerWeight"`
+		FileType      ggufparser.GGUFFileType               `json:"fileType"`
+		Estimate      ggufparser.LLaMACppRunEstimateSummary `json:"estimate"`
+	}
+
+	// compareItems is a list of compareItem.
+	compareItems []compareItem
+)
+
+// csvRecords implements csvRenderer,
+// the sizes are in bytes for consuming.
+func (cis compareItems) csvRecords() (hd []string, rcs [][]string) {
+	hd = []string{"model", "architecture", "parameters", "bpw", "file_type", "context_size", "full_offloaded", "max_tps", "ram_uma", "ram_nonuma"}
+	for _, v := range cis[0].Estimate.Items[0].VRAMs {
+		hd = append(hd, fmt.Sprintf("vram_%d_uma", v.Position), fmt.Sprintf("vram_%d_nonuma", v.Position))
+	}
+	for i := range cis {
+		esi := cis[i].Estimate.Items[0]
+		var tps string
+		if esi.MaximumTokensPerSecond != nil {
+			tps = strconv.FormatFloat(float64(*esi.MaximumTokensPerSecond), 'f', 2, 64)
+		}
+		r := []string{
+			cis[i].Model,
+			cis[i].Architecture,
+			strconv.FormatUint(uint64(cis[i].Parameters), 10),
+			strconv.FormatFloat(float64(cis[i].BitsPerWeight), 'f', 2, 64),
+			cis[i].FileType.String(),
+			strconv.FormatUint(cis[i].Estimate.ContextSize, 10),
+			strconv.FormatBool(esi.FullOffloaded),
+			tps,
+			strconv.FormatUint(uint64(esi.RAM.UMA), 10),
+			strconv.FormatUint(uint64(esi.RAM.NonUMA), 10),
+		}
+		for _, v := range esi.VRAMs {
+			r = append(r, strconv.FormatUint(uint64(v.UMA), 10), strconv.FormatUint(uint64(v.NonUMA), 10))
+		}
+		rcs = append(rcs, r)
+	}
+	return hd, rcs
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gpustack/gguf-packer-go/util/osx"
+	ggufparser "github.com/gpustack/gguf-parser-go"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func devices(app string) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "devices",
+		Short: "Manage the device profiles.",
+		Long: sprintf(`Manage the device profiles.
+
+The device profiles are stored in %s,
+which describe the RAM, GPUs and RPC servers of the hardware, for example:
+
+  profiles:
+    a100x2:
+      ram: 512GiB
+      flops: 1TFLOPS
+      bandwidth: 200GBps
+      gpus:
+        - name: NVIDIA A100-SXM4-80GB
+          vram: 80GiB
+          flops: 312TFLOPS
+          bandwidth: 2039GBps
+        - name: NVIDIA A100-SXM4-80GB
+          vram: 80GiB
+          flops: 312TFLOPS
+          bandwidth: 2039GBps
+      rpcs:
+        - host: 192.168.1.2:50052
+          vram: 24GiB
+
+A profile can be used by "estimate --profile", "compare --profile" and "run --profile".`, getDevicesProfilesPath()),
+		Example: sprintf(`  # Detect the local devices as profile "local"
+  %s devices detect
+
+  # List all profiles
+  %[1]s devices list`, app),
+		Args: cobra.NoArgs,
+	}
+	c.AddCommand(devicesDetect(app), devicesList(app))
+	return c
+}
+
+func devicesDetect(app string) *cobra.Command {
+	var (
+		profile           = "local"
+		nvidiaSMIOutput   string
+		rocmSMIOutput     string
+		meminfo           string
+		platformFootprint string
+		dryRun            bool
+	)
+	c := &cobra.Command{
+		Use:   "detect",
+		Short: "Detect the local devices and write them as a profile.",
+		Example: sprintf(`  # Detect the local devices as profile "local"
+  %s devices detect
+
+  # Detect the local devices as profile "a100x2"
+  %[1]s devices detect --profile a100x2
+
+  # Detect from the saved outputs instead of executing the tools
+  %[1]s devices detect --nvidia-smi-output nvidia-smi.csv --meminfo meminfo.txt --dry-run`, app),
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			var p deviceProfile
+
+			// RAM.
+			if meminfo != "" {
+				bs, err := os.ReadFile(meminfo)
+				if err != nil {
+					return fmt.Errorf("reading meminfo: %w", err)
+				}
+				if p.RAM, err = parseMeminfo(bs); err != nil {
+					return err
+				}
+			} else {
+				var err error
+				if p.RAM, err = detectRAM(); err != nil {
+					return err
+				}
+			}
+
+			// GPUs.
+			{
+				bs, err := readDetectOutput(c, nvidiaSMIOutput,
+					"nvidia-smi", "--query-gpu=name,memory.total", "--format=csv,noheader,nounits")
+				if err != nil {
+					return err
+				}
+				gs, err := parseNvidiaSMIOutput(bs)
+				if err != nil {
+					return err
+				}
+				p.GPUs = append(p.GPUs, gs...)
+			}
+			{
+				bs, err := readDetectOutput(c, rocmSMIOutput,
+					"rocm-smi", "--showproductname", "--showmeminfo", "vram", "--csv")
+				if err != nil {
+					return err
+				}
+				gs, err := parseROCmSMIOutput(bs, false)
+				if err != nil {
+					return err
+				}
+				p.GPUs = append(p.GPUs, gs...)
+			}
+			p.PlatformFootprint = platformFootprint
+
+			dps, err := loadDeviceProfiles()
+			if err != nil {
+				return err
+			}
+			if op, ok := dps.Profiles[profile]; ok {
+				p.mergeUndetected(op)
+			}
+			if dps.Profiles == nil {
+				dps.Profiles = map[string]deviceProfile{}
+			}
+			dps.Profiles[profile] = p
+
+			if dryRun {
+				bs, err := marshalDeviceProfiles(deviceProfiles{Profiles: map[string]deviceProfile{profile: p}})
+				if err != nil {
+					return fmt.Errorf("marshalling profile: %w", err)
+				}
+				fprint(c.OutOrStdout(), string(bs))
+				return nil
+			}
+			return saveDeviceProfiles(dps)
+		},
+	}
+	c.Flags().StringVar(&profile, "profile", profile, "Specify the name of the profile to write.")
+	c.Flags().StringVar(&nvidiaSMIOutput, "nvidia-smi-output", nvidiaSMIOutput, "Specify the file of "+
+		"\"nvidia-smi --query-gpu=name,memory.total --format=csv,noheader,nounits\" output, "+
+		"instead of executing nvidia-smi.")
+	c.Flags().StringVar(&rocmSMIOutput, "rocm-smi-output", rocmSMIOutput, "Specify the file of "+
+		"\"rocm-smi --showproductname --showmeminfo vram --csv\" output, "+
+		"instead of executing rocm-smi.")
+	c.Flags().StringVar(&meminfo, "meminfo", meminfo, "Specify the file to detect the RAM, in /proc/meminfo format, "+
+		"instead of detecting the RAM of the host.")
+	c.Flags().StringVar(&platformFootprint, "platform-footprint", platformFootprint, "Specify the platform footprint(RAM,VRAM) in MiB.")
+	c.Flags().BoolVar(&dryRun, "dry-run", dryRun, "Print the detected profile, but do not write it.")
+	return c
+}
+
+func devicesList(app string) *cobra.Command {
+	var inJson bool
+	c := &cobra.Command{
+		Use:   "list",
+		Short: "List all device profiles.",
+		Example: sprintf(`  # List all profiles
+  %s devices list`, app),
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			dps, err := loadDeviceProfiles()
+			if err != nil {
+				return err
+			}
+			if inJson {
+				outputFormat = "json"
+			}
+
+			ns := make([]string, 0, len(dps.Profiles))
+			for n := range dps.Profiles {
+				ns = append(ns, n)
+			}
+			slices.Sort(ns)
+			ps := make([]namedDeviceProfile, len(ns))
+			for i := range ns {
+				ps[i] = namedDeviceProfile{Name: ns[i], deviceProfile: dps.Profiles[ns[i]]}
+			}
+			return render(c, ps, func() (hds, bds [][]any, border bool) {
+				for _, p := range ps {
+					gs := make([]string, 0, len(p.GPUs))
+					for _, g := range p.GPUs {
+						gs = append(gs, sprintf("%s (%s)", g.Name, g.VRAM))
+					}
+					rs := make([]string, 0, len(p.RPCs))
+					for _, r := range p.RPCs {
+						rs = append(rs, sprintf("%s (%s)", r.Host, r.VRAM))
+					}
+					bds = append(bds, []any{p.Name, p.RAM, strings.Join(gs, "\n"), strings.Join(rs, "\n")})
+				}
+				return [][]any{{"Name", "RAM", "GPUs", "RPCs"}}, bds, false
+			})
+		},
+	}
+	c.Flags().BoolVar(&inJson, "json", inJson, "Output as JSON.")
+	_ = c.Flags().MarkDeprecated("json", "use --format json instead")
+	return c
+}
+
+type (
+	// deviceProfiles holds the named device profiles.
+	deviceProfiles struct {
+		Profiles map[string]deviceProfile `json:"profiles" yaml:"profiles"`
+	}
+
+	// deviceProfile describes the hardware to run a model.
+	deviceProfile struct {
+		// RAM is the size of the host memory, e.g. 64GiB.
+		RAM string `json:"ram,omitempty" yaml:"ram,omitempty"`
+		// FLOPS is the FLOPS of the host CPU, e.g. 1TFLOPS.
+		FLOPS string `json:"flops,omitempty" yaml:"flops,omitempty"`
+		// Bandwidth is the memory bandwidth of the host, e.g. 200GBps.
+		Bandwidth string `json:"bandwidth,omitempty" yaml:"bandwidth,omitempty"`
+		// PlatformFootprint is the platform footprint(RAM,VRAM) in MiB, e.g. 150,250.
+		PlatformFootprint string `json:"platformFootprint,omitempty" yaml:"platformFootprint,omitempty"`
+		// GPUs are the local GPUs.
+		GPUs []deviceProfileDevice `json:"gpus,omitempty" yaml:"gpus,omitempty"`
+		// RPCs are the remote RPC servers.
+		RPCs []deviceProfileDevice `json:"rpcs,omitempty" yaml:"rpcs,omitempty"`
+	}
+
+	// namedDeviceProfile is a deviceProfile with its name.
+	namedDeviceProfile struct {
+		Name string `json:"name"`
+		deviceProfile
+	}
+
+	// deviceProfileDevice describes a GPU or an RPC server.
+	deviceProfileDevice struct {
+		// Name is the name of the device.
+		Name string `json:"name,omitempty" yaml:"name,omitempty"`
+		// Host is the address of the RPC server, in form of host:port.
+		Host string `json:"host,omitempty" yaml:"host,omitempty"`
+		// VRAM is the size of the device memory, e.g. 24GiB.
+		VRAM string `json:"vram" yaml:"vram"`
+		// FLOPS is the FLOPS of the device, e.g. 82TFLOPS.
+		FLOPS string `json:"flops,omitempty" yaml:"flops,omitempty"`
+		// Bandwidth is the up bandwidth of the device, e.g. 1TBps.
+		Bandwidth string `json:"bandwidth,omitempty" yaml:"bandwidth,omitempty"`
+		// DownBandwidth is the down bandwidth of the device, same as Bandwidth if empty.
+		DownBandwidth string `json:"downBandwidth,omitempty" yaml:"downBandwidth,omitempty"`
+	}
+)
+
+func getDevicesProfilesPath() string {
+	return filepath.Join(storePath, "devices.yaml")
+}
+
+func loadDeviceProfiles() (dps deviceProfiles, err error) {
+	p := getDevicesProfilesPath()
+	if !osx.ExistsFile(p) {
+		return dps, nil
+	}
+	bs, err := os.ReadFile(p)
+	if err != nil {
+		return dps, fmt.Errorf("reading device profiles: %w", err)
+	}
+	if err = yaml.Unmarshal(bs, &dps); err != nil {
+		return dps, fmt.Errorf("parsing device profiles %s: %w", p, err)
+	}
+	return dps, nil
+}
+
+func saveDeviceProfiles(dps deviceProfiles) error {
+	bs, err := marshalDeviceProfiles(dps)
+	if err != nil {
+		return fmt.Errorf("marshalling device profiles: %w", err)
+	}
+	if err = osx.WriteFile(getDevicesProfilesPath(), bs, 0644); err != nil {
+		return fmt.Errorf("writing device profiles: %w", err)
+	}
+	return nil
+}
+
+func marshalDeviceProfiles(dps deviceProfiles) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(dps); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func getDeviceProfile(name string) (deviceProfile, error) {
+	dps, err := loadDeviceProfiles()
+	if err != nil {
+		return deviceProfile{}, err
+	}
+	p, ok := dps.Profiles[name]
+	if !ok {
+		return p, fmt.Errorf("device profile %q not found in %s", name, getDevicesProfilesPath())
+	}
+	return p, nil
+}
+
+// devices returns the RPC servers and GPUs of the profile,
+// in the order of llama.cpp, which places the RPC servers first.
+func (p deviceProfile) devices() []deviceProfileDevice {
+	return append(p.RPCs[:len(p.RPCs):len(p.RPCs)], p.GPUs...)
+}
+
+// resources returns the RAM and VRAMs of the profile,
+// nil RAM means unknown.
+func (p deviceProfile) resources() (ram *ggufparser.GGUFBytesScalar, vrams []ggufparser.GGUFBytesScalar, err error) {
+	if p.RAM != "" {
+		v, err := ggufparser.ParseGGUFBytesScalar(p.RAM)
+		if err != nil {
+			return nil, nil, fmt.Errorf("profile has invalid RAM: %w", err)
+		}
+		ram = &v
+	}
+	for _, d := range p.devices() {
+		v, err := ggufparser.ParseGGUFBytesScalar(d.VRAM)
+		if err != nil {
+			return nil, nil, fmt.Errorf("profile has invalid VRAM of %s: %w", tenary(d.Host != "", d.Host, d.Name), err)
+		}
+		vrams = append(vrams, v)
+	}
+	return ram, vrams, nil
+}
+
+// tensorSplit returns the tensor split of the profile in proportion to the VRAMs,
+// empty if no split is required.
+func (p deviceProfile) tensorSplit() (string, error) {
+	ds := p.devices()
+	if len(ds) < 2 && len(p.RPCs) == 0 {
+		return "", nil
+	}
+	_, vrams, err := p.resources()
+	if err != nil {
+		return "", err
+	}
+	ts := make([]string, len(vrams))
+	for i := range vrams {
+		ts[i] = strconv.FormatUint(uint64(vrams[i])>>20, 10)
+	}
+	return strings.Join(ts, ","), nil
+}
+
+// rpcServers returns the RPC servers of the profile.
+func (p deviceProfile) rpcServers() string {
+	hs := make([]string, len(p.RPCs))
+	for i := range p.RPCs {
+		hs[i] = p.RPCs[i].Host
+	}
+	return strings.Join(hs, ",")
+}
+
+// deviceMetrics returns the device metrics of the profile,
+// empty if any of the host or devices misses the metric.
+func (p deviceProfile) deviceMetrics() []string {
+	toMetric := func(flops, up, down string) string {
+		if flops == "" || up == "" {
+			return ""
+		}
+		if down == "" {
+			return flops + ";" + up
+		}
+		return flops + ";" + up + ";" + down
+	}
+	m := toMetric(p.FLOPS, p.Bandwidth, "")
+	if m == "" {
+		return nil
+	}
+	dms := []string{m}
+	for _, d := range p.devices() {
+		m = toMetric(d.FLOPS, d.Bandwidth, d.DownBandwidth)
+		if m == "" {
+			return nil
+		}
+		dms = append(dms, m)
+	}
+	return dms
+}
+
+// mergeUndetected merges the fields which cannot be detected from the given profile.
+func (p *deviceProfile) mergeUndetected(op deviceProfile) {
+	p.FLOPS, p.Bandwidth = op.FLOPS, op.Bandwidth
+	if p.PlatformFootprint == "" {
+		p.PlatformFootprint = op.PlatformFootprint
+	}
+	p.RPCs = op.RPCs
+	for i := range p.GPUs {
+		if i >= len(op.GPUs) || p.GPUs[i].Name != op.GPUs[i].Name {
+			continue
+		}
+		p.GPUs[i].FLOPS = op.GPUs[i].FLOPS
+		p.GPUs[i].Bandwidth = op.GPUs[i].Bandwidth
+		p.GPUs[i].DownBandwidth = op.GPUs[i].DownBandwidth
+	}
+}
+
+// readDetectOutput reads the output of the detecting tool,
+// from the given file if specified, otherwise executes the tool if it exists.
+func readDetectOutput(c *cobra.Command, file, tool string, args ...string) ([]byte, error) {
+	if file != "" {
+		bs, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s output: %w", tool, err)
+		}
+		return bs, nil
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		return nil, nil
+	}
+	bs, err := exec.CommandContext(c.Context(), tool, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("executing %s: %w", tool, err)
+	}
+	return bs, nil
+}
+
+// parseMeminfo parses the total memory from the /proc/meminfo format content.
+func parseMeminfo(bs []byte) (string, error) {
+	s := bufio.NewScanner(bytes.NewReader(bs))
+	for s.Scan() {
+		k, v, ok := strings.Cut(s.Text(), ":")
+		if !ok || k != "MemTotal" {
+			continue
+		}
+		v = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(v), "kB"))
+		kb, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("parsing MemTotal: %w", err)
+		}
+		return fmt.Sprintf("%dMiB", kb>>10), nil
+	}
+	return "", errors.New("cannot find MemTotal in meminfo")
+}
+
+// parseNvidiaSMIOutput parses the GPUs from the output of
+// "nvidia-smi --query-gpu=name,memory.total --format=csv,noheader,nounits",
+// each line is in form of "NAME, MEMORY_MIB".
+func parseNvidiaSMIOutput(bs []byte) ([]deviceProfileDevice, error) {
+	var ds []deviceProfileDevice
+	s := bufio.NewScanner(bytes.NewReader(bs))
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l == "" {
+			continue
+		}
+		i := strings.LastIndex(l, ",")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid nvidia-smi output line %q", l)
+		}
+		mib, err := strconv.ParseUint(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(l[i+1:]), "MiB")), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing nvidia-smi memory of %q: %w", l, err)
+		}
+		ds = append(ds, deviceProfileDevice{
+			Name: strings.TrimSpace(l[:i]),
+			VRAM: fmt.Sprintf("%dMiB", mib),
+		})
+	}
+	return ds, nil
+}
+
+// parseROCmSMIOutput parses the GPUs from the output of
+// "rocm-smi --showproductname --showmeminfo vram --csv",
+// the VRAM is the free memory if free is true, otherwise the total memory.
+func parseROCmSMIOutput(bs []byte, free bool) ([]deviceProfileDevice, error) {
+	// Skip the banners before the CSV header.
+	if i := bytes.Index(bs, []byte("device,")); i >= 0 {
+		bs = bs[i:]
+	} else {
+		return nil, nil
+	}
+	r := csv.NewReader(bytes.NewReader(bs))
+	r.FieldsPerRecord = -1
+	rs, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parsing rocm-smi output: %w", err)
+	}
+	ni, mi, ui := -1, -1, -1
+	for i, h := range rs[0] {
+		switch h {
+		case "Card series":
+			ni = i
+		case "Card model":
+			if ni < 0 {
+				ni = i
+			}
+		case "VRAM Total Memory (B)":
+			mi = i
+		case "VRAM Total Used Memory (B)":
+			ui = i
+		}
+	}
+	if mi < 0 {
+		return nil, errors.New("cannot find VRAM Total Memory in rocm-smi output")
+	}
+	if free && ui < 0 {
+		return nil, errors.New("cannot find VRAM Total Used Memory in rocm-smi output")
+	}
+	var ds []deviceProfileDevice
+	for _, r := range rs[1:] {
+		if len(r) <= mi || !strings.HasPrefix(r[0], "card") {
+			continue
+		}
+		b, err := strconv.ParseUint(strings.TrimSpace(r[mi]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing rocm-smi memory of %s: %w", r[0], err)
+		}
+		if free {
+			if len(r) <= ui {
+				continue
+			}
+			u, err := strconv.ParseUint(strings.TrimSpace(r[ui]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parsing rocm-smi used memory of %s: %w", r[0], err)
+			}
+			b -= min(u, b)
+		}
+		d := deviceProfileDevice{
+			Name: r[0],
+			VRAM: fmt.Sprintf("%dMiB", b>>20),
+		}
+		if ni >= 0 && ni < len(r) {
+			d.Name = strings.TrimSpace(r[ni])
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
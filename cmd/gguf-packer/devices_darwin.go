@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// detectRAM returns the total RAM of the host, in MiB.
+func detectRAM() (string, error) {
+	b, err := unix.SysctlUint64("hw.memsize")
+	if err != nil {
+		return "", fmt.Errorf("getting hw.memsize: %w", err)
+	}
+	return fmt.Sprintf("%dMiB", b>>20), nil
+}
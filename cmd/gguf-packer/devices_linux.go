@@ -0,0 +1,15 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// detectRAM returns the total RAM of the host, in MiB.
+func detectRAM() (string, error) {
+	bs, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return "", fmt.Errorf("reading meminfo: %w", err)
+	}
+	return parseMeminfo(bs)
+}
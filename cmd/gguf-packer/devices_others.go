@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+// detectRAM returns the total RAM of the host, in MiB,
+// which is not detected on this platform.
+func detectRAM() (string, error) {
+	return "", nil
+}
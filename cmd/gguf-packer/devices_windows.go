@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// memoryStatusEx is the MEMORYSTATUSEX structure of Windows.
+type memoryStatusEx struct {
+	Length               uint32
+	MemoryLoad           uint32
+	TotalPhys            uint64
+	AvailPhys            uint64
+	TotalPageFile        uint64
+	AvailPageFile        uint64
+	TotalVirtual         uint64
+	AvailVirtual         uint64
+	AvailExtendedVirtual uint64
+}
+
+var procGlobalMemoryStatusEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GlobalMemoryStatusEx")
+
+// detectRAM returns the total RAM of the host, in MiB.
+func detectRAM() (string, error) {
+	ms := memoryStatusEx{}
+	ms.Length = uint32(unsafe.Sizeof(ms))
+	if r, _, err := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&ms))); r == 0 {
+		return "", fmt.Errorf("calling GlobalMemoryStatusEx: %w", err)
+	}
+	return fmt.Sprintf("%dMiB", ms.TotalPhys>>20), nil
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	specs "github.com/gpustack/gguf-packer-go/buildkit/frontend/specs/v1"
+	ggufparser "github.com/gpustack/gguf-parser-go"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+func diff(app string) *cobra.Command {
+	var (
+		insecure bool
+		force    bool
+		noTrunc  bool
+		sections []string
+	)
+	c := &cobra.Command{
+		Use:   "diff MODEL|FILE|URL MODEL|FILE|URL",
+		Short: "Show the differences between two models.",
+		Example: sprintf(`  # Show the differences between two models
+  %s diff gpustack/qwen2:0.5b-instruct-q4-k-m gpustack/qwen2:0.5b-instruct-q5-k-m
+
+  # Show the tensor differences only
+  %[1]s diff gpustack/qwen2:0.5b-instruct-q4-k-m gpustack/qwen2:0.5b-instruct-q5-k-m --section tensor
+
+  # Show the differences between a model and a local GGUF file
+  %[1]s diff gpustack/qwen2:0.5b-instruct ~/models/qwen2-0_5b-instruct-q4_k_m.gguf --format json`, app),
+		Args: cobra.ExactArgs(2),
+		RunE: func(c *cobra.Command, args []string) error {
+			for _, s := range sections {
+				if !slices.Contains(diffSections, s) {
+					return fmt.Errorf("--section has invalid value %q, select from %v", s, diffSections)
+				}
+			}
+
+			var cos crane.Options
+			{
+				co := []crane.Option{
+					getAuthnKeychainOption(),
+				}
+				if insecure {
+					co = append(co, crane.Insecure)
+				}
+				cos = crane.GetOptions(co...)
+			}
+
+			cfs := make([]specs.Image, len(args))
+			eg := errgroup.Group{}
+			for i := range args {
+				i := i
+				eg.Go(func() (err error) {
+					model := args[i]
+					if isGGUFSource(model) {
+						cfs[i], err = retrieveConfigByGGUFSource(c.Context(), true, insecure, model, ggufSourceFlags{})
+						return err
+					}
+					rf, err := name.NewTag(model, cos.Name...)
+					if err != nil {
+						return fmt.Errorf("parsing model reference %q: %w", model, err)
+					}
+					cfs[i], err = retrieveConfigByOCIReference(force, true, rf, cos.Remote...)
+					if err != nil {
+						return fmt.Errorf("retrieving model %q: %w", model, err)
+					}
+					return nil
+				})
+			}
+			if err := eg.Wait(); err != nil {
+				return err
+			}
+
+			mds := diffImages(cfs[0], cfs[1])
+			if len(sections) != 0 {
+				mds = slices.DeleteFunc(mds, func(md modelDifference) bool {
+					return !slices.Contains(sections, md.Section)
+				})
+			}
+
+			return render(c, mds, func() (hds, bds [][]any, border bool) {
+				hds = [][]any{
+					{
+						"Section",
+						"File",
+						"Key",
+						"Change",
+						"First",
+						"Second",
+						"Delta",
+					},
+				}
+				trunc := func(s string) string {
+					if !noTrunc && len(s) > 50 {
+						return s[:47] + "..."
+					}
+					return s
+				}
+				bds = make([][]any, len(mds))
+				for i, md := range mds {
+					var d string
+					switch {
+					case md.SizeDelta > 0:
+						d = "+" + sprintf(ggufparser.GGUFBytesScalar(md.SizeDelta))
+					case md.SizeDelta < 0:
+						d = "-" + sprintf(ggufparser.GGUFBytesScalar(-md.SizeDelta))
+					}
+					bds[i] = []any{
+						md.Section,
+						md.File,
+						trunc(md.Key),
+						md.Change,
+						trunc(md.First),
+						trunc(md.Second),
+						d,
+					}
+				}
+				return hds, bds, false
+			})
+		},
+	}
+	c.Flags().BoolVar(&insecure, "insecure", insecure, "Allow model references or URLs to be fetched without TLS.")
+	c.Flags().BoolVar(&force, "force", force, "Always retrieve the models from the registry.")
+	c.Flags().BoolVar(&noTrunc, "no-trunc", noTrunc, "Do not truncate the output.")
+	c.Flags().StringSliceVar(&sections, "section", sections, "Show the given sections only, "+
+		"select from [overall, metadata, tensor, cmd, label].")
+	return c
+}
+
+// diffSections are the sections of the modelDifference, in output order.
+var diffSections = []string{"overall", "metadata", "tensor", "cmd", "label"}
+
+// modelDifference holds a difference between two models.
+type modelDifference struct {
+	// Section is the section of the difference, select from diffSections.
+	Section string `json:"section"`
+	// File is the GGUF file of the difference,
+	// select from [model, drafter, projector, adapter[N]], empty means the whole model.
+	File string `json:"file,omitempty"`
+	// Key is the difference key, e.g. the metadata key, the tensor name or the label key.
+	Key string `json:"key"`
+	// Change is the difference kind, select from [added, removed, changed].
+	Change string `json:"change"`
+	// First is the value of the first model.
+	First string `json:"first,omitempty"`
+	// Second is the value of the second model.
+	Second string `json:"second,omitempty"`
+	// SizeDelta is the size in bytes of the second model minus the first model.
+	SizeDelta int64 `json:"sizeDelta,omitempty"`
+}
+
+const (
+	diffChangeAdded   = "added"
+	diffChangeRemoved = "removed"
+	diffChangeChanged = "changed"
+)
+
+// diffImages returns the differences between the given two model configs,
+// the GGUF files must be inflated to compare the tensors.
+func diffImages(a, b specs.Image) (mds []modelDifference) {
+	type filePair struct {
+		name string
+		a, b *specs.GGUFFile
+	}
+	fps := []filePair{
+		{"model", a.Config.Model, b.Config.Model},
+		{"drafter", a.Config.Drafter, b.Config.Drafter},
+		{"projector", a.Config.Projector, b.Config.Projector},
+	}
+	for i := 0; i < max(len(a.Config.Adapters), len(b.Config.Adapters)); i++ {
+		fp := filePair{name: fmt.Sprintf("adapter[%d]", i)}
+		if i < len(a.Config.Adapters) {
+			fp.a = a.Config.Adapters[i]
+		}
+		if i < len(b.Config.Adapters) {
+			fp.b = b.Config.Adapters[i]
+		}
+		fps = append(fps, fp)
+	}
+
+	// Overall.
+	mds = appendDifference(mds, modelDifference{
+		Section:   "overall",
+		Key:       "size",
+		First:     sprintf(a.Config.Size),
+		Second:    sprintf(b.Config.Size),
+		SizeDelta: int64(b.Config.Size) - int64(a.Config.Size),
+	})
+	for _, fp := range fps {
+		switch {
+		case fp.a == nil && fp.b == nil:
+		case fp.a == nil:
+			mds = append(mds, modelDifference{
+				Section:   "overall",
+				File:      fp.name,
+				Key:       "file",
+				Change:    diffChangeAdded,
+				Second:    fp.b.CmdParameterValue,
+				SizeDelta: int64(fp.b.Size),
+			})
+		case fp.b == nil:
+			mds = append(mds, modelDifference{
+				Section:   "overall",
+				File:      fp.name,
+				Key:       "file",
+				Change:    diffChangeRemoved,
+				First:     fp.a.CmdParameterValue,
+				SizeDelta: -int64(fp.a.Size),
+			})
+		default:
+			for _, md := range []modelDifference{
+				{Key: "architecture", First: fp.a.Architecture, Second: fp.b.Architecture},
+				{Key: "parameters", First: sprintf(fp.a.Parameters), Second: sprintf(fp.b.Parameters)},
+				{Key: "bitsPerWeight", First: sprintf(fp.a.BitsPerWeight), Second: sprintf(fp.b.BitsPerWeight)},
+				{Key: "fileType", First: fp.a.FileType.String(), Second: fp.b.FileType.String()},
+				{Key: "size", First: sprintf(fp.a.Size), Second: sprintf(fp.b.Size), SizeDelta: int64(fp.b.Size) - int64(fp.a.Size)},
+			} {
+				md.Section, md.File = "overall", fp.name
+				mds = appendDifference(mds, md)
+			}
+		}
+	}
+
+	// Metadata.
+	for _, fp := range fps {
+		if fp.a == nil || fp.b == nil {
+			continue
+		}
+		ks := unionKeys(fp.a.Header.MetadataKV, fp.b.Header.MetadataKV, func(kv ggufparser.GGUFMetadataKV) string { return kv.Key })
+		akvs, _ := fp.a.Header.MetadataKV.Index(ks)
+		bkvs, _ := fp.b.Header.MetadataKV.Index(ks)
+		for _, k := range ks {
+			akv, aok := akvs[k]
+			bkv, bok := bkvs[k]
+			md := modelDifference{Section: "metadata", File: fp.name, Key: k, Change: getPresenceChange(aok, bok)}
+			if aok {
+				md.First = diffMetadataValue(akv)
+			}
+			if bok {
+				md.Second = diffMetadataValue(bkv)
+			}
+			mds = appendDifference(mds, md)
+		}
+	}
+
+	// Tensors.
+	for _, fp := range fps {
+		if fp.a == nil || fp.b == nil {
+			continue
+		}
+		ns := unionKeys(fp.a.TensorInfos, fp.b.TensorInfos, func(ti ggufparser.GGUFTensorInfo) string { return ti.Name })
+		atis, _ := fp.a.TensorInfos.Index(ns)
+		btis, _ := fp.b.TensorInfos.Index(ns)
+		for _, n := range ns {
+			ati, aok := atis[n]
+			bti, bok := btis[n]
+			md := modelDifference{Section: "tensor", File: fp.name, Key: n, Change: getPresenceChange(aok, bok)}
+			var as, bs uint64
+			if aok {
+				md.First, as = diffTensorValue(ati), ati.Bytes()
+			}
+			if bok {
+				md.Second, bs = diffTensorValue(bti), bti.Bytes()
+			}
+			md.SizeDelta = int64(bs) - int64(as)
+			mds = appendDifference(mds, md)
+		}
+	}
+
+	// CMD.
+	mds = appendDifference(mds, modelDifference{
+		Section: "cmd",
+		Key:     "cmd",
+		First:   strings.Join(a.Config.Cmd, " "),
+		Second:  strings.Join(b.Config.Cmd, " "),
+	})
+
+	// Labels.
+	{
+		var aks, bks []string
+		for k := range a.Config.Labels {
+			aks = append(aks, k)
+		}
+		for k := range b.Config.Labels {
+			bks = append(bks, k)
+		}
+		slices.Sort(aks)
+		slices.Sort(bks)
+		for _, k := range unionKeys(aks, bks, func(k string) string { return k }) {
+			av, aok := a.Config.Labels[k]
+			bv, bok := b.Config.Labels[k]
+			mds = appendDifference(mds, modelDifference{
+				Section: "label",
+				Key:     k,
+				Change:  getPresenceChange(aok, bok),
+				First:   av,
+				Second:  bv,
+			})
+		}
+	}
+
+	if mds == nil {
+		mds = []modelDifference{}
+	}
+	return mds
+}
+
+// appendDifference appends the given difference if the first and second values or sizes are different,
+// or the key is added or removed,
+// the change is determined by the presence of the values if not specified.
+func appendDifference(mds []modelDifference, md modelDifference) []modelDifference {
+	if md.First == md.Second && md.SizeDelta == 0 && md.Change != diffChangeAdded && md.Change != diffChangeRemoved {
+		return mds
+	}
+	if md.Change == "" {
+		switch {
+		case md.First == "":
+			md.Change = diffChangeAdded
+		case md.Second == "":
+			md.Change = diffChangeRemoved
+		default:
+			md.Change = diffChangeChanged
+		}
+	}
+	return append(mds, md)
+}
+
+// getPresenceChange returns the change of a key by its presence in the first and second models,
+// which is changed if present in both.
+func getPresenceChange(first, second bool) string {
+	switch {
+	case !first:
+		return diffChangeAdded
+	case !second:
+		return diffChangeRemoved
+	default:
+		return diffChangeChanged
+	}
+}
+
+// unionKeys returns the keys of the given two lists,
+// in the order of the first list, followed by the keys only in the second list.
+func unionKeys[T any](a, b []T, key func(T) string) []string {
+	ks := make([]string, 0, len(a))
+	seen := make(map[string]struct{}, len(a))
+	for _, l := range [][]T{a, b} {
+		for i := range l {
+			k := key(l[i])
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			ks = append(ks, k)
+		}
+	}
+	return ks
+}
+
+// diffMetadataValue returns the comparable string of the given metadata,
+// the array is summarized as its type, length and content digest, e.g. tokenizer.ggml.tokens.
+func diffMetadataValue(kv ggufparser.GGUFMetadataKV) string {
+	if kv.ValueType != ggufparser.GGUFMetadataValueTypeArray {
+		return fmt.Sprintf("%v", kv.Value)
+	}
+	av := kv.ValueArray()
+	s := fmt.Sprintf("[%s] len %d", av.Type, av.Len)
+	if len(av.Array) != 0 {
+		bs, err := json.Marshal(av.Array)
+		if err == nil {
+			h := sha256.Sum256(bs)
+			s += " sha256:" + hex.EncodeToString(h[:])[:12]
+		}
+	}
+	return s
+}
+
+// diffTensorValue returns the comparable string of the given tensor,
+// which consists of the type, shape and size.
+func diffTensorValue(ti ggufparser.GGUFTensorInfo) string {
+	return fmt.Sprintf("%s %v %s", ti.Type, ti.Dimensions, ggufparser.GGUFBytesScalar(ti.Bytes()))
+}
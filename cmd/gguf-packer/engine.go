@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+
+	"github.com/gpustack/gguf-packer-go/util/osx"
+)
+
+// ContainerEngine runs the container of a Runtime,
+// which is selected by the --engine flag of run.
+type ContainerEngine interface {
+	// Name returns the name of the engine, which is also the executable binary.
+	Name() string
+	// DetectGPU returns the GPU kind supported by the engine on the host,
+	// see gpuKinds.
+	DetectGPU(ctx context.Context) string
+	// GPUArgs returns the arguments to expose the given GPU kind to the container.
+	GPUArgs(gpu string) []string
+}
+
+const (
+	gpuKindAuto      = "auto"
+	gpuKindNVIDIA    = "nvidia"
+	gpuKindNVIDIACDI = "nvidia-cdi"
+	gpuKindAMD       = "amd"
+	gpuKindNone      = "none"
+)
+
+// gpuKinds are the available GPU kinds,
+// nvidia means the NVIDIA container runtime, nvidia-cdi means the NVIDIA Container Device Interface.
+var gpuKinds = []string{gpuKindAuto, gpuKindNVIDIA, gpuKindNVIDIACDI, gpuKindAMD, gpuKindNone}
+
+// containerEngines are the available engines, in order of auto-detection.
+var containerEngines = []ContainerEngine{
+	dockerEngine{},
+	podmanEngine{},
+	nerdctlEngine{},
+}
+
+// getContainerEngine returns the engine of the given name,
+// or the first engine found in the PATH if the name is empty,
+// the first engine is returned if none is found.
+func getContainerEngine(name string) (ContainerEngine, error) {
+	if name == "" {
+		for _, e := range containerEngines {
+			if _, err := exec.LookPath(e.Name()); err == nil {
+				return e, nil
+			}
+		}
+		return containerEngines[0], nil
+	}
+	for _, e := range containerEngines {
+		if e.Name() == name {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown engine %q, select from %v", name, getContainerEngineNames())
+}
+
+func getContainerEngineNames() []string {
+	ns := make([]string, len(containerEngines))
+	for i := range containerEngines {
+		ns[i] = containerEngines[i].Name()
+	}
+	return ns
+}
+
+// getContainerGPUArgs returns the arguments of the given engine to expose the GPU kind,
+// the GPU kind is detected by the engine if auto.
+func getContainerGPUArgs(ctx context.Context, e ContainerEngine, gpu string) ([]string, error) {
+	switch gpu {
+	default:
+		return nil, fmt.Errorf("unknown GPU kind %q, select from %v", gpu, gpuKinds)
+	case gpuKindAuto:
+		gpu = e.DetectGPU(ctx)
+	case gpuKindNVIDIA, gpuKindNVIDIACDI, gpuKindAMD, gpuKindNone:
+	}
+	return e.GPUArgs(gpu), nil
+}
+
+// hasNVIDIACDISpec returns true if the NVIDIA CDI specification is generated,
+// see https://docs.nvidia.com/datacenter/cloud-native/container-toolkit/latest/cdi-support.html.
+func hasNVIDIACDISpec() bool {
+	for _, p := range []string{
+		"/etc/cdi/nvidia.yaml",
+		"/etc/cdi/nvidia.json",
+		"/var/run/cdi/nvidia.yaml",
+		"/var/run/cdi/nvidia.json",
+	} {
+		if osx.ExistsFile(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAMDKFD returns true if the AMD kernel fusion driver is present.
+func hasAMDKFD() bool {
+	return osx.ExistsDevice("/dev/kfd")
+}
+
+// defaultGPUArgs returns the general arguments to expose the given GPU kind.
+func defaultGPUArgs(gpu string) []string {
+	switch gpu {
+	case gpuKindNVIDIA:
+		return []string{"--gpus", "all"}
+	case gpuKindNVIDIACDI:
+		return []string{"--device", "nvidia.com/gpu=all"}
+	case gpuKindAMD:
+		return []string{"--device", "/dev/kfd", "--device", "/dev/dri", "--group-add", "video"}
+	}
+	return nil
+}
+
+// dockerEngine runs the container by Docker.
+type dockerEngine struct{}
+
+func (dockerEngine) Name() string {
+	return "docker"
+}
+
+func (dockerEngine) DetectGPU(ctx context.Context) string {
+	bs, err := exec.
+		CommandContext(ctx, "docker", "info", "--format", "json").
+		CombinedOutput()
+	if err == nil {
+		var r struct {
+			Runtimes map[string]any `json:"Runtimes"`
+		}
+		if json.Unmarshal(bs, &r) == nil {
+			if _, ok := r.Runtimes["nvidia"]; ok {
+				return gpuKindNVIDIA
+			}
+		}
+	}
+	switch {
+	case hasNVIDIACDISpec():
+		return gpuKindNVIDIACDI
+	case hasAMDKFD():
+		return gpuKindAMD
+	}
+	return gpuKindNone
+}
+
+func (dockerEngine) GPUArgs(gpu string) []string {
+	return defaultGPUArgs(gpu)
+}
+
+// podmanEngine runs the container by Podman,
+// which exposes the NVIDIA GPUs via CDI.
+type podmanEngine struct{}
+
+func (podmanEngine) Name() string {
+	return "podman"
+}
+
+func (podmanEngine) DetectGPU(ctx context.Context) string {
+	switch {
+	case hasNVIDIACDISpec():
+		return gpuKindNVIDIACDI
+	case hasAMDKFD():
+		return gpuKindAMD
+	}
+	return gpuKindNone
+}
+
+func (podmanEngine) GPUArgs(gpu string) []string {
+	if gpu == gpuKindNVIDIA {
+		gpu = gpuKindNVIDIACDI
+	}
+	return defaultGPUArgs(gpu)
+}
+
+// nerdctlEngine runs the container by nerdctl,
+// which is the Docker-compatible CLI of containerd.
+type nerdctlEngine struct{}
+
+func (nerdctlEngine) Name() string {
+	return "nerdctl"
+}
+
+func (nerdctlEngine) DetectGPU(ctx context.Context) string {
+	if _, err := exec.LookPath("nvidia-container-cli"); err == nil {
+		return gpuKindNVIDIA
+	}
+	switch {
+	case hasNVIDIACDISpec():
+		return gpuKindNVIDIACDI
+	case hasAMDKFD():
+		return gpuKindAMD
+	}
+	return gpuKindNone
+}
+
+func (nerdctlEngine) GPUArgs(gpu string) []string {
+	return defaultGPUArgs(gpu)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+// fakeContainerEngine is the given engine which detects the given GPU kind,
+// which simulates the host without probing the engine.
+type fakeContainerEngine struct {
+	ContainerEngine
+	gpu string
+}
+
+func (e fakeContainerEngine) DetectGPU(context.Context) string {
+	return e.gpu
+}
+
+func TestContainerGPUArgs(t *testing.T) {
+	var (
+		nvidia    = []string{"--gpus", "all"}
+		nvidiaCDI = []string{"--device", "nvidia.com/gpu=all"}
+		amd       = []string{"--device", "/dev/kfd", "--device", "/dev/dri", "--group-add", "video"}
+	)
+	testCases := []struct {
+		engine   ContainerEngine
+		gpu      string
+		detected string
+		expected []string
+	}{
+		{dockerEngine{}, gpuKindNVIDIA, "", nvidia},
+		{dockerEngine{}, gpuKindNVIDIACDI, "", nvidiaCDI},
+		{dockerEngine{}, gpuKindAMD, "", amd},
+		{dockerEngine{}, gpuKindNone, "", nil},
+		{dockerEngine{}, gpuKindAuto, gpuKindNVIDIA, nvidia},
+		{dockerEngine{}, gpuKindAuto, gpuKindNone, nil},
+		{podmanEngine{}, gpuKindNVIDIA, "", nvidiaCDI},
+		{podmanEngine{}, gpuKindNVIDIACDI, "", nvidiaCDI},
+		{podmanEngine{}, gpuKindAMD, "", amd},
+		{podmanEngine{}, gpuKindNone, "", nil},
+		{podmanEngine{}, gpuKindAuto, gpuKindNVIDIACDI, nvidiaCDI},
+		{podmanEngine{}, gpuKindAuto, gpuKindAMD, amd},
+		{nerdctlEngine{}, gpuKindNVIDIA, "", nvidia},
+		{nerdctlEngine{}, gpuKindNVIDIACDI, "", nvidiaCDI},
+		{nerdctlEngine{}, gpuKindAMD, "", amd},
+		{nerdctlEngine{}, gpuKindNone, "", nil},
+		{nerdctlEngine{}, gpuKindAuto, gpuKindNVIDIA, nvidia},
+		{nerdctlEngine{}, gpuKindAuto, gpuKindNone, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.engine.Name()+"/"+tc.gpu+"/"+tc.detected, func(t *testing.T) {
+			e := fakeContainerEngine{ContainerEngine: tc.engine, gpu: tc.detected}
+			actual, err := getContainerGPUArgs(context.Background(), e, tc.gpu)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(actual, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		if _, err := getContainerGPUArgs(context.Background(), dockerEngine{}, "intel"); err == nil {
+			t.Error("expected an error of unknown GPU kind")
+		}
+	})
+}
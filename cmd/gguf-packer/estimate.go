@@ -3,46 +3,39 @@ package main
 import (
 	"errors"
 	"fmt"
-	"net"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/google/go-containerregistry/pkg/crane"
 	"github.com/google/go-containerregistry/pkg/name"
+	specs "github.com/gpustack/gguf-packer-go/buildkit/frontend/specs/v1"
+	"github.com/gpustack/gguf-packer-go/llamacpp"
 	"github.com/gpustack/gguf-packer-go/util/ptr"
 	ggufparser "github.com/gpustack/gguf-parser-go"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func estimate(app string) *cobra.Command {
 	var (
 		insecure           bool
 		force              bool
-		ctxSize            = -1
-		logicalBatchSize   = 2048
-		physicalBatchSize  = 512
-		parallelSize       = 1
-		cacheKeyType       = "f16"
-		cacheValueType     = "f16"
-		noKVOffload        bool
-		flashAttention     bool
-		splitMode          = "layer"
-		tensorSplit        string
-		mainGPU            uint
-		rpcServers         string
-		platformFootprint  = "150,250"
-		noMMap             bool
+		ef                 = newEstimateFlags()
+		gsf                ggufSourceFlags
 		offloadLayers      = -1
 		offloadLayersDraft = -1
 		offloadLayersStep  uint64
-		deviceMetrics      []string
+		fit                bool
+		fitVRAMs           []string
+		fitRAM             string
 		inShort            bool
 		inJson             bool
 	)
 
 	c := &cobra.Command{
-		Use:   "estimate MODEL",
+		Use:   "estimate MODEL|FILE|URL",
 		Short: "Estimate the model memory usage.",
 		Example: sprintf(`  # Estimate the model memory usage
   %s estimate gpustack/qwen2:0.5b-instruct
@@ -53,11 +46,27 @@ func estimate(app string) *cobra.Command {
   # Estimate the model memory usage with overrided flags
   %[1]s estimate gpustack/qwen2:0.5b-instruct --gpu-layers 10 --flash-attention
 
+  # Estimate the model memory usage from a local GGUF file
+  %[1]s estimate ~/models/qwen2-0_5b-instruct-q4_k_m.gguf
+
+  # Estimate the model memory usage from a remote GGUF file, with a projector
+  %[1]s estimate https://huggingface.co/xtuner/llava-llama-3-8b-v1_1-gguf/resolve/main/llava-llama-3-8b-v1_1-int4.gguf \\
+    --mmproj https://huggingface.co/xtuner/llava-llama-3-8b-v1_1-gguf/resolve/main/llava-llama-3-8b-v1_1-mmproj-f16.gguf
+
   # Estimate the model memory usage step by step
-  %[1]s estimate gpustack/qwen2:0.5b-instruct --offload-layers-step 1`, app),
+  %[1]s estimate gpustack/qwen2:0.5b-instruct --offload-layers-step 1
+
+  # Find the best offload layers and context size for the given hardware
+  %[1]s estimate gpustack/qwen2:0.5b-instruct --fit --vram 24GiB,24GiB --ram 64GiB
+
+  # Estimate the model memory usage with the device profile
+  %[1]s estimate gpustack/qwen2:0.5b-instruct --profile a100x2 --fit`, app),
 		Args: cobra.ExactArgs(1),
 		RunE: func(c *cobra.Command, args []string) error {
 			model := args[0]
+			if inJson {
+				outputFormat = "json"
+			}
 
 			var cos crane.Options
 			{
@@ -70,260 +79,108 @@ func estimate(app string) *cobra.Command {
 				cos = crane.GetOptions(co...)
 			}
 
-			rf, err := name.NewTag(model, cos.Name...)
-			if err != nil {
-				return fmt.Errorf("parsing model reference %q: %w", model, err)
+			var (
+				cf  specs.Image
+				err error
+			)
+			if isGGUFSource(model) {
+				cf, err = retrieveConfigByGGUFSource(c.Context(), true, insecure, model, gsf)
+				if err != nil {
+					return err
+				}
+			} else {
+				rf, err := name.NewTag(model, cos.Name...)
+				if err != nil {
+					return fmt.Errorf("parsing model reference %q: %w", model, err)
+				}
+				cf, err = retrieveConfigByOCIReference(force, true, rf, cos.Remote...)
+				if err != nil {
+					return err
+				}
 			}
 
-			cf, err := retrieveConfigByOCIReference(force, rf, cos.Remote...)
+			// Retrieve args,
+			// the flags take precedence over the CMD, which takes precedence over the profile.
+			if err = ef.applyProfile(); err != nil {
+				return err
+			}
+			cargs, err := llamacpp.ParseArgs(cf.Config.Cmd)
+			if err != nil {
+				return fmt.Errorf("parsing model CMD: %w", err)
+			}
+			ef.withArgs(cargs)
+			if cargs.GPULayers != nil && !c.Flags().Changed("gpu-layers") {
+				offloadLayers = *cargs.GPULayers
+			}
+			if cargs.GPULayersDraft != nil && !c.Flags().Changed("gpu-layers-draft") {
+				offloadLayersDraft = *cargs.GPULayersDraft
+			}
+			eopts, err := ef.options()
 			if err != nil {
 				return err
 			}
 
-			// Retrieve args.
 			var (
-				eopts []ggufparser.LLaMACppRunEstimateOption
-
-				rawNoMMap             *bool
-				rawOffloadLayers      *int
-				rawOffloadLayersDraft *int
+				mmap                      = !ef.noMMap
+				platformRAM, platformVRAM = ef.platformFootprints()
 			)
-			for i, s, cmd := 0, len(cf.Config.Cmd), cf.Config.Cmd; i < s; i++ {
-				switch cmd[i] {
-				case "-c", "--ctx-size":
-					if i+1 >= s {
-						continue
-					}
-					i++
-					v, err := strconv.ParseInt(cmd[i], 10, 64)
-					if err != nil {
-						continue
-					}
-					eopts = append(eopts, ggufparser.WithContextSize(int32(v)))
-				case "-b", "--batch-size":
-					if i+1 >= s {
-						continue
-					}
-					i++
-					v, err := strconv.ParseInt(cmd[i], 10, 64)
-					if err != nil {
-						continue
-					}
-					eopts = append(eopts, ggufparser.WithLogicalBatchSize(int32(v)))
-				case "-ub", "--ubatch-size":
-					if i+1 >= s {
-						continue
-					}
-					i++
-					v, err := strconv.ParseInt(cmd[i], 10, 64)
-					if err != nil {
-						continue
-					}
-					eopts = append(eopts, ggufparser.WithPhysicalBatchSize(int32(v)))
-				case "-np", "--parallel":
-					if i+1 >= s {
-						continue
-					}
-					i++
-					v, err := strconv.ParseInt(cmd[i], 10, 64)
-					if err != nil {
-						continue
-					}
-					eopts = append(eopts, ggufparser.WithParallelSize(int32(v)))
-				case "-nkvo", "--no-kv-offload":
-					eopts = append(eopts, ggufparser.WithoutOffloadKVCache())
-				case "-ctk", "--cache-type-k":
-					if i+1 >= s {
-						continue
-					}
-					i++
-					eopts = append(eopts, ggufparser.WithCacheKeyType(toGGMLType(cmd[i])))
-				case "-ctv", "--cache-type-v":
-					if i+1 >= s {
-						continue
-					}
-					i++
-					eopts = append(eopts, ggufparser.WithCacheValueType(toGGMLType(cmd[i])))
-				case "-fa", "--flash-attn":
-					eopts = append(eopts, ggufparser.WithFlashAttention())
-				case "-ngl", "--gpu-layers":
-					if i+1 >= s {
-						continue
-					}
-					i++
-					v, err := strconv.ParseInt(cmd[i], 10, 64)
+
+			// Fit.
+			if fit {
+				fo := estimateFitOptions{
+					OffloadLayersDraft: offloadLayersDraft,
+					MMap:               mmap,
+					PlatformRAM:        platformRAM,
+					PlatformVRAM:       platformVRAM,
+					FlashAttention:     ef.flashAttention,
+					TensorSplit:        ef.tensorSplit != "",
+				}
+				if ef.dp != nil {
+					ram, vrams, err := ef.dp.resources()
 					if err != nil {
-						continue
-					}
-					rawOffloadLayers = ptr.To(int(v))
-				case "-ngld", "--gpu-layers-draft":
-					if i+1 >= s {
-						continue
+						return err
 					}
-					i++
-					v, err := strconv.ParseInt(cmd[i], 10, 64)
+					fo.RAM, fo.VRAMs = ram, vrams
+				}
+				if fitRAM != "" {
+					v, err := ggufparser.ParseGGUFBytesScalar(fitRAM)
 					if err != nil {
-						continue
+						return fmt.Errorf("--ram has invalid size: %w", err)
 					}
-					rawOffloadLayersDraft = ptr.To(int(v))
+					fo.RAM = &v
 				}
-			}
-
-			// Override.
-			if ctxSize > 0 {
-				eopts = append(eopts, ggufparser.WithContextSize(int32(ctxSize)))
-			}
-			if logicalBatchSize > 0 {
-				eopts = append(eopts, ggufparser.WithLogicalBatchSize(int32(logicalBatchSize)))
-			}
-			if physicalBatchSize > 0 {
-				if physicalBatchSize > logicalBatchSize {
-					return errors.New("--ubatch-size must be less than or equal to --batch-size")
+				if len(fitVRAMs) > 0 {
+					fo.VRAMs = nil
 				}
-				eopts = append(eopts, ggufparser.WithPhysicalBatchSize(int32(physicalBatchSize)))
-			}
-			if parallelSize > 0 {
-				eopts = append(eopts, ggufparser.WithParallelSize(int32(parallelSize)))
-			}
-			if cacheKeyType != "" {
-				eopts = append(eopts, ggufparser.WithCacheKeyType(toGGMLType(cacheKeyType)))
-			}
-			if cacheValueType != "" {
-				eopts = append(eopts, ggufparser.WithCacheValueType(toGGMLType(cacheValueType)))
-			}
-			if noKVOffload {
-				eopts = append(eopts, ggufparser.WithoutOffloadKVCache())
-			}
-			if flashAttention {
-				eopts = append(eopts, ggufparser.WithFlashAttention())
-			}
-			switch splitMode {
-			case "row":
-				eopts = append(eopts, ggufparser.WithSplitMode(ggufparser.LLaMACppSplitModeRow))
-			case "none":
-				eopts = append(eopts, ggufparser.WithSplitMode(ggufparser.LLaMACppSplitModeNone))
-			default:
-				eopts = append(eopts, ggufparser.WithSplitMode(ggufparser.LLaMACppSplitModeLayer))
-			}
-			if tensorSplit != "" {
-				tss := strings.Split(tensorSplit, ",")
-				var vs float64
-				vv := make([]float64, len(tss))
-				vf := make([]float64, len(tss))
-				for i, s := range tss {
-					v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+				for _, s := range fitVRAMs {
+					v, err := ggufparser.ParseGGUFBytesScalar(strings.TrimSpace(s))
 					if err != nil {
-						return errors.New("--tensor-split has invalid integer")
+						return fmt.Errorf("--vram has invalid size: %w", err)
 					}
-					vs += v
-					vv[i] = vs
+					fo.VRAMs = append(fo.VRAMs, v)
 				}
-				for i, v := range vv {
-					vf[i] = v / vs
+				if c.Flags().Changed("ctx-size") {
+					fo.ContextSizes = []uint64{uint64(ef.ctxSize)}
 				}
-				eopts = append(eopts, ggufparser.WithTensorSplitFraction(vf))
-				if mainGPU < uint(len(vv)) {
-					eopts = append(eopts, ggufparser.WithMainGPUIndex(int(mainGPU)))
-				} else {
-					return errors.New("--main-gpu must be less than item size of --tensor-split")
+				if c.Flags().Changed("parallel") {
+					fo.ParallelSizes = []int32{int32(ef.parallelSize)}
 				}
-				if rpcServers != "" {
-					rss := strings.Split(rpcServers, ",")
-					if len(rss) > len(tss) {
-						return errors.New("--rpc has more items than --tensor-split")
-					}
-					rpc := make([]string, len(rss))
-					for i, s := range rss {
-						s = strings.TrimSpace(s)
-						if _, _, err := net.SplitHostPort(s); err != nil {
-							return errors.New("--rpc has invalid host:port")
-						}
-						rpc[i] = s
-					}
-					eopts = append(eopts, ggufparser.WithRPCServers(rpc))
+				if c.Flags().Changed("cache-type-k") || c.Flags().Changed("cache-type-v") {
+					fo.CacheTypes = [][2]string{{ef.cacheKeyType, ef.cacheValueType}}
 				}
-			}
-			if dmss := deviceMetrics; len(dmss) > 0 {
-				dms := make([]ggufparser.LLaMACppRunDeviceMetric, len(dmss))
-				for i := range dmss {
-					ss := strings.Split(dmss[i], ";")
-					if len(ss) < 2 {
-						return errors.New("--device-metric has invalid format")
-					}
-					dms[i].FLOPS, err = ggufparser.ParseFLOPSScalar(strings.TrimSpace(ss[0]))
-					if err != nil {
-						return fmt.Errorf("--device-metric has invalid FLOPS: %w", err)
-					}
-					dms[i].UpBandwidth, err = ggufparser.ParseBytesPerSecondScalar(strings.TrimSpace(ss[1]))
-					if err != nil {
-						return fmt.Errorf("--device-metric has invalid Up Bandwidth: %w", err)
-					}
-					if len(ss) > 2 {
-						dms[i].DownBandwidth, err = ggufparser.ParseBytesPerSecondScalar(strings.TrimSpace(ss[2]))
-						if err != nil {
-							return fmt.Errorf("--device-metric has invalid Down Bandwidth: %w", err)
-						}
-					} else {
-						dms[i].DownBandwidth = dms[i].UpBandwidth
-					}
+				r, err := estimateFit(cf.Config, eopts, fo)
+				if err != nil {
+					return err
 				}
-				eopts = append(eopts, ggufparser.WithDeviceMetrics(dms))
-			}
-			if rawNoMMap != nil && !c.Flags().Changed("no-mmap") {
-				noMMap = *rawNoMMap
-			}
-			if rawOffloadLayers != nil && !c.Flags().Changed("gpu-layers") {
-				offloadLayers = *rawOffloadLayers
-			}
-			if rawOffloadLayersDraft != nil && !c.Flags().Changed("gpu-layers-draft") {
-				offloadLayersDraft = *rawOffloadLayersDraft
+				return render(c, r, estimateFitTable(r))
 			}
 
 			// Estimate.
-			if d := cf.Config.Drafter; d != nil {
-				dopts := eopts[:len(eopts):len(eopts)]
-				if offloadLayersDraft >= 0 {
-					dopts = append(dopts, ggufparser.WithOffloadLayers(uint64(offloadLayersDraft)))
-				}
-				de := d.EstimateLLaMACppRun(dopts...)
-				eopts = append(eopts, ggufparser.WithDrafter(&de))
-			}
-			if p := cf.Config.Projector; p != nil {
-				popts := eopts[:len(eopts):len(eopts)]
-				pe := p.EstimateLLaMACppRun(popts...)
-				eopts = append(eopts, ggufparser.WithProjector(&pe))
-			}
-			if len(cf.Config.Adapters) > 0 {
-				adps := make([]ggufparser.LLaMACppRunEstimate, len(cf.Config.Adapters))
-				aopts := eopts[:len(eopts):len(eopts)]
-				for i, adpgf := range cf.Config.Adapters {
-					ae := adpgf.EstimateLLaMACppRun(aopts...)
-					adps[i] = ae
-				}
-				eopts = append(eopts, ggufparser.WithAdapters(adps))
-			}
+			eopts = withEstimateAuxiliaries(cf.Config, eopts, offloadLayersDraft)
 			if offloadLayers >= 0 {
 				eopts = append(eopts, ggufparser.WithOffloadLayers(uint64(offloadLayers)))
 			}
 			e := cf.Config.Model.EstimateLLaMACppRun(eopts...)
-
-			var (
-				mmap                      = !noMMap
-				platformRAM, platformVRAM uint64
-			)
-			{
-				if platformFootprint != "" {
-					parts := strings.Split(platformFootprint, ",")
-					if len(parts) == 2 {
-						if v, err := strconv.ParseUint(parts[0], 10, 64); err == nil {
-							platformRAM = v * 1024 * 1024
-						}
-						if v, err := strconv.ParseUint(parts[1], 10, 64); err == nil {
-							platformVRAM = v * 1024 * 1024
-						}
-					}
-				}
-			}
 			es := e.Summarize(mmap, platformRAM, platformVRAM)
 			switch {
 			case offloadLayersStep > e.OffloadLayers:
@@ -352,17 +209,7 @@ func estimate(app string) *cobra.Command {
 				es.Items = esis
 			}
 
-			w := c.OutOrStdout()
-			if inJson {
-				jprint(w, es)
-				return nil
-			}
-
-			var (
-				hds [][]any
-				bds [][]any
-			)
-			{
+			return render(c, es, func() (hds, bds [][]any, border bool) {
 				hds = make([][]any, 2)
 				if !inShort {
 					hds[0] = []any{
@@ -414,7 +261,7 @@ func estimate(app string) *cobra.Command {
 							sprintf(es.Architecture),
 							sprintf(es.ContextSize),
 							sprintf("%d / %d", es.LogicalBatchSize, es.PhysicalBatchSize),
-							sprintf(tenary(flashAttention, tenary(es.FlashAttention, "Enabled", "Unsupported"), "Disabled")),
+							sprintf(tenary(ef.flashAttention, tenary(es.FlashAttention, "Enabled", "Unsupported"), "Disabled")),
 							sprintf(tenary(mmap, tenary(!es.NoMMap, "Enabled", "Unsupported"), "Disabled")),
 							sprintf(tenary(es.EmbeddingOnly, "Yes", "No")),
 							sprintf(tenary(es.Reranking, "Supported", "Unsupported")),
@@ -439,58 +286,589 @@ func estimate(app string) *cobra.Command {
 							sprintf(v.NonUMA))
 					}
 				}
-			}
-			tfprint(c.OutOrStdout(), true, hds, bds)
-
-			return nil
+				return hds, bds, true
+			})
 		},
 	}
-	c.Flags().BoolVar(&insecure, "insecure", insecure, "Allow model references to be fetched without TLS.")
+	c.Flags().BoolVar(&insecure, "insecure", insecure, "Allow model references or URLs to be fetched without TLS.")
 	c.Flags().BoolVar(&force, "force", force, "Always estimate the model from the registry.")
-	c.Flags().IntVar(&ctxSize, "ctx-size", ctxSize, "Specify the context size.")
-	c.Flags().IntVar(&logicalBatchSize, "batch-size", logicalBatchSize, "Specify the logical batch size.")
-	c.Flags().IntVar(&physicalBatchSize, "ubatch-size", physicalBatchSize, "Specify the physical batch size.")
-	c.Flags().IntVar(&parallelSize, "parallel", parallelSize, "Specify the parallel size.")
-	c.Flags().StringVar(&cacheKeyType, "cache-type-k", cacheKeyType, "Specify the cache key type.")
-	c.Flags().StringVar(&cacheValueType, "cache-type-v", cacheValueType, "Specify the cache value type.")
-	c.Flags().BoolVar(&noKVOffload, "no-kv-offload", noKVOffload, "Disable the key-value offload.")
-	c.Flags().BoolVar(&flashAttention, "flash-attn", flashAttention, "Enable the flash attention.")
-	c.Flags().StringVar(&splitMode, "split-mode", splitMode, "Specify the split mode, such as layer, row, none.")
-	c.Flags().StringVar(&tensorSplit, "tensor-split", tensorSplit, "Specify the tensor split fraction.")
-	c.Flags().UintVar(&mainGPU, "main-gpu", mainGPU, "Specify the main GPU index.")
-	c.Flags().StringVar(&rpcServers, "rpc", rpcServers, "Specify the RPC servers.")
-	c.Flags().StringVar(&platformFootprint, "platform-footprint", platformFootprint, "Specify the platform footprint(RAM,VRAM) in MiB.")
-	c.Flags().BoolVar(&noMMap, "no-mmap", noMMap, "Disable the memory mapping.")
+	ef.addFlags(c.Flags())
+	gsf.addFlags(c.Flags())
 	c.Flags().IntVar(&offloadLayers, "gpu-layers", offloadLayers, "Specify the offload layers.")
 	c.Flags().IntVar(&offloadLayersDraft, "gpu-layers-draft", offloadLayersDraft, "Specify the offload layers draft.")
 	c.Flags().Uint64Var(&offloadLayersStep, "gpu-layers-step", offloadLayersStep, "Specify the offload layers step.")
-	c.Flags().StringSliceVar(&deviceMetrics, "device-metric", deviceMetrics, "Specify the device metric, in form of \"FLOPS;Up Bandwidth[;Down Bandwidth]\". "+
-		"The FLOPS unit, select from [PFLOPS, TFLOPS, GFLOPS, MFLOPS, KFLOPS]. "+
-		"The Up/Down Bandwidth unit, select from [PiBps, TiBps, GiBps, MiBps, KiBps, PBps, TBps, GBps, MBps, KBps, Pbps, Tbps, Gbps, Mbps, Kbps].")
+	c.Flags().BoolVar(&fit, "fit", fit, "Search the best offload layers, context size, parallel size and cache types, "+
+		"which fit the given --vram and --ram, or the devices of --profile.")
+	c.Flags().StringSliceVar(&fitVRAMs, "vram", fitVRAMs, "Specify the VRAM size of each device for --fit, e.g. 24GiB,24GiB.")
+	c.Flags().StringVar(&fitRAM, "ram", fitRAM, "Specify the RAM size for --fit, e.g. 64GiB, unlimited if not specified.")
 	c.Flags().BoolVar(&inShort, "in-short", inShort, "Output as short format.")
 	c.Flags().BoolVar(&inJson, "json", inJson, "Output as JSON.")
+	_ = c.Flags().MarkDeprecated("json", "use --format json instead")
 	return c
 }
 
-func toGGMLType(s string) ggufparser.GGMLType {
-	t := ggufparser.GGMLTypeF16
-	switch s {
-	case "f32":
-		t = ggufparser.GGMLTypeF32
-	case "f16":
-		t = ggufparser.GGMLTypeF16
-	case "q8_0":
-		t = ggufparser.GGMLTypeQ8_0
-	case "q4_0":
-		t = ggufparser.GGMLTypeQ4_0
-	case "q4_1":
-		t = ggufparser.GGMLTypeQ4_1
-	case "iq4_nl":
-		t = ggufparser.GGMLTypeIQ4_NL
-	case "q5_0":
-		t = ggufparser.GGMLTypeQ5_0
-	case "q5_1":
-		t = ggufparser.GGMLTypeQ5_1
-	}
-	return t
+// estimateFlags holds the flags to estimate the model memory usage,
+// which are shared by the commands estimating models.
+type estimateFlags struct {
+	ctxSize           int
+	logicalBatchSize  int
+	physicalBatchSize int
+	parallelSize      int
+	cacheKeyType      string
+	cacheValueType    string
+	noKVOffload       bool
+	flashAttention    bool
+	splitMode         string
+	tensorSplit       string
+	mainGPU           uint
+	rpcServers        string
+	platformFootprint string
+	noMMap            bool
+	embedding         bool
+	reranking         bool
+	deviceMetrics     []string
+	profile           string
+
+	fs *pflag.FlagSet
+	dp *deviceProfile
+}
+
+func newEstimateFlags() estimateFlags {
+	return estimateFlags{
+		ctxSize:           -1,
+		logicalBatchSize:  2048,
+		physicalBatchSize: 512,
+		parallelSize:      1,
+		cacheKeyType:      "f16",
+		cacheValueType:    "f16",
+		splitMode:         "layer",
+		platformFootprint: "150,250",
+	}
+}
+
+func (f *estimateFlags) addFlags(fs *pflag.FlagSet) {
+	f.fs = fs
+	fs.IntVar(&f.ctxSize, "ctx-size", f.ctxSize, "Specify the context size.")
+	fs.IntVar(&f.logicalBatchSize, "batch-size", f.logicalBatchSize, "Specify the logical batch size.")
+	fs.IntVar(&f.physicalBatchSize, "ubatch-size", f.physicalBatchSize, "Specify the physical batch size.")
+	fs.IntVar(&f.parallelSize, "parallel", f.parallelSize, "Specify the parallel size.")
+	fs.StringVar(&f.cacheKeyType, "cache-type-k", f.cacheKeyType, "Specify the cache key type.")
+	fs.StringVar(&f.cacheValueType, "cache-type-v", f.cacheValueType, "Specify the cache value type.")
+	fs.BoolVar(&f.noKVOffload, "no-kv-offload", f.noKVOffload, "Disable the key-value offload.")
+	fs.BoolVar(&f.flashAttention, "flash-attn", f.flashAttention, "Enable the flash attention.")
+	fs.StringVar(&f.splitMode, "split-mode", f.splitMode, "Specify the split mode, such as layer, row, none.")
+	fs.StringVar(&f.tensorSplit, "tensor-split", f.tensorSplit, "Specify the tensor split fraction.")
+	fs.UintVar(&f.mainGPU, "main-gpu", f.mainGPU, "Specify the main GPU index.")
+	fs.StringVar(&f.rpcServers, "rpc", f.rpcServers, "Specify the RPC servers.")
+	fs.StringVar(&f.platformFootprint, "platform-footprint", f.platformFootprint, "Specify the platform footprint(RAM,VRAM) in MiB.")
+	fs.BoolVar(&f.noMMap, "no-mmap", f.noMMap, "Disable the memory mapping.")
+	fs.BoolVar(&f.embedding, "embedding", f.embedding, "Enable the embedding.")
+	fs.BoolVar(&f.reranking, "reranking", f.reranking, "Enable the reranking.")
+	fs.StringSliceVar(&f.deviceMetrics, "device-metric", f.deviceMetrics, "Specify the device metric, in form of \"FLOPS;Up Bandwidth[;Down Bandwidth]\". "+
+		"The FLOPS unit, select from [PFLOPS, TFLOPS, GFLOPS, MFLOPS, KFLOPS]. "+
+		"The Up/Down Bandwidth unit, select from [PiBps, TiBps, GiBps, MiBps, KiBps, PBps, TBps, GBps, MBps, KBps, Pbps, Tbps, Gbps, Mbps, Kbps].")
+	fs.StringVar(&f.profile, "profile", f.profile, "Specify the device profile to fill the --tensor-split, --rpc, --device-metric and --platform-footprint, "+
+		"see \"devices\" command.")
+}
+
+// applyProfile fills the device related flags from the device profile,
+// the flags specified explicitly take precedence.
+func (f *estimateFlags) applyProfile() error {
+	if f.profile == "" || f.dp != nil {
+		return nil
+	}
+	dp, err := getDeviceProfile(f.profile)
+	if err != nil {
+		return err
+	}
+	f.dp = &dp
+
+	changed := func(name string) bool {
+		return f.fs != nil && f.fs.Changed(name)
+	}
+	if !changed("tensor-split") {
+		if f.tensorSplit, err = dp.tensorSplit(); err != nil {
+			return err
+		}
+	}
+	if !changed("rpc") {
+		f.rpcServers = dp.rpcServers()
+	}
+	if !changed("device-metric") {
+		if dms := dp.deviceMetrics(); len(dms) > 0 {
+			f.deviceMetrics = dms
+		}
+	}
+	if !changed("platform-footprint") && dp.PlatformFootprint != "" {
+		f.platformFootprint = dp.PlatformFootprint
+	}
+	return nil
+}
+
+// args returns the llama.cpp arguments of the flags.
+func (f *estimateFlags) args() (a llamacpp.Args, err error) {
+	if f.ctxSize > 0 {
+		a.ContextSize = ptr.To(int32(f.ctxSize))
+	}
+	if f.logicalBatchSize > 0 {
+		a.BatchSize = ptr.To(int32(f.logicalBatchSize))
+	}
+	if f.physicalBatchSize > 0 {
+		if f.physicalBatchSize > f.logicalBatchSize {
+			return a, errors.New("--ubatch-size must be less than or equal to --batch-size")
+		}
+		a.UBatchSize = ptr.To(int32(f.physicalBatchSize))
+	}
+	if f.parallelSize > 0 {
+		a.Parallel = ptr.To(int32(f.parallelSize))
+	}
+	if f.cacheKeyType != "" {
+		t, err := llamacpp.ParseGGMLType(f.cacheKeyType)
+		if err != nil {
+			return a, fmt.Errorf("--cache-type-k: %w", err)
+		}
+		a.CacheTypeK = &t
+	}
+	if f.cacheValueType != "" {
+		t, err := llamacpp.ParseGGMLType(f.cacheValueType)
+		if err != nil {
+			return a, fmt.Errorf("--cache-type-v: %w", err)
+		}
+		a.CacheTypeV = &t
+	}
+	a.NoKVOffload = f.noKVOffload
+	a.FlashAttention = f.flashAttention
+	a.NoMMap = f.noMMap
+	a.Embedding = f.embedding
+	a.Reranking = f.reranking
+	if f.splitMode != "" {
+		m, err := llamacpp.ParseSplitMode(f.splitMode)
+		if err != nil {
+			return a, fmt.Errorf("--split-mode: %w", err)
+		}
+		a.SplitMode = &m
+	}
+	if f.tensorSplit != "" {
+		if a.TensorSplit, err = llamacpp.ParseTensorSplit(f.tensorSplit); err != nil {
+			return a, fmt.Errorf("--tensor-split: %w", err)
+		}
+		a.MainGPU = ptr.To(int(f.mainGPU))
+	}
+	if f.rpcServers != "" {
+		if a.RPCServers, err = llamacpp.ParseRPCServers(f.rpcServers); err != nil {
+			return a, fmt.Errorf("--rpc: %w", err)
+		}
+	}
+	return a, nil
+}
+
+// withArgs fills the flags from the given llama.cpp arguments, e.g. the CMD of the model,
+// the flags specified explicitly take precedence.
+func (f *estimateFlags) withArgs(a llamacpp.Args) {
+	changed := func(name string) bool {
+		return f.fs != nil && f.fs.Changed(name)
+	}
+	if a.ContextSize != nil && !changed("ctx-size") {
+		f.ctxSize = int(*a.ContextSize)
+	}
+	if a.BatchSize != nil && !changed("batch-size") {
+		f.logicalBatchSize = int(*a.BatchSize)
+	}
+	if a.UBatchSize != nil && !changed("ubatch-size") {
+		f.physicalBatchSize = int(*a.UBatchSize)
+	}
+	if a.Parallel != nil && !changed("parallel") {
+		f.parallelSize = int(*a.Parallel)
+	}
+	if a.CacheTypeK != nil && !changed("cache-type-k") {
+		f.cacheKeyType = strings.ToLower(a.CacheTypeK.String())
+	}
+	if a.CacheTypeV != nil && !changed("cache-type-v") {
+		f.cacheValueType = strings.ToLower(a.CacheTypeV.String())
+	}
+	if a.NoKVOffload && !changed("no-kv-offload") {
+		f.noKVOffload = true
+	}
+	if a.FlashAttention && !changed("flash-attn") {
+		f.flashAttention = true
+	}
+	if a.NoMMap && !changed("no-mmap") {
+		f.noMMap = true
+	}
+	if a.Embedding && !changed("embedding") {
+		f.embedding = true
+	}
+	if a.Reranking && !changed("reranking") {
+		f.reranking = true
+	}
+	if a.SplitMode != nil && !changed("split-mode") {
+		f.splitMode = [...]string{"layer", "row", "none"}[*a.SplitMode]
+	}
+	if len(a.TensorSplit) != 0 && !changed("tensor-split") {
+		ts := make([]string, len(a.TensorSplit))
+		for i := range a.TensorSplit {
+			ts[i] = strconv.FormatFloat(a.TensorSplit[i], 'f', -1, 64)
+		}
+		f.tensorSplit = strings.Join(ts, ",")
+	}
+	if a.MainGPU != nil && !changed("main-gpu") {
+		f.mainGPU = uint(*a.MainGPU)
+	}
+	if len(a.RPCServers) != 0 && !changed("rpc") {
+		f.rpcServers = strings.Join(a.RPCServers, ",")
+	}
+}
+
+// options returns the estimate options of the flags.
+func (f *estimateFlags) options() (eopts []ggufparser.LLaMACppRunEstimateOption, err error) {
+	if err = f.applyProfile(); err != nil {
+		return nil, err
+	}
+	a, err := f.args()
+	if err != nil {
+		return nil, err
+	}
+	if eopts, err = a.EstimateOptions(); err != nil {
+		return nil, err
+	}
+	if dmss := f.deviceMetrics; len(dmss) > 0 {
+		dms := make([]ggufparser.LLaMACppRunDeviceMetric, len(dmss))
+		for i := range dmss {
+			ss := strings.Split(dmss[i], ";")
+			if len(ss) < 2 {
+				return nil, errors.New("--device-metric has invalid format")
+			}
+			dms[i].FLOPS, err = ggufparser.ParseFLOPSScalar(strings.TrimSpace(ss[0]))
+			if err != nil {
+				return nil, fmt.Errorf("--device-metric has invalid FLOPS: %w", err)
+			}
+			dms[i].UpBandwidth, err = ggufparser.ParseBytesPerSecondScalar(strings.TrimSpace(ss[1]))
+			if err != nil {
+				return nil, fmt.Errorf("--device-metric has invalid Up Bandwidth: %w", err)
+			}
+			if len(ss) > 2 {
+				dms[i].DownBandwidth, err = ggufparser.ParseBytesPerSecondScalar(strings.TrimSpace(ss[2]))
+				if err != nil {
+					return nil, fmt.Errorf("--device-metric has invalid Down Bandwidth: %w", err)
+				}
+			} else {
+				dms[i].DownBandwidth = dms[i].UpBandwidth
+			}
+		}
+		eopts = append(eopts, ggufparser.WithDeviceMetrics(dms))
+	}
+	return eopts, nil
+}
+
+// platformFootprints returns the platform footprint of RAM and VRAM in bytes.
+func (f *estimateFlags) platformFootprints() (ram, vram uint64) {
+	if f.platformFootprint == "" {
+		return 0, 0
+	}
+	parts := strings.Split(f.platformFootprint, ",")
+	if len(parts) != 2 {
+		return 0, 0
+	}
+	if v, err := strconv.ParseUint(parts[0], 10, 64); err == nil {
+		ram = v * 1024 * 1024
+	}
+	if v, err := strconv.ParseUint(parts[1], 10, 64); err == nil {
+		vram = v * 1024 * 1024
+	}
+	return ram, vram
+}
+
+// withEstimateAuxiliaries estimates the drafter, projector and adapters of the given config,
+// and returns the options to estimate the model with them.
+func withEstimateAuxiliaries(cfg specs.ImageConfig, eopts []ggufparser.LLaMACppRunEstimateOption, offloadLayersDraft int) []ggufparser.LLaMACppRunEstimateOption {
+	eopts = eopts[:len(eopts):len(eopts)]
+	if d := cfg.Drafter; d != nil {
+		dopts := eopts[:len(eopts):len(eopts)]
+		if offloadLayersDraft >= 0 {
+			dopts = append(dopts, ggufparser.WithOffloadLayers(uint64(offloadLayersDraft)))
+		}
+		de := d.EstimateLLaMACppRun(dopts...)
+		eopts = append(eopts, ggufparser.WithDrafter(&de))
+	}
+	if p := cfg.Projector; p != nil {
+		popts := eopts[:len(eopts):len(eopts)]
+		pe := p.EstimateLLaMACppRun(popts...)
+		eopts = append(eopts, ggufparser.WithProjector(&pe))
+	}
+	if len(cfg.Adapters) > 0 {
+		adps := make([]ggufparser.LLaMACppRunEstimate, len(cfg.Adapters))
+		aopts := eopts[:len(eopts):len(eopts)]
+		for i, adpgf := range cfg.Adapters {
+			ae := adpgf.EstimateLLaMACppRun(aopts...)
+			adps[i] = ae
+		}
+		eopts = append(eopts, ggufparser.WithAdapters(adps))
+	}
+	return eopts
+}
+
+type (
+	// estimateFitOptions holds the options of searching the best fit.
+	estimateFitOptions struct {
+		OffloadLayersDraft int
+		MMap               bool
+		PlatformRAM        uint64
+		PlatformVRAM       uint64
+		FlashAttention     bool
+		// TensorSplit indicates the tensor split is specified,
+		// otherwise, the tensor split is derived from VRAMs.
+		TensorSplit bool
+		// RAM is the available RAM, nil means unlimited.
+		RAM *ggufparser.GGUFBytesScalar
+		// VRAMs is the available VRAM of each device.
+		VRAMs []ggufparser.GGUFBytesScalar
+		// ContextSizes, ParallelSizes and CacheTypes are the candidates to search,
+		// derived from the model if empty.
+		ContextSizes  []uint64
+		ParallelSizes []int32
+		CacheTypes    [][2]string
+		// OffloadOnly searches the offload layers only,
+		// and keeps the context size, parallel size and cache types of the given options.
+		OffloadOnly bool
+	}
+
+	// estimateFitResult holds the result of the best fit.
+	estimateFitResult struct {
+		Flags          []string                              `json:"flags"`
+		OffloadLayers  uint64                                `json:"offloadLayers"`
+		ContextSize    uint64                                `json:"contextSize"`
+		ParallelSize   int32                                 `json:"parallelSize"`
+		CacheKeyType   string                                `json:"cacheKeyType"`
+		CacheValueType string                                `json:"cacheValueType"`
+		FlashAttention bool                                  `json:"flashAttention"`
+		Estimate       ggufparser.LLaMACppRunEstimateSummary `json:"estimate"`
+	}
+)
+
+// estimateFit searches the combination of offload layers, context size, parallel size and cache types,
+// which fits the given hardware, and prefers more offload layers, larger context size,
+// higher precision cache types and more parallel slots in order.
+func estimateFit(cfg specs.ImageConfig, eopts []ggufparser.LLaMACppRunEstimateOption, fo estimateFitOptions) (*estimateFitResult, error) {
+	if fo.RAM == nil && len(fo.VRAMs) == 0 {
+		return nil, errors.New("--fit requires --vram or --ram")
+	}
+	eopts = eopts[:len(eopts):len(eopts)]
+
+	var ts []string
+	if !fo.TensorSplit && len(fo.VRAMs) > 1 {
+		var vs float64
+		vf := make([]float64, len(fo.VRAMs))
+		for i := range fo.VRAMs {
+			vs += float64(fo.VRAMs[i])
+			vf[i] = vs
+			ts = append(ts, strconv.FormatUint(uint64(fo.VRAMs[i]>>20), 10))
+		}
+		for i := range vf {
+			vf[i] /= vs
+		}
+		eopts = append(eopts, ggufparser.WithTensorSplitFraction(vf))
+	}
+
+	// Derive candidates.
+	if fo.OffloadOnly {
+		// Placeholders, never applied.
+		fo.ContextSizes, fo.ParallelSizes, fo.CacheTypes = []uint64{0}, []int32{0}, [][2]string{{"", ""}}
+	}
+	if len(fo.ContextSizes) == 0 {
+		e := cfg.Model.EstimateLLaMACppRun(eopts...)
+		for cs := e.ContextSize; cs >= 512; {
+			fo.ContextSizes = append(fo.ContextSizes, cs)
+			// Round down to the previous power of two.
+			n := uint64(1)
+			for n<<1 < cs {
+				n <<= 1
+			}
+			cs = n
+		}
+		if len(fo.ContextSizes) == 0 {
+			fo.ContextSizes = []uint64{e.ContextSize}
+		}
+	}
+	if len(fo.ParallelSizes) == 0 {
+		fo.ParallelSizes = []int32{1, 2, 4, 8}
+	}
+	if len(fo.CacheTypes) == 0 {
+		// Quantized value cache requires flash attention.
+		if fo.FlashAttention {
+			fo.CacheTypes = [][2]string{{"f16", "f16"}, {"q8_0", "q8_0"}, {"q4_0", "q4_0"}}
+		} else {
+			fo.CacheTypes = [][2]string{{"f16", "f16"}, {"q8_0", "f16"}, {"q4_0", "f16"}}
+		}
+	}
+
+	fits := func(es ggufparser.LLaMACppRunEstimateSummaryItem, withRAM bool) bool {
+		if withRAM && fo.RAM != nil && es.RAM.NonUMA > *fo.RAM {
+			return false
+		}
+		if len(fo.VRAMs) == 0 {
+			// Without VRAMs, only zero offload is acceptable.
+			return es.OffloadLayers == 0
+		}
+		for i, v := range es.VRAMs {
+			if v.Remote {
+				continue
+			}
+			if i >= len(fo.VRAMs) || v.NonUMA > fo.VRAMs[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	type candidate struct {
+		ctx, pi, ci int
+		ok          bool
+		es          ggufparser.LLaMACppRunEstimateSummary
+	}
+	var cds []*candidate
+	for ctx := range fo.ContextSizes {
+		for ci := range fo.CacheTypes {
+			for pi := range fo.ParallelSizes {
+				cds = append(cds, &candidate{ctx: ctx, pi: pi, ci: ci})
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, cd := range cds {
+		wg.Add(1)
+		go func(cd *candidate) {
+			defer wg.Done()
+			copts := eopts[:len(eopts):len(eopts)]
+			if !fo.OffloadOnly {
+				ctk, _ := llamacpp.ParseGGMLType(fo.CacheTypes[cd.ci][0])
+				ctv, _ := llamacpp.ParseGGMLType(fo.CacheTypes[cd.ci][1])
+				copts = append(copts,
+					ggufparser.WithContextSize(int32(fo.ContextSizes[cd.ctx])),
+					ggufparser.WithParallelSize(fo.ParallelSizes[cd.pi]),
+					ggufparser.WithCacheKeyType(ctk),
+					ggufparser.WithCacheValueType(ctv))
+			}
+			copts = withEstimateAuxiliaries(cfg, copts, fo.OffloadLayersDraft)
+			est := func(ngl uint64) ggufparser.LLaMACppRunEstimateSummary {
+				return cfg.Model.EstimateLLaMACppRun(append(copts[:len(copts):len(copts)],
+					ggufparser.WithOffloadLayers(ngl))...).Summarize(fo.MMap, fo.PlatformRAM, fo.PlatformVRAM)
+			}
+
+			// VRAM usage grows with the offload layers, while RAM usage shrinks,
+			// so search the most offload layers fitting VRAM, then check RAM.
+			hi := est(math.MaxUint64).Items[0].OffloadLayers
+			lo := uint64(0)
+			if es := est(0); !fits(es.Items[0], false) {
+				return
+			}
+			for lo < hi {
+				mid := (lo + hi + 1) / 2
+				if fits(est(mid).Items[0], false) {
+					lo = mid
+				} else {
+					hi = mid - 1
+				}
+			}
+			es := est(lo)
+			if !fits(es.Items[0], true) {
+				return
+			}
+			cd.ok, cd.es = true, es
+		}(cd)
+	}
+	wg.Wait()
+
+	var b *candidate
+	for _, cd := range cds {
+		if !cd.ok {
+			continue
+		}
+		if b == nil {
+			b = cd
+			continue
+		}
+		switch {
+		case cd.es.Items[0].OffloadLayers != b.es.Items[0].OffloadLayers:
+			if cd.es.Items[0].OffloadLayers > b.es.Items[0].OffloadLayers {
+				b = cd
+			}
+		case cd.ctx != b.ctx:
+			if cd.ctx < b.ctx {
+				b = cd
+			}
+		case cd.ci != b.ci:
+			if cd.ci < b.ci {
+				b = cd
+			}
+		case cd.pi > b.pi:
+			b = cd
+		}
+	}
+	if b == nil {
+		return nil, errors.New("cannot fit the model into the given hardware")
+	}
+
+	r := &estimateFitResult{
+		OffloadLayers:  b.es.Items[0].OffloadLayers,
+		ContextSize:    fo.ContextSizes[b.ctx],
+		ParallelSize:   fo.ParallelSizes[b.pi],
+		CacheKeyType:   fo.CacheTypes[b.ci][0],
+		CacheValueType: fo.CacheTypes[b.ci][1],
+		FlashAttention: fo.FlashAttention && b.es.FlashAttention,
+		Estimate:       b.es,
+	}
+	r.Flags = []string{
+		"-ngl", strconv.FormatUint(r.OffloadLayers, 10),
+	}
+	if fo.OffloadOnly {
+		r.ContextSize = b.es.ContextSize
+	} else {
+		r.Flags = append(r.Flags,
+			"-c", strconv.FormatUint(r.ContextSize, 10),
+			"-np", strconv.FormatInt(int64(r.ParallelSize), 10),
+			"-ctk", r.CacheKeyType,
+			"-ctv", r.CacheValueType)
+		if r.FlashAttention {
+			r.Flags = append(r.Flags, "-fa")
+		}
+	}
+	if len(ts) != 0 {
+		r.Flags = append(r.Flags, "-ts", strings.Join(ts, ","))
+	}
+	return r, nil
+}
+
+// estimateFitTable returns the table renderer of the given fit result.
+func estimateFitTable(r *estimateFitResult) tableRenderer {
+	return func() (hds, bds [][]any, border bool) {
+		esi := r.Estimate.Items[0]
+		hds = [][]any{
+			{"Flags", "Offload Layers", "Context Size", "Parallel", "Cache Type (K / V)", "RAM", "RAM"},
+			{"Flags", "Offload Layers", "Context Size", "Parallel", "Cache Type (K / V)", "UMA", "NonUMA"},
+		}
+		bds = [][]any{
+			{
+				strings.Join(r.Flags, " "),
+				sprintf(tenary(esi.FullOffloaded, sprintf("%d (%d + 1)", esi.OffloadLayers, esi.OffloadLayers-1), esi.OffloadLayers)),
+				sprintf(r.ContextSize),
+				sprintf(r.ParallelSize),
+				sprintf("%s / %s", r.CacheKeyType, r.CacheValueType),
+				sprintf(esi.RAM.UMA),
+				sprintf(esi.RAM.NonUMA),
+			},
+		}
+		for _, v := range esi.VRAMs {
+			var hd string
+			if v.Remote {
+				hd = fmt.Sprintf("RPC %d (V)RAM", v.Position)
+			} else {
+				hd = fmt.Sprintf("VRAM %d", v.Position)
+			}
+			hds[0] = append(hds[0], hd, hd)
+			hds[1] = append(hds[1], "UMA", "NonUMA")
+			bds[0] = append(bds[0], sprintf(v.UMA), sprintf(v.NonUMA))
+		}
+		return hds, bds, true
+	}
 }
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// outputFormat is the global output format,
+// empty means the default format of each command.
+var outputFormat string
+
+const formatUsage = "Specify the output format, select from [table, json, yaml, csv, template=GOTEMPLATE], " +
+	"e.g. --format template='{{.Name}}'. " +
+	"The template is executed against each item of a list."
+
+type (
+	// tableRenderer returns the headers and bodies to render as table.
+	tableRenderer func() (headers, bodies [][]any, border bool)
+
+	// csvRenderer is implemented by the value, which prefers its own CSV records,
+	// otherwise, the CSV records are flattened from the JSON representation.
+	csvRenderer interface {
+		csvRecords() (header []string, records [][]string)
+	}
+)
+
+// render writes the given value to the output of the given command in the output format,
+// the given table renderer is used for the table format and the default format,
+// JSON is the default format if the table renderer is nil.
+func render(c *cobra.Command, v any, tr tableRenderer) error {
+	w := c.OutOrStdout()
+	f, arg, _ := strings.Cut(outputFormat, "=")
+	switch f {
+	case "", "table":
+		if tr == nil {
+			if f == "" {
+				return renderJSON(w, v)
+			}
+			return fmt.Errorf("--format table is not supported by %s", c.Name())
+		}
+		hds, bds, border := tr()
+		renderTable(w, border, hds, bds)
+		return nil
+	case "json":
+		return renderJSON(w, v)
+	case "yaml":
+		return renderYAML(w, v)
+	case "csv":
+		return renderCSV(w, v)
+	case "template":
+		if arg == "" {
+			return errors.New("--format template requires a template, e.g. template='{{.Name}}'")
+		}
+		return renderTemplate(w, arg, v)
+	}
+	return fmt.Errorf("invalid --format %q", outputFormat)
+}
+
+func renderTable(w io.Writer, border bool, headers, bodies [][]any) {
+	tw := table.NewWriter()
+	tw.SetOutputMirror(w)
+	for i := range headers {
+		tw.AppendHeader(headers[i], table.RowConfig{AutoMerge: true, AutoMergeAlign: text.AlignCenter})
+	}
+	for i := range bodies {
+		tw.AppendRow(bodies[i])
+	}
+	tw.SetColumnConfigs(func() (r []table.ColumnConfig) {
+		r = make([]table.ColumnConfig, len(headers[0]))
+		for i := range r {
+			r[i].Number = i + 1
+			r[i].AutoMerge = border
+			if len(headers) > 1 && (strings.HasPrefix(headers[1][i].(string), "Layers") || headers[1][i] == "UMA" || headers[1][i] == "NonUMA") {
+				r[i].AutoMerge = false
+			}
+			r[i].Align = text.AlignCenter
+			if !border {
+				r[i].Align = text.AlignLeft
+			}
+			r[i].AlignHeader = text.AlignCenter
+		}
+		return r
+	}())
+	{
+		tw.Style().Options.DrawBorder = border
+		tw.Style().Options.SeparateHeader = border
+		tw.Style().Options.SeparateFooter = border
+		tw.Style().Options.SeparateColumns = border
+		tw.Style().Options.SeparateRows = border
+	}
+	tw.Render()
+}
+
+func renderJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// renderYAML writes the value as YAML,
+// which keeps the field names and orders of the JSON representation.
+func renderYAML(w io.Writer, v any) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshalling JSON: %w", err)
+	}
+	var n yaml.Node
+	if err = yaml.Unmarshal(bs, &n); err != nil {
+		return fmt.Errorf("converting JSON to YAML: %w", err)
+	}
+	var resetStyle func(n *yaml.Node)
+	resetStyle = func(n *yaml.Node) {
+		n.Style = 0
+		for i := range n.Content {
+			resetStyle(n.Content[i])
+		}
+	}
+	resetStyle(&n)
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err = enc.Encode(&n); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// renderCSV writes the value as CSV,
+// each item of a list is a record, the nested fields are flattened with dot,
+// e.g. estimate.items.0.ram.uma.
+func renderCSV(w io.Writer, v any) error {
+	var (
+		hd  []string
+		rcs [][]string
+	)
+	if cr, ok := v.(csvRenderer); ok {
+		hd, rcs = cr.csvRecords()
+	} else {
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("marshalling JSON: %w", err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(bs))
+		dec.UseNumber()
+		var jv any
+		if err = dec.Decode(&jv); err != nil {
+			return fmt.Errorf("unmarshalling JSON: %w", err)
+		}
+		items, ok := jv.([]any)
+		if !ok {
+			items = []any{jv}
+		}
+		var (
+			fms  = make([]map[string]string, len(items))
+			seen = map[string]struct{}{}
+		)
+		for i := range items {
+			fms[i] = map[string]string{}
+			flattenJSON("", items[i], fms[i])
+			var ks []string
+			for k := range fms[i] {
+				if _, ok := seen[k]; !ok {
+					seen[k] = struct{}{}
+					ks = append(ks, k)
+				}
+			}
+			sort.Strings(ks)
+			hd = append(hd, ks...)
+		}
+		rcs = make([][]string, len(fms))
+		for i := range fms {
+			rcs[i] = make([]string, len(hd))
+			for j := range hd {
+				rcs[i][j] = fms[i][hd[j]]
+			}
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(hd); err != nil {
+		return fmt.Errorf("writing CSV header: %w", err)
+	}
+	if err := cw.WriteAll(rcs); err != nil {
+		return fmt.Errorf("writing CSV records: %w", err)
+	}
+	return nil
+}
+
+func flattenJSON(prefix string, v any, r map[string]string) {
+	join := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + "." + k
+	}
+	switch vv := v.(type) {
+	case map[string]any:
+		for k := range vv {
+			flattenJSON(join(k), vv[k], r)
+		}
+	case []any:
+		for i := range vv {
+			flattenJSON(join(strconv.Itoa(i)), vv[i], r)
+		}
+	case nil:
+		r[prefix] = ""
+	default:
+		r[prefix] = fmt.Sprint(vv)
+	}
+}
+
+// renderTemplate executes the given Go template against the value,
+// or each item if the value is a list.
+func renderTemplate(w io.Writer, tpl string, v any) error {
+	t, err := template.New("format").
+		Funcs(template.FuncMap{
+			"json": func(v any) (string, error) {
+				bs, err := json.Marshal(v)
+				return string(bs), err
+			},
+			"join":  strings.Join,
+			"lower": strings.ToLower,
+			"upper": strings.ToUpper,
+		}).
+		Parse(tpl)
+	if err != nil {
+		return fmt.Errorf("parsing template: %w", err)
+	}
+	exec := func(v any) error {
+		if err := t.Execute(w, v); err != nil {
+			return fmt.Errorf("executing template: %w", err)
+		}
+		_, err := fmt.Fprintln(w)
+		return err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return exec(v)
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if err = exec(rv.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isTableFormat returns true if the output format is table or default.
+func isTableFormat() bool {
+	return outputFormat == "" || outputFormat == "table"
+}
@@ -0,0 +1,609 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	specs "github.com/gpustack/gguf-packer-go/buildkit/frontend/specs/v1"
+	"github.com/gpustack/gguf-packer-go/llamacpp"
+	"github.com/gpustack/gguf-packer-go/util/osx"
+	"github.com/gpustack/gguf-packer-go/util/ptr"
+	ggufparser "github.com/gpustack/gguf-parser-go"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+func generate(app string) *cobra.Command {
+	c := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate the deployment manifests of a model.",
+		Example: sprintf(`  # Generate the Kubernetes manifests of a model
+  %s generate k8s gpustack/qwen2:0.5b-instruct
+
+  # Generate the Docker Compose file of a model
+  %[1]s generate compose gpustack/qwen2:0.5b-instruct
+
+  # Generate the systemd unit of a model
+  %[1]s generate systemd gpustack/qwen2:0.5b-instruct`, app),
+		Args: cobra.NoArgs,
+	}
+	c.AddCommand(generateK8s(app), generateCompose(app), generateSystemd(app))
+	return c
+}
+
+const (
+	// generateModelDir is the directory of the model files in the container.
+	generateModelDir = "/gp-model"
+	// generateRuntimeDir is the directory of the generated runtime files in the container.
+	generateRuntimeDir = "/gp-runtime"
+)
+
+// generateFlags holds the flags to generate the deployment manifests,
+// which are shared by the generate commands.
+type generateFlags struct {
+	insecure     bool
+	force        bool
+	name         string
+	runtime      string
+	runtimeImage string
+	gpus         int
+}
+
+func newGenerateFlags() generateFlags {
+	return generateFlags{
+		runtime: runtimes[0].Name(),
+	}
+}
+
+// addFlags adds the shared flags,
+// the --runtime-image is added if byContainer is true.
+func (f *generateFlags) addFlags(fs *pflag.FlagSet, byContainer bool) {
+	fs.BoolVar(&f.insecure, "insecure", f.insecure, "Allow model references to be fetched without TLS.")
+	fs.BoolVar(&f.force, "force", f.force, "Always retrieve the model from the registry.")
+	fs.StringVar(&f.name, "name", f.name, "Specify the name of the deployment, default is derived from the model.")
+	fs.StringVar(&f.runtime, "runtime", f.runtime, "Specify the runtime to map the model to its arguments, "+
+		"select from "+sprintf(getRuntimeNames())+".")
+	if byContainer {
+		fs.StringVar(&f.runtimeImage, "runtime-image", f.runtimeImage, "Specify the container image of the runtime, "+
+			"default is the container image of --runtime.")
+	}
+	fs.IntVar(&f.gpus, "gpus", f.gpus, "Specify the number of GPUs to offload the layers, zero means running on CPU.")
+}
+
+// generateModel holds the model to generate the deployment manifests.
+type generateModel struct {
+	// Reference is the full reference of the model, e.g. docker.io/gpustack/qwen2:0.5b-instruct.
+	Reference string
+	// Name is the DNS-1123 name of the deployment.
+	Name string
+	// Config is the inflated config of the model.
+	Config specs.Image
+	// LayersPath is the store path of the model files, only available if retrieved locally.
+	LayersPath string
+	// Args are the model name and the extra arguments, the --port is removed.
+	Args []string
+	// Runtime is the runtime.
+	Runtime Runtime
+	// Command is the command of the runtime.
+	Command runtimeCommand
+	// Port is the port listened by the runtime, which is given by --port or the runtime default,
+	// zero means the runtime does not serve.
+	Port int
+	// RAM is the estimated RAM usage.
+	RAM ggufparser.GGUFBytesScalar
+	// VRAM is the estimated VRAM usage of each GPU.
+	VRAM ggufparser.GGUFBytesScalar
+}
+
+// retrieve retrieves the given model and extracts the --port from the arguments,
+// the model is pulled into the store if local, otherwise, only the config is retrieved.
+func (f *generateFlags) retrieve(c *cobra.Command, app string, args []string, local bool) (gm generateModel, err error) {
+	model := args[0]
+
+	var cos crane.Options
+	{
+		co := []crane.Option{
+			getAuthnKeychainOption(),
+		}
+		if f.insecure {
+			co = append(co, crane.Insecure)
+		}
+		cos = crane.GetOptions(co...)
+	}
+
+	rf, err := name.NewTag(model, cos.Name...)
+	if err != nil {
+		return gm, fmt.Errorf("parsing model reference %q: %w", model, err)
+	}
+	gm.Reference = strings.Replace(rf.Name(), dockerRegPrefix, "docker.io/", 1)
+	gm.Name = f.name
+	if gm.Name == "" {
+		gm.Name = toDNS1123Name(path.Base(rf.RepositoryStr()) + "-" + rf.TagStr())
+	}
+	if gm.Args, gm.Port, err = extractPortArg(args); err != nil {
+		return gm, err
+	}
+	gm.Args[0] = strings.TrimPrefix(rf.Name(), dockerRegPrefix)
+
+	if local {
+		mdp := getModelMetadataStorePath(rf)
+		if f.force || !osx.ExistsLink(mdp) || isLazyModel(mdp) {
+			pc := pull(app)
+			_ = pc.Flags().Set("insecure", strconv.FormatBool(f.insecure))
+			_ = pc.Flags().Set("force", strconv.FormatBool(f.force))
+			if err = pc.RunE(c, []string{model}); err != nil {
+				return gm, err
+			}
+		}
+		cfp, err := os.Readlink(mdp)
+		if err != nil {
+			return gm, fmt.Errorf("reading link %s: %w", mdp, err)
+		}
+		gm.LayersPath = convertConfigStorePathToLayersStorePath(cfp)
+	}
+	gm.Config, err = retrieveConfigByOCIReference(f.force && !local, true, rf, cos.Remote...)
+	if err != nil {
+		return gm, err
+	}
+
+	gm.Runtime, err = getRuntime(f.runtime)
+	return gm, err
+}
+
+// applyProfile appends the arguments chosen by the given device profile,
+// which requires the model retrieved locally.
+func (gm *generateModel) applyProfile(profile string) error {
+	if profile == "" {
+		return nil
+	}
+	cmd := gm.Config.Config.Cmd
+	pargs, err := getDeviceProfileArgs(gm.Config, gm.LayersPath, profile, append(cmd[:len(cmd):len(cmd)], gm.Args[1:]...))
+	if err != nil {
+		return err
+	}
+	gm.Args = append(gm.Args, pargs...)
+	return nil
+}
+
+// image returns the container image of the given runtime.
+func (f *generateFlags) image(rt Runtime) (string, error) {
+	img := tenary(f.runtimeImage != "", f.runtimeImage, rt.Image()).(string)
+	if img == "" {
+		return "", fmt.Errorf("runtime %q has no container image, requires --runtime-image", rt.Name())
+	}
+	return img, nil
+}
+
+// command maps the retrieved model to the command of the runtime by the given input,
+// then estimates the memory usage,
+// the name, config, arguments and port of the input are filled by the model.
+func (f *generateFlags) command(gm *generateModel, in runtimeInput) (err error) {
+	in.Name, in.Config, in.Args, in.Port = gm.Args[0], gm.Config.Config, gm.Args[1:], gm.Port
+	gm.Command, err = gm.Runtime.Command(in)
+	if err != nil {
+		return err
+	}
+	if p := gm.Runtime.Port(); p != 0 {
+		gm.Port = tenary(gm.Port != 0, gm.Port, p).(int)
+	} else {
+		gm.Port = 0
+	}
+
+	cmd := gm.Config.Config.Cmd
+	gm.RAM, gm.VRAM, err = estimateGenerateModel(gm.Config.Config, append(cmd[:len(cmd):len(cmd)], gm.Args[1:]...), f.gpus)
+	return err
+}
+
+// estimateGenerateModel returns the RAM usage and the VRAM usage of each GPU,
+// the layers are offloaded evenly to the given number of GPUs unless specified by the arguments.
+func estimateGenerateModel(cfg specs.ImageConfig, args []string, gpus int) (ram, vram ggufparser.GGUFBytesScalar, err error) {
+	if cfg.Model == nil {
+		return 0, 0, errors.New("model has no model file")
+	}
+	a, err := llamacpp.ParseArgs(args)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing arguments: %w", err)
+	}
+	ef := newEstimateFlags()
+	ef.withArgs(a)
+	eopts, err := ef.options()
+	if err != nil {
+		return 0, 0, err
+	}
+	eopts = withEstimateAuxiliaries(cfg, eopts, ptr.From(a.GPULayersDraft, -1))
+	switch {
+	case gpus <= 0:
+		eopts = append(eopts, ggufparser.WithOffloadLayers(0))
+	case a.GPULayers != nil:
+		eopts = append(eopts, ggufparser.WithOffloadLayers(uint64(*a.GPULayers)))
+	}
+	if gpus > 1 && len(a.TensorSplit) == 0 {
+		ts := make([]float64, gpus)
+		for i := range ts {
+			ts[i] = float64(i+1) / float64(gpus)
+		}
+		eopts = append(eopts, ggufparser.WithTensorSplitFraction(ts))
+	}
+	pram, pvram := ef.platformFootprints()
+	es := cfg.Model.EstimateLLaMACppRun(eopts...).SummarizeItem(!ef.noMMap, pram, pvram)
+	ram = es.RAM.NonUMA
+	if gpus > 0 {
+		for _, v := range es.VRAMs {
+			if !v.Remote && v.NonUMA > vram {
+				vram = v.NonUMA
+			}
+		}
+	}
+	return ram, vram, nil
+}
+
+var dns1123Invalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// toDNS1123Name converts the given string to a DNS-1123 label, e.g. qwen2-0-5b-instruct.
+func toDNS1123Name(s string) string {
+	s = dns1123Invalid.ReplaceAllString(strings.ToLower(s), "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return strings.Trim(s, "-")
+}
+
+// toMebibytes returns the given size in Kubernetes quantity of mebibytes, rounded up.
+func toMebibytes(s ggufparser.GGUFBytesScalar) string {
+	return fmt.Sprintf("%dMi", (uint64(s)+1<<20-1)>>20)
+}
+
+// renderManifests writes the given objects as YAML documents,
+// or as a JSON array if --format json.
+func renderManifests(c *cobra.Command, objs []any) error {
+	switch outputFormat {
+	case "json":
+		return renderJSON(c.OutOrStdout(), objs)
+	case "", "yaml":
+	default:
+		return fmt.Errorf("--format %s is not supported by %s", outputFormat, c.Name())
+	}
+	enc := yaml.NewEncoder(c.OutOrStdout())
+	enc.SetIndent(2)
+	for _, o := range objs {
+		if err := enc.Encode(o); err != nil {
+			return fmt.Errorf("marshalling manifest: %w", err)
+		}
+	}
+	return enc.Close()
+}
+
+func generateK8s(app string) *cobra.Command {
+	var (
+		gf              = newGenerateFlags()
+		namespace       string
+		replicas        = 1
+		gpuResource     = "nvidia.com/gpu"
+		volumeSource    = "image"
+		initImage       = "docker.io/gpustack/gguf-packer:latest"
+		imagePullPolicy = "IfNotPresent"
+	)
+	c := &cobra.Command{
+		Use:   "k8s MODEL [ARG...]",
+		Short: "Generate the Kubernetes manifests of a model.",
+		Long: "Generate the Kubernetes Deployment and Service of a model, " +
+			"the model is mounted as an image volume, see KEP-4639 OCI VolumeSource, " +
+			"or copied by an init container for the clusters without image volume support. " +
+			"The memory request is estimated from the model and the arguments.",
+		Example: sprintf(`  # Generate the Kubernetes manifests of a model
+  %s generate k8s gpustack/qwen2:0.5b-instruct
+
+  # Generate the Kubernetes manifests of a model with 2 GPUs and customized arguments
+  %[1]s generate k8s gpustack/qwen2:0.5b-instruct --gpus 2 -- -c 8192 -np 4
+
+  # Generate the Kubernetes manifests for the clusters without image volume support
+  %[1]s generate k8s gpustack/qwen2:0.5b-instruct --volume-source init
+
+  # Generate and apply the Kubernetes manifests
+  %[1]s generate k8s gpustack/qwen2:0.5b-instruct | kubectl apply -f -`, app),
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			if volumeSource != "image" && volumeSource != "init" {
+				return fmt.Errorf("invalid --volume-source %q, select from [image, init]", volumeSource)
+			}
+
+			gm, err := gf.retrieve(c, app, args, false)
+			if err != nil {
+				return err
+			}
+			img, err := gf.image(gm.Runtime)
+			if err != nil {
+				return err
+			}
+			err = gf.command(&gm, runtimeInput{
+				Exec:   gm.Runtime.Binary(),
+				Dir:    generateModelDir,
+				GenDir: generateRuntimeDir,
+				Join:   path.Join,
+				Host:   "0.0.0.0",
+			})
+			if err != nil {
+				return err
+			}
+
+			labels := map[string]string{
+				"app.kubernetes.io/name":       gm.Name,
+				"app.kubernetes.io/managed-by": "gguf-packer",
+			}
+			meta := func(n string) k8sObjectMeta {
+				return k8sObjectMeta{Name: n, Namespace: namespace, Labels: labels}
+			}
+
+			var objs []any
+
+			// Model volume.
+			var (
+				volumes        []k8sVolume
+				initContainers []k8sContainer
+			)
+			switch volumeSource {
+			case "image":
+				volumes = append(volumes, k8sVolume{
+					Name: "model",
+					Image: &k8sImageVolumeSource{
+						Reference:  gm.Reference,
+						PullPolicy: imagePullPolicy,
+					},
+				})
+			case "init":
+				// Pull into the volume by gguf-packer, then move the model files to the root of the volume.
+				sp := path.Join(generateModelDir, ".gguf-packer")
+				volumes = append(volumes, k8sVolume{
+					Name:     "model",
+					EmptyDir: &struct{}{},
+				})
+				initContainers = append(initContainers, k8sContainer{
+					Name:    "model",
+					Image:   initImage,
+					Command: []string{"/bin/sh", "-c"},
+					Args: []string{
+						"/bin/gguf-packer pull " + shellQuote(gm.Reference) +
+							" && mv " + sp + "/models/layers/*/*/* " + generateModelDir + "/" +
+							" && rm -rf " + sp,
+					},
+					Env: []k8sEnvVar{
+						{Name: "GGUF_PACKER_STORE_PATH", Value: sp},
+					},
+					VolumeMounts: []k8sVolumeMount{
+						{Name: "model", MountPath: generateModelDir},
+					},
+				})
+			}
+			mounts := []k8sVolumeMount{
+				{Name: "model", MountPath: generateModelDir, ReadOnly: true},
+			}
+
+			// Runtime files.
+			if len(gm.Command.Files) != 0 {
+				cm := k8sConfigMap{
+					APIVersion: "v1",
+					Kind:       "ConfigMap",
+					Metadata:   meta(gm.Name + "-runtime"),
+					Data:       map[string]string{},
+				}
+				for n, bs := range gm.Command.Files {
+					cm.Data[n] = string(bs)
+				}
+				objs = append(objs, cm)
+				volumes = append(volumes, k8sVolume{
+					Name:      "runtime",
+					ConfigMap: &k8sConfigMapVolumeSource{Name: cm.Metadata.Name},
+				})
+				mounts = append(mounts, k8sVolumeMount{Name: "runtime", MountPath: generateRuntimeDir, ReadOnly: true})
+			}
+
+			ctr := k8sContainer{
+				Name:         "runtime",
+				Image:        img,
+				Args:         gm.Command.Args,
+				VolumeMounts: mounts,
+				Resources: &k8sResourceRequirements{
+					Requests: map[string]string{"memory": toMebibytes(gm.RAM)},
+				},
+			}
+			if gm.Command.Entrypoint != "" {
+				ctr.Command = []string{gm.Command.Entrypoint}
+			}
+			for _, e := range gm.Command.Env {
+				k, v, _ := strings.Cut(e, "=")
+				ctr.Env = append(ctr.Env, k8sEnvVar{Name: k, Value: v})
+			}
+			if gf.gpus > 0 {
+				ctr.Resources.Limits = map[string]string{gpuResource: sprintf(gf.gpus)}
+			}
+			if p := gm.Port; p != 0 {
+				ctr.Ports = []k8sContainerPort{{Name: "http", ContainerPort: p}}
+				if hp := gm.Runtime.HealthPath(); hp != "" {
+					ctr.ReadinessProbe = &k8sProbe{
+						HTTPGet:       &k8sHTTPGetAction{Path: hp, Port: "http"},
+						PeriodSeconds: 5,
+					}
+				}
+			}
+
+			dm := meta(gm.Name)
+			dm.Annotations = map[string]string{
+				"gguf-packer.gpustack.ai/model":          gm.Reference,
+				"gguf-packer.gpustack.ai/estimated-ram":  sprintf(gm.RAM),
+				"gguf-packer.gpustack.ai/estimated-vram": sprintf(gm.VRAM),
+			}
+			objs = append(objs, k8sDeployment{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Metadata:   dm,
+				Spec: k8sDeploymentSpec{
+					Replicas: replicas,
+					Selector: k8sLabelSelector{MatchLabels: labels},
+					Template: k8sPodTemplateSpec{
+						Metadata: k8sObjectMeta{Labels: labels},
+						Spec: k8sPodSpec{
+							InitContainers: initContainers,
+							Containers:     []k8sContainer{ctr},
+							Volumes:        volumes,
+						},
+					},
+				},
+			})
+
+			if p := gm.Port; p != 0 {
+				objs = append(objs, k8sService{
+					APIVersion: "v1",
+					Kind:       "Service",
+					Metadata:   meta(gm.Name),
+					Spec: k8sServiceSpec{
+						Selector: labels,
+						Ports:    []k8sServicePort{{Name: "http", Port: p, TargetPort: "http"}},
+					},
+				})
+			}
+
+			return renderManifests(c, objs)
+		},
+	}
+	gf.addFlags(c.Flags(), true)
+	c.Flags().StringVar(&namespace, "namespace", namespace, "Specify the namespace of the manifests.")
+	c.Flags().IntVar(&replicas, "replicas", replicas, "Specify the replicas of the deployment.")
+	c.Flags().StringVar(&gpuResource, "gpu-resource", gpuResource, "Specify the extended resource name of the GPU, e.g. amd.com/gpu.")
+	c.Flags().StringVar(&volumeSource, "volume-source", volumeSource, "Specify how to mount the model, select from [image, init], "+
+		"image mounts the model as an image volume, which requires Kubernetes 1.31+ with the ImageVolume feature gate, "+
+		"init copies the model by an init container of --init-image.")
+	c.Flags().StringVar(&initImage, "init-image", initImage, "Specify the container image of gguf-packer for --volume-source init.")
+	c.Flags().StringVar(&imagePullPolicy, "image-pull-policy", imagePullPolicy, "Specify the pull policy of the image volume.")
+	return c
+}
+
+// The minimal Kubernetes types to generate the manifests,
+// see https://kubernetes.io/docs/reference/kubernetes-api/.
+type (
+	k8sObjectMeta struct {
+		Name        string            `json:"name,omitempty" yaml:"name,omitempty"`
+		Namespace   string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+		Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+		Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	}
+
+	k8sConfigMap struct {
+		APIVersion string            `json:"apiVersion" yaml:"apiVersion"`
+		Kind       string            `json:"kind" yaml:"kind"`
+		Metadata   k8sObjectMeta     `json:"metadata" yaml:"metadata"`
+		Data       map[string]string `json:"data" yaml:"data"`
+	}
+
+	k8sDeployment struct {
+		APIVersion string            `json:"apiVersion" yaml:"apiVersion"`
+		Kind       string            `json:"kind" yaml:"kind"`
+		Metadata   k8sObjectMeta     `json:"metadata" yaml:"metadata"`
+		Spec       k8sDeploymentSpec `json:"spec" yaml:"spec"`
+	}
+
+	k8sDeploymentSpec struct {
+		Replicas int                `json:"replicas" yaml:"replicas"`
+		Selector k8sLabelSelector   `json:"selector" yaml:"selector"`
+		Template k8sPodTemplateSpec `json:"template" yaml:"template"`
+	}
+
+	k8sLabelSelector struct {
+		MatchLabels map[string]string `json:"matchLabels" yaml:"matchLabels"`
+	}
+
+	k8sPodTemplateSpec struct {
+		Metadata k8sObjectMeta `json:"metadata" yaml:"metadata"`
+		Spec     k8sPodSpec    `json:"spec" yaml:"spec"`
+	}
+
+	k8sPodSpec struct {
+		InitContainers []k8sContainer `json:"initContainers,omitempty" yaml:"initContainers,omitempty"`
+		Containers     []k8sContainer `json:"containers" yaml:"containers"`
+		Volumes        []k8sVolume    `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+	}
+
+	k8sContainer struct {
+		Name           string                   `json:"name" yaml:"name"`
+		Image          string                   `json:"image" yaml:"image"`
+		Command        []string                 `json:"command,omitempty" yaml:"command,omitempty"`
+		Args           []string                 `json:"args,omitempty" yaml:"args,omitempty"`
+		Env            []k8sEnvVar              `json:"env,omitempty" yaml:"env,omitempty"`
+		Ports          []k8sContainerPort       `json:"ports,omitempty" yaml:"ports,omitempty"`
+		Resources      *k8sResourceRequirements `json:"resources,omitempty" yaml:"resources,omitempty"`
+		VolumeMounts   []k8sVolumeMount         `json:"volumeMounts,omitempty" yaml:"volumeMounts,omitempty"`
+		ReadinessProbe *k8sProbe                `json:"readinessProbe,omitempty" yaml:"readinessProbe,omitempty"`
+	}
+
+	k8sEnvVar struct {
+		Name  string `json:"name" yaml:"name"`
+		Value string `json:"value" yaml:"value"`
+	}
+
+	k8sContainerPort struct {
+		Name          string `json:"name" yaml:"name"`
+		ContainerPort int    `json:"containerPort" yaml:"containerPort"`
+	}
+
+	k8sResourceRequirements struct {
+		Requests map[string]string `json:"requests,omitempty" yaml:"requests,omitempty"`
+		Limits   map[string]string `json:"limits,omitempty" yaml:"limits,omitempty"`
+	}
+
+	k8sVolumeMount struct {
+		Name      string `json:"name" yaml:"name"`
+		MountPath string `json:"mountPath" yaml:"mountPath"`
+		ReadOnly  bool   `json:"readOnly,omitempty" yaml:"readOnly,omitempty"`
+	}
+
+	k8sProbe struct {
+		HTTPGet       *k8sHTTPGetAction `json:"httpGet,omitempty" yaml:"httpGet,omitempty"`
+		PeriodSeconds int               `json:"periodSeconds,omitempty" yaml:"periodSeconds,omitempty"`
+	}
+
+	k8sHTTPGetAction struct {
+		Path string `json:"path" yaml:"path"`
+		Port string `json:"port" yaml:"port"`
+	}
+
+	k8sVolume struct {
+		Name      string                    `json:"name" yaml:"name"`
+		Image     *k8sImageVolumeSource     `json:"image,omitempty" yaml:"image,omitempty"`
+		EmptyDir  *struct{}                 `json:"emptyDir,omitempty" yaml:"emptyDir,omitempty"`
+		ConfigMap *k8sConfigMapVolumeSource `json:"configMap,omitempty" yaml:"configMap,omitempty"`
+	}
+
+	k8sImageVolumeSource struct {
+		Reference  string `json:"reference" yaml:"reference"`
+		PullPolicy string `json:"pullPolicy,omitempty" yaml:"pullPolicy,omitempty"`
+	}
+
+	k8sConfigMapVolumeSource struct {
+		Name string `json:"name" yaml:"name"`
+	}
+
+	k8sService struct {
+		APIVersion string         `json:"apiVersion" yaml:"apiVersion"`
+		Kind       string         `json:"kind" yaml:"kind"`
+		Metadata   k8sObjectMeta  `json:"metadata" yaml:"metadata"`
+		Spec       k8sServiceSpec `json:"spec" yaml:"spec"`
+	}
+
+	k8sServiceSpec struct {
+		Selector map[string]string `json:"selector" yaml:"selector"`
+		Ports    []k8sServicePort  `json:"ports" yaml:"ports"`
+	}
+
+	k8sServicePort struct {
+		Name       string `json:"name" yaml:"name"`
+		Port       int    `json:"port" yaml:"port"`
+		TargetPort string `json:"targetPort" yaml:"targetPort"`
+	}
+)
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func generateCompose(app string) *cobra.Command {
+	var (
+		gf      = newGenerateFlags()
+		profile string
+	)
+	c := &cobra.Command{
+		Use:   "compose MODEL [ARG...]",
+		Short: "Generate the Docker Compose file of a model.",
+		Long: "Generate the Docker Compose file of a model, " +
+			"the model is pulled if not found locally, and its files are bind-mounted from the store, " +
+			"the arguments are rewritten as run does.",
+		Example: sprintf(`  # Generate the Docker Compose file of a model
+  %s generate compose gpustack/qwen2:0.5b-instruct
+
+  # Generate the Docker Compose file of a model with 2 GPUs and customized arguments
+  %[1]s generate compose gpustack/qwen2:0.5b-instruct --gpus 2 -- -c 8192 -np 4
+
+  # Generate and start the Docker Compose service
+  %[1]s generate compose gpustack/qwen2:0.5b-instruct > compose.yaml && docker compose up -d`, app),
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			gm, err := gf.retrieve(c, app, args, true)
+			if err != nil {
+				return err
+			}
+			if err = gm.applyProfile(profile); err != nil {
+				return err
+			}
+			img, err := gf.image(gm.Runtime)
+			if err != nil {
+				return err
+			}
+			err = gf.command(&gm, runtimeInput{
+				Exec:   gm.Runtime.Binary(),
+				Dir:    generateModelDir,
+				GenDir: generateRuntimeDir,
+				Join:   path.Join,
+				Host:   "0.0.0.0",
+			})
+			if err != nil {
+				return err
+			}
+			rt, rc, svcName := gm.Runtime, gm.Command, gm.Name
+
+			cf := composeFile{
+				Services: map[string]composeService{},
+			}
+			svc := composeService{
+				Image:   img,
+				Command: rc.Args,
+				Labels: map[string]string{
+					"gguf-packer.gpustack.ai/model":          gm.Reference,
+					"gguf-packer.gpustack.ai/estimated-ram":  sprintf(gm.RAM),
+					"gguf-packer.gpustack.ai/estimated-vram": sprintf(gm.VRAM),
+				},
+				Volumes: []string{
+					fmt.Sprintf("%s:%s:ro", gm.LayersPath, generateModelDir),
+				},
+				Restart: "unless-stopped",
+			}
+			if rc.Entrypoint != "" {
+				svc.Entrypoint = []string{rc.Entrypoint}
+			}
+			if len(rc.Env) != 0 {
+				svc.Environment = map[string]string{}
+				for _, e := range rc.Env {
+					k, v, _ := strings.Cut(e, "=")
+					svc.Environment[k] = v
+				}
+			}
+			for n, bs := range rc.Files {
+				if cf.Configs == nil {
+					cf.Configs = map[string]composeConfig{}
+				}
+				cn := svcName + "-" + toDNS1123Name(n)
+				cf.Configs[cn] = composeConfig{Content: string(bs)}
+				svc.Configs = append(svc.Configs, composeServiceConfig{
+					Source: cn,
+					Target: path.Join(generateRuntimeDir, n),
+				})
+			}
+			if gf.gpus > 0 {
+				svc.Deploy = &composeDeploy{
+					Resources: composeResources{
+						Reservations: composeReservations{
+							Devices: []composeDevice{
+								{Driver: "nvidia", Count: gf.gpus, Capabilities: []string{"gpu"}},
+							},
+						},
+					},
+				}
+			}
+			if p := gm.Port; p != 0 {
+				svc.Ports = []string{fmt.Sprintf("%d:%d", p, p)}
+				var test []string
+				if hc, ok := rt.(runtimeHealthCommander); ok {
+					test = append([]string{"CMD"}, hc.HealthCommand()...)
+				} else if rt.HealthPath() != "" {
+					test = []string{"CMD", "curl", "-fsS", fmt.Sprintf("http://localhost:%d%s", p, rt.HealthPath())}
+				}
+				if test != nil {
+					svc.Healthcheck = &composeHealthcheck{
+						Test:        test,
+						Interval:    "10s",
+						Timeout:     "5s",
+						Retries:     3,
+						StartPeriod: "5m",
+					}
+				}
+			}
+			cf.Services[svcName] = svc
+
+			return renderManifests(c, []any{cf})
+		},
+	}
+	gf.addFlags(c.Flags(), true)
+	c.Flags().StringVar(&profile, "profile", profile, "Specify the device profile to choose the split and offload flags, "+
+		"the flags given explicitly take precedence, see \"devices\" command.")
+	return c
+}
+
+// The minimal Docker Compose types to generate the file,
+// see https://docs.docker.com/reference/compose-file/.
+type (
+	composeFile struct {
+		Services map[string]composeService `json:"services" yaml:"services"`
+		Configs  map[string]composeConfig  `json:"configs,omitempty" yaml:"configs,omitempty"`
+	}
+
+	composeService struct {
+		Image       string                 `json:"image" yaml:"image"`
+		Entrypoint  []string               `json:"entrypoint,omitempty" yaml:"entrypoint,omitempty"`
+		Command     []string               `json:"command,omitempty" yaml:"command,omitempty"`
+		Environment map[string]string      `json:"environment,omitempty" yaml:"environment,omitempty"`
+		Labels      map[string]string      `json:"labels,omitempty" yaml:"labels,omitempty"`
+		Ports       []string               `json:"ports,omitempty" yaml:"ports,omitempty"`
+		Volumes     []string               `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+		Configs     []composeServiceConfig `json:"configs,omitempty" yaml:"configs,omitempty"`
+		Healthcheck *composeHealthcheck    `json:"healthcheck,omitempty" yaml:"healthcheck,omitempty"`
+		Deploy      *composeDeploy         `json:"deploy,omitempty" yaml:"deploy,omitempty"`
+		Restart     string                 `json:"restart,omitempty" yaml:"restart,omitempty"`
+	}
+
+	composeServiceConfig struct {
+		Source string `json:"source" yaml:"source"`
+		Target string `json:"target" yaml:"target"`
+	}
+
+	composeConfig struct {
+		Content string `json:"content" yaml:"content"`
+	}
+
+	composeHealthcheck struct {
+		Test        []string `json:"test" yaml:"test"`
+		Interval    string   `json:"interval,omitempty" yaml:"interval,omitempty"`
+		Timeout     string   `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+		Retries     int      `json:"retries,omitempty" yaml:"retries,omitempty"`
+		StartPeriod string   `json:"start_period,omitempty" yaml:"start_period,omitempty"`
+	}
+
+	composeDeploy struct {
+		Resources composeResources `json:"resources" yaml:"resources"`
+	}
+
+	composeResources struct {
+		Reservations composeReservations `json:"reservations" yaml:"reservations"`
+	}
+
+	composeReservations struct {
+		Devices []composeDevice `json:"devices" yaml:"devices"`
+	}
+
+	composeDevice struct {
+		Driver       string   `json:"driver" yaml:"driver"`
+		Count        int      `json:"count" yaml:"count"`
+		Capabilities []string `json:"capabilities" yaml:"capabilities"`
+	}
+)
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gpustack/gguf-packer-go/util/osx"
+	"github.com/spf13/cobra"
+)
+
+func generateSystemd(app string) *cobra.Command {
+	var (
+		gf      = newGenerateFlags()
+		by      string
+		user    string
+		profile string
+	)
+	c := &cobra.Command{
+		Use:   "systemd MODEL [ARG...]",
+		Short: "Generate the systemd unit of a model.",
+		Long: "Generate the systemd unit of a model, which runs the executable binary of the runtime " +
+			"with the absolute paths of the model files in the store, the arguments are rewritten as run does. " +
+			"The generated runtime files are placed in the store, under generated/NAME.",
+		Example: sprintf(`  # Generate the systemd unit of a model
+  %s generate systemd gpustack/qwen2:0.5b-instruct
+
+  # Generate the systemd unit of a model run by llama-box with customized arguments
+  %[1]s generate systemd gpustack/qwen2:0.5b-instruct --by /usr/local/bin/llama-box -- -c 8192 -np 4
+
+  # Generate, install and start the systemd unit
+  %[1]s generate systemd gpustack/qwen2:0.5b-instruct > /etc/systemd/system/qwen2.service
+  systemctl daemon-reload && systemctl enable --now qwen2`, app),
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			switch outputFormat {
+			case "", "table":
+			default:
+				return fmt.Errorf("--format %s is not supported by %s", outputFormat, c.Name())
+			}
+
+			gm, err := gf.retrieve(c, app, args, true)
+			if err != nil {
+				return err
+			}
+			if err = gm.applyProfile(profile); err != nil {
+				return err
+			}
+			rf := runFlags{by: by, runtime: gf.runtime, fs: c.Flags()}
+			if gm.Runtime, err = rf.getRuntime(); err != nil {
+				return err
+			}
+			rt := gm.Runtime
+			if by == "" {
+				by = rt.Binary()
+			}
+			// The unit requires the absolute path of the executable.
+			if by, err = exec.LookPath(by); err != nil {
+				return fmt.Errorf("looking up binary %s: %w", by, err)
+			}
+			if by, err = filepath.Abs(by); err != nil {
+				return fmt.Errorf("getting absolute path of %s: %w", by, err)
+			}
+
+			gd := filepath.Join(storePath, "generated", gm.Name)
+			err = gf.command(&gm, runtimeInput{
+				Exec:   by,
+				Dir:    gm.LayersPath,
+				GenDir: gd,
+				Join:   filepath.Join,
+			})
+			if err != nil {
+				return err
+			}
+			rc := gm.Command
+			for n, bs := range rc.Files {
+				p := filepath.Join(gd, n)
+				if err = osx.WriteFile(p, bs, 0644); err != nil {
+					return fmt.Errorf("writing runtime file %s: %w", p, err)
+				}
+				fprintf(c.ErrOrStderr(), "Generated %s\n", p)
+			}
+
+			var sb strings.Builder
+			fprintf(&sb, "# Estimated RAM: %s, VRAM of each GPU: %s, with %d GPUs.\n", gm.RAM, gm.VRAM, gf.gpus)
+			sb.WriteString("[Unit]\n")
+			sb.WriteString("Description=" + systemdEscape(gm.Args[0]) + " served by " + rt.Name() + "\n")
+			sb.WriteString("Wants=network-online.target\n")
+			sb.WriteString("After=network-online.target\n")
+			sb.WriteString("\n[Service]\n")
+			sb.WriteString("Type=simple\n")
+			if user != "" {
+				sb.WriteString("User=" + user + "\n")
+			}
+			for _, e := range rc.Env {
+				sb.WriteString("Environment=" + systemdQuote(e) + "\n")
+			}
+			sb.WriteString("ExecStart=" + systemdQuote(tenary(rc.Entrypoint != "", rc.Entrypoint, by).(string)))
+			for _, a := range rc.Args {
+				sb.WriteString(" " + systemdQuote(a))
+			}
+			sb.WriteString("\n")
+			sb.WriteString("Restart=on-failure\n")
+			sb.WriteString("RestartSec=5\n")
+			sb.WriteString("\n[Install]\n")
+			sb.WriteString("WantedBy=multi-user.target\n")
+			_, err = c.OutOrStdout().Write([]byte(sb.String()))
+			return err
+		},
+	}
+	gf.addFlags(c.Flags(), false)
+	c.Flags().StringVar(&by, "by", by, "Specify the executable binary to run the model, "+
+		"default is the executable binary of the runtime.")
+	c.Flags().Lookup("runtime").Usage += " If not given, it is chosen by the executable binary of --by, e.g. llama-box."
+	c.Flags().StringVar(&user, "user", user, "Specify the user to run the unit.")
+	c.Flags().StringVar(&profile, "profile", profile, "Specify the device profile to choose the split and offload flags, "+
+		"the flags given explicitly take precedence, see \"devices\" command.")
+	return c
+}
+
+// systemdEscape escapes the specifiers and the variable expansions of systemd.
+func systemdEscape(s string) string {
+	return strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+}
+
+// systemdQuote escapes the given command line word of systemd,
+// and quotes it if it contains whitespaces or quotes.
+func systemdQuote(s string) string {
+	s = systemdEscape(s)
+	if s != "" && !strings.ContainsAny(s, " \t\n\"'\\;") {
+		return s
+	}
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(s)
+	return `"` + s + `"`
+}
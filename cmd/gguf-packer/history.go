@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	conreg "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	specs "github.com/gpustack/gguf-packer-go/buildkit/frontend/specs/v1"
+	"github.com/gpustack/gguf-packer-go/util/osx"
+	ggufparser "github.com/gpustack/gguf-parser-go"
+	"github.com/spf13/cobra"
+)
+
+func history(app string) *cobra.Command {
+	var (
+		insecure bool
+		force    bool
+		noTrunc  bool
+		lineage  bool
+	)
+	c := &cobra.Command{
+		Use:   "history MODEL",
+		Short: "Show how a model was built.",
+		Example: sprintf(`  # Show the build steps of a model
+  %s history gpustack/qwen2:0.5b-instruct
+
+  # Show the build steps of a model without truncating the arguments
+  %[1]s history gpustack/qwen2:0.5b-instruct --no-trunc
+
+  # Show the parent models of a model
+  %[1]s history gpustack/qwen2:0.5b-instruct --lineage`, app),
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			model := args[0]
+
+			var cos crane.Options
+			{
+				co := []crane.Option{
+					getAuthnKeychainOption(),
+				}
+				if insecure {
+					co = append(co, crane.Insecure)
+				}
+				cos = crane.GetOptions(co...)
+			}
+
+			rf, err := name.NewTag(model, cos.Name...)
+			if err != nil {
+				return fmt.Errorf("parsing model reference %q: %w", model, err)
+			}
+
+			if lineage {
+				lis, err := retrieveLineageByOCIReference(force, rf, cos.Name, cos.Remote...)
+				if err != nil {
+					return err
+				}
+				return render(c, lis, func() (hds, bds [][]any, border bool) {
+					hds = [][]any{
+						{
+							"Model",
+							"Digest",
+							"Arch",
+							"Params",
+							"Bpw",
+							"Type",
+							"Created",
+							"Size",
+						},
+					}
+					bds = make([][]any, len(lis))
+					for i, li := range lis {
+						d := li.Digest
+						if !noTrunc && len(d) > 19 {
+							d = d[:19]
+						}
+						if li.Error != "" {
+							bds[i] = []any{li.Model, d, li.Error, "", "", "", "", ""}
+							continue
+						}
+						bds[i] = []any{
+							li.Model,
+							d,
+							li.Architecture,
+							sprintf(li.Parameters),
+							sprintf(li.BitsPerWeight),
+							li.FileType,
+							humanizeTime(li.Created),
+							sprintf(li.Size),
+						}
+					}
+					return hds, bds, false
+				})
+			}
+
+			his, err := retrieveHistoryByOCIReference(force, rf, cos.Remote...)
+			if err != nil {
+				return err
+			}
+			return render(c, his, func() (hds, bds [][]any, border bool) {
+				hds = [][]any{
+					{
+						"Created",
+						"Instruction",
+						"Arguments",
+						"Layer",
+						"Size",
+					},
+				}
+				bds = make([][]any, len(his))
+				for i, hi := range his {
+					as := hi.Arguments
+					if !noTrunc && len(as) > 60 {
+						as = as[:57] + "..."
+					}
+					l := hi.Layer
+					if _, hex, ok := strings.Cut(l, ":"); ok && !noTrunc {
+						l = hex[:12]
+					}
+					bds[i] = []any{
+						humanizeTime(hi.Created),
+						hi.Instruction,
+						as,
+						l,
+						sprintf(hi.Size),
+					}
+				}
+				return hds, bds, false
+			})
+		},
+	}
+	c.Flags().BoolVar(&insecure, "insecure", insecure, "Allow model references to be fetched without TLS.")
+	c.Flags().BoolVar(&force, "force", force, "Always retrieve the model from the registry.")
+	c.Flags().BoolVar(&noTrunc, "no-trunc", noTrunc, "Do not truncate the output.")
+	c.Flags().BoolVar(&lineage, "lineage", lineage, "Show the parent models, "+
+		"which follows the org.opencontainers.image.base.name and org.opencontainers.image.base.digest labels.")
+	return c
+}
+
+// historyItem holds a build step of a model.
+type historyItem struct {
+	Created     *time.Time                 `json:"created,omitempty"`
+	CreatedBy   string                     `json:"createdBy"`
+	Instruction string                     `json:"instruction"`
+	Arguments   string                     `json:"arguments"`
+	Options     map[string]string          `json:"options,omitempty"`
+	EmptyLayer  bool                       `json:"emptyLayer"`
+	Layer       string                     `json:"layer,omitempty"`
+	Size        ggufparser.GGUFBytesScalar `json:"size"`
+}
+
+// retrieveHistoryByOCIReference returns the build steps of the given reference,
+// the layer size is the uncompressed size if the model is local,
+// otherwise, it is the compressed size.
+func retrieveHistoryByOCIReference(force bool, ref name.Reference, opts ...remote.Option) ([]historyItem, error) {
+	var (
+		cf    specs.Image
+		sizes []int64
+	)
+
+	mdp := getModelMetadataStorePath(ref)
+	if !force && osx.ExistsLink(mdp) {
+		var err error
+		cf, err = retrieveConfigByPath(mdp)
+		if err != nil {
+			return nil, err
+		}
+		// Read from the blobs store, which caches the uncompressed layers.
+		sizes = make([]int64, len(cf.RootFS.DiffIDs))
+		for i, d := range cf.RootFS.DiffIDs {
+			if fi, err := os.Stat(filepath.Join(getBlobsStorePath(), d.Algorithm().String(), d.Encoded())); err == nil {
+				sizes[i] = fi.Size()
+			}
+		}
+	} else {
+		rd, err := remote.Get(ref, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("getting model remote %q: %w", ref.Name(), err)
+		}
+		img, err := retrieveOCIImage(rd)
+		if err != nil {
+			return nil, err
+		}
+		cf, _, err = retrieveConfigByOCIImage(img)
+		if err != nil {
+			return nil, err
+		}
+		ls, err := img.Layers()
+		if err != nil {
+			return nil, fmt.Errorf("retrieving image layers: %w", err)
+		}
+		sizes = make([]int64, len(ls))
+		for i := range ls {
+			if sizes[i], err = ls[i].Size(); err != nil {
+				return nil, fmt.Errorf("getting layer size: %w", err)
+			}
+		}
+	}
+
+	his := make([]historyItem, len(cf.History))
+	for i, j := 0, 0; i < len(cf.History); i++ {
+		h := cf.History[i]
+		his[i] = historyItem{
+			Created:    h.Created,
+			CreatedBy:  h.CreatedBy,
+			EmptyLayer: h.EmptyLayer,
+		}
+		his[i].Instruction, his[i].Arguments, his[i].Options = parseHistoryCreatedBy(h.CreatedBy)
+		if h.EmptyLayer {
+			continue
+		}
+		if j < len(cf.RootFS.DiffIDs) {
+			his[i].Layer = cf.RootFS.DiffIDs[j].String()
+		}
+		if j < len(sizes) {
+			his[i].Size = ggufparser.GGUFBytesScalar(sizes[j])
+		}
+		j++
+	}
+	return his, nil
+}
+
+// parseHistoryCreatedBy splits the given created by of the history into the instruction and arguments,
+// and collects the --key=value options of the arguments, e.g. the quantize type, imatrix and base model.
+func parseHistoryCreatedBy(cb string) (instruction, arguments string, options map[string]string) {
+	cb = strings.TrimSpace(strings.TrimSuffix(cb, " # buildkit"))
+	instruction, arguments, _ = strings.Cut(cb, " ")
+	for _, f := range strings.Fields(arguments) {
+		if !strings.HasPrefix(f, "--") {
+			continue
+		}
+		k, v, ok := strings.Cut(strings.TrimPrefix(f, "--"), "=")
+		if !ok {
+			v = "true"
+		}
+		if options == nil {
+			options = map[string]string{}
+		}
+		if ov, ok := options[k]; ok {
+			v = ov + "," + v
+		}
+		options[k] = v
+	}
+	return instruction, arguments, options
+}
+
+// lineageItem holds a model of the lineage.
+type lineageItem struct {
+	Model         string                             `json:"model"`
+	Digest        string                             `json:"digest,omitempty"`
+	Architecture  string                             `json:"architecture,omitempty"`
+	Parameters    ggufparser.GGUFParametersScalar    `json:"parameters,omitempty"`
+	BitsPerWeight ggufparser.GGUFBitsPerWeightScalar `json:"bitsPerWeight,omitempty"`
+	FileType      string                             `json:"fileType,omitempty"`
+	Created       *time.Time                         `json:"created,omitempty"`
+	Size          ggufparser.GGUFBytesScalar         `json:"size,omitempty"`
+	Error         string                             `json:"error,omitempty"`
+}
+
+const (
+	labelBaseName   = "org.opencontainers.image.base.name"
+	labelBaseDigest = "org.opencontainers.image.base.digest"
+)
+
+// retrieveLineageByOCIReference returns the given reference and its parent models,
+// which follows the base name and digest labels until no parent is found,
+// the retrieving error of a parent is recorded into the last item.
+func retrieveLineageByOCIReference(force bool, ref name.Reference, nopts []name.Option, opts ...remote.Option) ([]lineageItem, error) {
+	cf, err := retrieveConfigByOCIReference(force, false, ref, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	lis := []lineageItem{toLineageItem(strings.TrimPrefix(ref.Name(), dockerRegPrefix), "", cf)}
+	var rd string
+	if d, ok := ref.(name.Digest); ok {
+		rd = d.DigestStr()
+	}
+	visited := map[string]struct{}{getLineageKey(ref, rd): {}}
+	for {
+		bn, bd := cf.Config.Labels[labelBaseName], cf.Config.Labels[labelBaseDigest]
+		if bn == "" {
+			break
+		}
+		if br, err := name.ParseReference(bn, nopts...); err == nil {
+			// The base name is pinned by digest, e.g. REPO:TAG@DIGEST,
+			// strip the digest to look up the local model by tag.
+			if d, ok := br.(name.Digest); ok {
+				bn, _, _ = strings.Cut(bn, "@")
+				if bd == "" {
+					bd = d.DigestStr()
+				}
+			}
+		}
+		li := lineageItem{Model: bn, Digest: bd}
+
+		brf, err := name.NewTag(bn, nopts...)
+		if err != nil {
+			li.Error = fmt.Sprintf("parsing base reference: %v", err)
+			lis = append(lis, li)
+			break
+		}
+		// Labels are inherited from the parent if not overridden,
+		// stop if the parent has been visited.
+		k := getLineageKey(brf, bd)
+		if _, ok := visited[k]; ok {
+			break
+		}
+		visited[k] = struct{}{}
+
+		// Prefer the local model if it is exactly the parent,
+		// otherwise, retrieve the digest from remote,
+		// as the tag may have been moved since the model was built.
+		var rf name.Reference = brf
+		if bd != "" && (force || getLocalManifestDigest(brf) != bd) {
+			rf = brf.Context().Digest(bd)
+		}
+		cf, err = retrieveConfigByOCIReference(force, false, rf, opts...)
+		if err != nil {
+			li.Error = err.Error()
+			lis = append(lis, li)
+			break
+		}
+		lis = append(lis, toLineageItem(bn, bd, cf))
+	}
+	return lis, nil
+}
+
+// getLineageKey returns the key to identify a model of the lineage,
+// which is the digest if known, otherwise, the reference name.
+func getLineageKey(ref name.Reference, digest string) string {
+	if digest != "" {
+		return digest
+	}
+	return ref.Name()
+}
+
+// getLocalManifestDigest returns the manifest digest of the given reference in the local store,
+// which is the digest of the base labels, or blank if not found.
+func getLocalManifestDigest(ref name.Reference) string {
+	cfp, err := os.Readlink(getModelMetadataStorePath(ref))
+	if err != nil {
+		return ""
+	}
+	bs, err := os.ReadFile(convertConfigStorePathToManifestStorePath(cfp))
+	if err != nil {
+		return ""
+	}
+	d, _, err := conreg.SHA256(bytes.NewReader(bs))
+	if err != nil {
+		return ""
+	}
+	return d.String()
+}
+
+func toLineageItem(model, digest string, cf specs.Image) lineageItem {
+	li := lineageItem{
+		Model:   model,
+		Digest:  digest,
+		Created: cf.Created,
+		Size:    cf.Config.Size,
+	}
+	if m := cf.Config.Model; m != nil {
+		li.Architecture = m.Architecture
+		li.Parameters = m.Parameters
+		li.BitsPerWeight = m.BitsPerWeight
+		li.FileType = m.FileType.String()
+	}
+	return li
+}
@@ -1,37 +1,98 @@
 package main
 
 import (
+	"archive/tar"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/google/go-containerregistry/pkg/crane"
 	"github.com/google/go-containerregistry/pkg/name"
+	conreg "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	specs "github.com/gpustack/gguf-packer-go/buildkit/frontend/specs/v1"
 	"github.com/gpustack/gguf-packer-go/util/osx"
+	ggufparser "github.com/gpustack/gguf-parser-go"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func inspect(app string) *cobra.Command {
 	var (
 		insecure bool
 		force    bool
+		full     bool
+		attests  bool
+		gsf      ggufSourceFlags
+		file     string
+		tensors  bool
+		filter   string
+		groupBy  string
+		metadata bool
+		keys     []string
 	)
 
 	c := &cobra.Command{
-		Use:   "inspect MODEL",
+		Use:   "inspect MODEL|FILE|URL",
 		Short: "Get the low-level information of a model.",
 		Example: sprintf(`  # Inspect a model
   %s inspect gpustack/qwen2:0.5b-instruct
 
   # Force inspect a model from remote
-  %[1]s inspect gpustack/qwen2:0.5b-instruct --force`, app),
+  %[1]s inspect gpustack/qwen2:0.5b-instruct --force
+
+  # Inspect a model with full GGUF metadata and tensor infos
+  %[1]s inspect gpustack/qwen2:0.5b-instruct --full
+
+  # Inspect a local GGUF file before packing
+  %[1]s inspect ~/models/qwen2-0_5b-instruct-q4_k_m.gguf
+
+  # Inspect the attestations of a model, e.g. SBOM
+  %[1]s inspect gpustack/qwen2:0.5b-instruct --attestations
+
+  # Inspect the tensors of the first layer
+  %[1]s inspect gpustack/qwen2:0.5b-instruct --tensors --filter 'blk\.0\..*'
+
+  # Inspect the tensor size of each layer
+  %[1]s inspect gpustack/qwen2:0.5b-instruct --tensors --group-by layer
+
+  # Inspect the tokenizer metadata of the projector
+  %[1]s inspect gpustack/llava-phi3:3.8b-mini --file projector --metadata --key 'tokenizer.*'`, app),
 		Args: cobra.ExactArgs(1),
 		RunE: func(c *cobra.Command, args []string) error {
 			model := args[0]
 
+			switch {
+			case tensors && metadata:
+				return errors.New("--tensors and --metadata are mutually exclusive")
+			case attests && (file != "" || tensors || metadata):
+				return errors.New("--attestations cannot be used with --file, --tensors or --metadata")
+			case !tensors && (filter != "" || groupBy != ""):
+				return errors.New("--filter and --group-by require --tensors")
+			case !metadata && len(keys) != 0:
+				return errors.New("--key requires --metadata")
+			}
+			if groupBy != "" && groupBy != "type" && groupBy != "layer" {
+				return fmt.Errorf("--group-by has invalid value %q, select from [type, layer]", groupBy)
+			}
+			var fre *regexp.Regexp
+			if filter != "" {
+				var err error
+				if fre, err = regexp.Compile("^(?:" + filter + ")$"); err != nil {
+					return fmt.Errorf("--filter has invalid regular expression: %w", err)
+				}
+			}
+
 			var cos crane.Options
 			{
 				co := []crane.Option{
@@ -43,31 +104,282 @@ func inspect(app string) *cobra.Command {
 				cos = crane.GetOptions(co...)
 			}
 
-			rf, err := name.NewTag(model, cos.Name...)
-			if err != nil {
-				return fmt.Errorf("parsing model reference %q: %w", model, err)
+			var (
+				cf      specs.Image
+				err     error
+				inflate = full || tensors || metadata
+			)
+			if isGGUFSource(model) {
+				if attests {
+					return errors.New("--attestations is not supported for GGUF source")
+				}
+				cf, err = retrieveConfigByGGUFSource(c.Context(), inflate, insecure, model, gsf)
+				if err != nil {
+					return err
+				}
+			} else {
+				rf, err := name.NewTag(model, cos.Name...)
+				if err != nil {
+					return fmt.Errorf("parsing model reference %q: %w", model, err)
+				}
+
+				if attests {
+					ats, err := retrieveAttestationsByOCIReference(rf, cos.Remote...)
+					if err != nil {
+						return err
+					}
+					return render(c, ats, nil)
+				}
+
+				cf, err = retrieveConfigByOCIReference(force, inflate, rf, cos.Remote...)
+				if err != nil {
+					return err
+				}
+				cf.History = nil // Remove history.
 			}
 
-			cf, err := retrieveConfigByOCIReference(force, rf, cos.Remote...)
+			if file == "" && !tensors && !metadata {
+				return render(c, cf, nil)
+			}
+			gf, err := selectGGUFFile(cf.Config, tenary(file == "", "model", file).(string))
 			if err != nil {
 				return err
 			}
-			cf.History = nil // Remove history.
-			jprint(c.OutOrStdout(), cf)
-			return nil
+			switch {
+			case tensors:
+				return renderTensors(c, gf, fre, groupBy)
+			case metadata:
+				return renderMetadata(c, gf, keys)
+			}
+			return render(c, gf, nil)
 		},
 	}
-	c.Flags().BoolVar(&insecure, "insecure", insecure, "Allow model references to be fetched without TLS.")
+	c.Flags().BoolVar(&insecure, "insecure", insecure, "Allow model references or URLs to be fetched without TLS.")
 	c.Flags().BoolVar(&force, "force", force, "Always inspect the model from the registry.")
+	c.Flags().BoolVar(&full, "full", full, "Inspect the model with the full GGUF metadata and tensor infos.")
+	c.Flags().BoolVar(&attests, "attestations", attests, "Inspect the in-toto attestations of the model from the registry, "+
+		"e.g. SBOM.")
+	gsf.addFlags(c.Flags())
+	c.Flags().StringVar(&file, "file", file, "Inspect the given GGUF file only, "+
+		"select from [model, drafter, projector, adapter[N]], e.g. adapter[0].")
+	c.Flags().BoolVar(&tensors, "tensors", tensors, "Inspect the type, shape and size of the tensors.")
+	c.Flags().StringVar(&filter, "filter", filter, "Filter the tensors by the given regular expression of the tensor name, "+
+		"which must match the whole name, e.g. 'blk\\.0\\..*'.")
+	c.Flags().StringVar(&groupBy, "group-by", groupBy, "Aggregate the tensors by the given key, select from [type, layer].")
+	c.Flags().BoolVar(&metadata, "metadata", metadata, "Inspect the metadata key-values.")
+	c.Flags().StringSliceVar(&keys, "key", keys, "Filter the metadata by the given glob patterns of the key, e.g. 'tokenizer.*'.")
 	return c
 }
 
-func retrieveConfigByOCIReference(force bool, ref name.Reference, opts ...remote.Option) (cf specs.Image, err error) {
+// selectGGUFFile returns the GGUF file of the given config by the given name,
+// select from [model, drafter, projector, adapter[N]].
+func selectGGUFFile(cfg specs.ImageConfig, file string) (*specs.GGUFFile, error) {
+	var gf *specs.GGUFFile
+	switch file {
+	case "model":
+		gf = cfg.Model
+	case "drafter":
+		gf = cfg.Drafter
+	case "projector":
+		gf = cfg.Projector
+	default:
+		is, ok := strings.CutPrefix(file, "adapter[")
+		if !ok || !strings.HasSuffix(is, "]") {
+			return nil, fmt.Errorf("--file has invalid value %q, select from [model, drafter, projector, adapter[N]]", file)
+		}
+		i, err := strconv.Atoi(strings.TrimSuffix(is, "]"))
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("--file has invalid adapter index %q", file)
+		}
+		if i < len(cfg.Adapters) {
+			gf = cfg.Adapters[i]
+		}
+	}
+	if gf == nil {
+		return nil, fmt.Errorf("no %s found", file)
+	}
+	return gf, nil
+}
+
+// tensorItem holds the information of a tensor.
+type tensorItem struct {
+	Name     string                     `json:"name"`
+	Type     string                     `json:"type"`
+	Shape    []uint64                   `json:"shape"`
+	Elements uint64                     `json:"elements"`
+	Bytes    ggufparser.GGUFBytesScalar `json:"bytes"`
+}
+
+// tensorGroupItem holds the aggregation of the tensors.
+type tensorGroupItem struct {
+	Group    string                     `json:"group"`
+	Count    int                        `json:"count"`
+	Elements uint64                     `json:"elements"`
+	Bytes    ggufparser.GGUFBytesScalar `json:"bytes"`
+}
+
+// renderTensors renders the tensors of the given GGUF file,
+// which are filtered by the given regular expression, and aggregated by the given key if not empty.
+func renderTensors(c *cobra.Command, gf *specs.GGUFFile, fre *regexp.Regexp, groupBy string) error {
+	var tis []tensorItem
+	for _, ti := range gf.TensorInfos {
+		if fre != nil && !fre.MatchString(ti.Name) {
+			continue
+		}
+		tis = append(tis, tensorItem{
+			Name:     ti.Name,
+			Type:     ti.Type.String(),
+			Shape:    ti.Dimensions,
+			Elements: ti.Elements(),
+			Bytes:    ggufparser.GGUFBytesScalar(ti.Bytes()),
+		})
+	}
+
+	if groupBy == "" {
+		if tis == nil {
+			tis = []tensorItem{}
+		}
+		return render(c, tis, func() (hds, bds [][]any, border bool) {
+			hds = [][]any{
+				{"Name", "Type", "Shape", "Elements", "Bytes"},
+			}
+			bds = make([][]any, len(tis))
+			for i, ti := range tis {
+				bds[i] = []any{
+					ti.Name,
+					ti.Type,
+					sprintf(ti.Shape),
+					sprintf(ti.Elements),
+					sprintf(ti.Bytes),
+				}
+			}
+			return hds, bds, false
+		})
+	}
+
+	tgis := []tensorGroupItem{}
+	idx := map[string]int{}
+	for _, ti := range tis {
+		g := ti.Type
+		if groupBy == "layer" {
+			g = tensorLayer(ti.Name)
+		}
+		i, ok := idx[g]
+		if !ok {
+			i = len(tgis)
+			idx[g] = i
+			tgis = append(tgis, tensorGroupItem{Group: g})
+		}
+		tgis[i].Count++
+		tgis[i].Elements += ti.Elements
+		tgis[i].Bytes += ti.Bytes
+	}
+	return render(c, tgis, func() (hds, bds [][]any, border bool) {
+		hds = [][]any{
+			{tenary(groupBy == "layer", "Layer", "Type"), "Count", "Elements", "Bytes"},
+		}
+		bds = make([][]any, len(tgis))
+		for i, tgi := range tgis {
+			bds[i] = []any{
+				tgi.Group,
+				sprintf(tgi.Count),
+				sprintf(tgi.Elements),
+				sprintf(tgi.Bytes),
+			}
+		}
+		return hds, bds, false
+	})
+}
+
+// tensorLayer returns the layer of the given tensor name,
+// e.g. blk.0 of blk.0.attn_q.weight, v.blk.0 of v.blk.0.ffn_up.weight,
+// and token_embd of token_embd.weight.
+func tensorLayer(n string) string {
+	ps := strings.Split(n, ".")
+	for i := 0; i+1 < len(ps); i++ {
+		if ps[i] != "blk" {
+			continue
+		}
+		if _, err := strconv.Atoi(ps[i+1]); err == nil {
+			return strings.Join(ps[:i+2], ".")
+		}
+	}
+	return ps[0]
+}
+
+// metadataItem holds a metadata key-value.
+type metadataItem struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+// renderMetadata renders the metadata of the given GGUF file,
+// which are filtered by the given glob patterns of the key if not empty.
+func renderMetadata(c *cobra.Command, gf *specs.GGUFFile, keys []string) error {
+	mis := []metadataItem{}
+	for _, kv := range gf.Header.MetadataKV {
+		if len(keys) != 0 && !slices.ContainsFunc(keys, func(k string) bool {
+			m, _ := path.Match(k, kv.Key)
+			return m
+		}) {
+			continue
+		}
+		mi := metadataItem{
+			Key:   kv.Key,
+			Type:  kv.ValueType.String(),
+			Value: kv.Value,
+		}
+		if kv.ValueType == ggufparser.GGUFMetadataValueTypeArray {
+			av := kv.ValueArray()
+			mi.Type = sprintf("%s[%s]", mi.Type, av.Type)
+			mi.Value = av.Array
+		}
+		mis = append(mis, mi)
+	}
+	return render(c, mis, func() (hds, bds [][]any, border bool) {
+		hds = [][]any{
+			{"Key", "Type", "Value"},
+		}
+		bds = make([][]any, len(mis))
+		for i, mi := range mis {
+			v := sprintf("%v", mi.Value)
+			if vs, ok := mi.Value.([]any); ok {
+				// Summarize the large arrays, e.g. tokenizer.ggml.tokens.
+				v = sprintf("len %d", len(vs))
+				if len(vs) != 0 {
+					v += sprintf(" %v", vs[:min(len(vs), 5)])
+					if len(vs) > 5 {
+						v = strings.TrimSuffix(v, "]") + " ...]"
+					}
+				}
+			}
+			if len(v) > 80 {
+				v = v[:77] + "..."
+			}
+			bds[i] = []any{mi.Key, mi.Type, strings.ReplaceAll(v, "\n", "\\n")}
+		}
+		return hds, bds, false
+	})
+}
+
+func retrieveConfigByOCIReference(force, inflate bool, ref name.Reference, opts ...remote.Option) (cf specs.Image, err error) {
 	// Read from local.
 	if !force {
 		mdp := getModelMetadataStorePath(ref)
 		if osx.ExistsLink(mdp) {
-			return retrieveConfigByPath(mdp)
+			cf, err = retrieveConfigByPath(mdp)
+			if err != nil || !inflate {
+				return cf, err
+			}
+			cfp, err := os.Readlink(mdp)
+			if err != nil {
+				return cf, fmt.Errorf("reading link %s: %w", mdp, err)
+			}
+			lsp := convertConfigStorePathToLayersStorePath(cfp)
+			return cf, inflateConfig(&cf, func(d specs.Descriptor) ([]byte, error) {
+				return os.ReadFile(filepath.Join(lsp, filepath.FromSlash(d.Path)))
+			})
 		}
 	}
 
@@ -81,19 +393,335 @@ func retrieveConfigByOCIReference(force bool, ref name.Reference, opts ...remote
 		return cf, err
 	}
 	cf, _, err = retrieveConfigByOCIImage(img)
-	return cf, err
+	if err != nil || !inflate {
+		return cf, err
+	}
+	return cf, inflateConfig(&cf, retrieveDetailsByOCIImage(img))
 }
 
+// retrieveAttestationsByOCIReference returns the in-toto statements attached to the given reference,
+// which are produced by BuildKit attestations, the statements of all platforms are returned for a multi-platform index.
+func retrieveAttestationsByOCIReference(ref name.Reference, opts ...remote.Option) ([]json.RawMessage, error) {
+	rd, err := remote.Get(ref, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("getting model remote %q: %w", ref.Name(), err)
+	}
+	if !rd.MediaType.IsIndex() {
+		return nil, errors.New("no attestations found")
+	}
+	idx, err := rd.ImageIndex()
+	if err != nil {
+		return nil, fmt.Errorf("getting model index: %w", err)
+	}
+	idxMs, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("getting model index manifest: %w", err)
+	}
+	ms := filterImageManifests(idxMs.Manifests)
+	if len(ms) == 0 {
+		return nil, errors.New("empty model index")
+	}
+	// Collect the attestations of all platforms.
+	subjects := make(map[string]bool, len(ms))
+	for _, m := range ms {
+		subjects[m.Digest.String()] = true
+	}
+
+	var ats []json.RawMessage
+	for _, m := range idxMs.Manifests {
+		if m.Annotations[annotationReferenceType] != annotationReferenceTypeAttestation ||
+			!subjects[m.Annotations[annotationReferenceDigest]] {
+			continue
+		}
+		img, err := idx.Image(m.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("getting attestation %s: %w", m.Digest, err)
+		}
+		ls, err := img.Layers()
+		if err != nil {
+			return nil, fmt.Errorf("getting attestation layers: %w", err)
+		}
+		for _, l := range ls {
+			mt, err := l.MediaType()
+			if err != nil {
+				return nil, fmt.Errorf("getting attestation layer media type: %w", err)
+			}
+			if mt != mediaTypeInToto {
+				continue
+			}
+			bs, err := func() ([]byte, error) {
+				rc, err := l.Uncompressed()
+				if err != nil {
+					return nil, err
+				}
+				defer osx.Close(rc)
+				return io.ReadAll(rc)
+			}()
+			if err != nil {
+				return nil, fmt.Errorf("reading attestation layer: %w", err)
+			}
+			ats = append(ats, bs)
+		}
+	}
+	if len(ats) == 0 {
+		return nil, errors.New("no attestations found")
+	}
+	return ats, nil
+}
+
+const mediaTypeInToto = "application/vnd.in-toto+json"
+
 func retrieveConfigByPath(cfp string) (cf specs.Image, err error) {
 	cfBs, err := os.ReadFile(cfp)
 	if err != nil {
 		return cf, fmt.Errorf("reading model config: %w", err)
 	}
-	if err = json.Unmarshal(cfBs, &cf); err != nil {
-		return cf, fmt.Errorf("unmarshalling model config: %w", err)
+	return specs.ParseImage(cfBs)
+}
+
+// inflateConfig fills all summarized GGUF files of the given config,
+// the given function is used to read the content of the detail.
+func inflateConfig(cf *specs.Image, read func(d specs.Descriptor) ([]byte, error)) error {
+	cfg := cf.Config
+	for _, gf := range append([]*specs.GGUFFile{cfg.Model, cfg.Drafter, cfg.Projector}, cfg.Adapters...) {
+		if gf == nil || !gf.IsSummarized() {
+			continue
+		}
+		bs, err := read(*gf.Detail)
+		if err != nil {
+			return fmt.Errorf("reading detail %s: %w", gf.Detail.Path, err)
+		}
+		if err = gf.Inflate(bs); err != nil {
+			return fmt.Errorf("inflating detail %s: %w", gf.Detail.Path, err)
+		}
+	}
+	return nil
+}
+
+// retrieveDetailsByOCIImage returns a function to read the detail from the last layer of the given image,
+// the last layer is fetched at most once.
+func retrieveDetailsByOCIImage(img conreg.Image) func(d specs.Descriptor) ([]byte, error) {
+	var (
+		once sync.Once
+		fs   map[string][]byte
+		err  error
+	)
+	return func(d specs.Descriptor) ([]byte, error) {
+		once.Do(func() {
+			var ls []conreg.Layer
+			ls, err = img.Layers()
+			if err != nil {
+				err = fmt.Errorf("retrieving image layers: %w", err)
+				return
+			}
+			if len(ls) == 0 {
+				err = errors.New("empty image layers")
+				return
+			}
+			fs, err = readTarFiles(ls[len(ls)-1], specs.DetailDir)
+		})
+		if err != nil {
+			return nil, err
+		}
+		bs, ok := fs[d.Path]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return bs, nil
+	}
+}
+
+// readTarFiles reads all regular files under the given directory of the layer.
+func readTarFiles(l conreg.Layer, dir string) (map[string][]byte, error) {
+	rc, err := l.Uncompressed()
+	if err != nil {
+		return nil, fmt.Errorf("reading layer contents: %w", err)
+	}
+	defer osx.Close(rc)
+
+	fs := map[string][]byte{}
+	tr := tar.NewReader(rc)
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("reading layer entry: %w", err)
+		}
+		n := path.Clean(strings.TrimPrefix(h.Name, "./"))
+		if h.Typeflag != tar.TypeReg || !strings.HasPrefix(n, dir+"/") {
+			continue
+		}
+		bs, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("reading layer entry %s: %w", n, err)
+		}
+		fs[n] = bs
+	}
+	if cl, ok := rc.(cacheLayerReadCloser); ok {
+		// Drain the remaining contents before completing the cache.
+		if _, err = io.Copy(io.Discard, rc); err != nil {
+			return nil, fmt.Errorf("reading layer contents: %w", err)
+		}
+		if err = cl.Complete(); err != nil {
+			return nil, fmt.Errorf("completing layer: %w", err)
+		}
 	}
-	if !isConfigAvailable(&cf) {
-		return cf, errors.New("unavailable model config")
+	return fs, nil
+}
+
+// ggufSourceFlags holds the flags to supply the auxiliary GGUF files,
+// which are used when the model is a GGUF source instead of a model reference.
+type ggufSourceFlags struct {
+	draft  string
+	mmproj string
+	loras  []string
+}
+
+func (f *ggufSourceFlags) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&f.draft, "draft", f.draft, "Specify the drafter GGUF file, directory or URL, "+
+		"only works if the model is a GGUF source.")
+	fs.StringVar(&f.mmproj, "mmproj", f.mmproj, "Specify the projector GGUF file or URL, "+
+		"only works if the model is a GGUF source.")
+	fs.StringSliceVar(&f.loras, "lora", f.loras, "Specify the adapter GGUF files or URLs, "+
+		"only works if the model is a GGUF source.")
+}
+
+// isGGUFSource returns true if the given model is a GGUF file, directory or URL,
+// rather than a model reference.
+//
+// A local path must be marked explicitly, i.e. a .gguf file, or a path starting with ./, ../, / or ~/,
+// so that a model reference is never shadowed by a same-named file or directory of the working directory.
+func isGGUFSource(model string) bool {
+	switch {
+	case strings.HasPrefix(model, "file://"),
+		strings.HasPrefix(model, "http://"),
+		strings.HasPrefix(model, "https://"),
+		strings.HasSuffix(model, ".gguf"):
+		return true
+	case model == ".", model == "..",
+		strings.HasPrefix(model, "./"),
+		strings.HasPrefix(model, "../"),
+		strings.HasPrefix(model, "~/"),
+		filepath.IsAbs(model):
+		return true
+	case filepath.Separator != '/' && (strings.HasPrefix(model, `.\`) || strings.HasPrefix(model, `..\`)):
+		return true
+	}
+	return false
+}
+
+// retrieveConfigByGGUFSource parses the given GGUF source and the auxiliaries of the flags,
+// and returns a config as if they are packed.
+//
+// A GGUF source can be a local file, a directory, a file:// URL or a HTTP(S) URL,
+// the first shard is enough for a split set.
+// A directory is scanned for the model, projector and adapters by their general.type,
+// which can be overridden by the flags.
+func retrieveConfigByGGUFSource(ctx context.Context, inflate, insecure bool, model string, gsf ggufSourceFlags) (cf specs.Image, err error) {
+	ropts := []ggufparser.GGUFReadOption{
+		ggufparser.UseMMap(),
+	}
+	if insecure {
+		ropts = append(ropts, ggufparser.SkipTLSVerification())
+	}
+
+	parse := func(src string) (*specs.GGUFFile, error) {
+		var (
+			gf  *ggufparser.GGUFFile
+			err error
+		)
+		switch {
+		case strings.HasPrefix(src, "http://"), strings.HasPrefix(src, "https://"):
+			gf, err = ggufparser.ParseGGUFFileRemote(ctx, src, ropts...)
+		default:
+			gf, err = ggufparser.ParseGGUFFile(osx.InlineTilde(strings.TrimPrefix(src, "file://")), ropts...)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing GGUF file %s: %w", src, err)
+		}
+		m := gf.Metadata()
+		sgf := *gf
+		if !inflate {
+			sgf = specs.SummarizeGGUFFile(sgf)
+		}
+		return &specs.GGUFFile{
+			GGUFFile:          sgf,
+			Architecture:      m.Architecture,
+			Parameters:        m.Parameters,
+			BitsPerWeight:     m.BitsPerWeight,
+			FileType:          m.FileType,
+			CmdParameterValue: src,
+		}, nil
+	}
+
+	cfg := &cf.Config
+	if dir := osx.InlineTilde(strings.TrimPrefix(model, "file://")); osx.ExistsDir(dir) {
+		es, err := os.ReadDir(dir)
+		if err != nil {
+			return cf, fmt.Errorf("reading directory %s: %w", dir, err)
+		}
+		for _, e := range es {
+			n := e.Name()
+			if e.IsDir() || filepath.Ext(n) != ".gguf" {
+				continue
+			}
+			// Skip the rest shards of a split set.
+			if m := ggufparser.ShardGGUFFilenameRegex.FindStringSubmatch(n); m != nil &&
+				m[ggufparser.ShardGGUFFilenameRegex.SubexpIndex("Shard")] != "00001" {
+				continue
+			}
+			gf, err := parse(filepath.Join(dir, n))
+			if err != nil {
+				return cf, err
+			}
+			switch gf.GGUFFile.Architecture().Type {
+			case "projector":
+				if cfg.Projector != nil {
+					return cf, fmt.Errorf("multiple projectors found in %s, specify by --mmproj instead", dir)
+				}
+				cfg.Projector = gf
+			case "adapter":
+				cfg.Adapters = append(cfg.Adapters, gf)
+			default:
+				if cfg.Model != nil {
+					return cf, fmt.Errorf("multiple models found in %s, specify the file instead", dir)
+				}
+				cfg.Model = gf
+			}
+		}
+		if cfg.Model == nil {
+			return cf, fmt.Errorf("no model found in %s", dir)
+		}
+	} else if cfg.Model, err = parse(model); err != nil {
+		return cf, err
+	}
+
+	if gsf.draft != "" {
+		if cfg.Drafter, err = parse(gsf.draft); err != nil {
+			return cf, err
+		}
+	}
+	if gsf.mmproj != "" {
+		if cfg.Projector, err = parse(gsf.mmproj); err != nil {
+			return cf, err
+		}
+	}
+	if len(gsf.loras) != 0 {
+		cfg.Adapters = cfg.Adapters[:0]
+		for _, l := range gsf.loras {
+			gf, err := parse(l)
+			if err != nil {
+				return cf, err
+			}
+			cfg.Adapters = append(cfg.Adapters, gf)
+		}
+	}
+	for _, gf := range append([]*specs.GGUFFile{cfg.Model, cfg.Drafter, cfg.Projector}, cfg.Adapters...) {
+		if gf != nil {
+			cfg.Size += gf.Size
+		}
 	}
 	return cf, nil
 }
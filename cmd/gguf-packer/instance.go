@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gpustack/gguf-packer-go/util/osx"
+)
+
+// runInstance holds a model instance started by run --detach.
+type runInstance struct {
+	ID         string     `json:"id"`
+	Model      string     `json:"model"`
+	ModelID    string     `json:"modelID"`
+	Runtime    string     `json:"runtime"`
+	Engine     string     `json:"engine,omitempty"`
+	Container  string     `json:"container,omitempty"`
+	PID        int        `json:"pid,omitempty"`
+	PIDStarted uint64     `json:"pidStarted,omitempty"`
+	Host       string     `json:"host,omitempty"`
+	Port       int        `json:"port,omitempty"`
+	HealthPath string     `json:"healthPath,omitempty"`
+	Command    []string   `json:"command"`
+	Created    *time.Time `json:"created,omitempty"`
+}
+
+func getRunsStorePath() string {
+	return filepath.Join(storePath, "runs")
+}
+
+// getRunInstanceStorePath returns the directory of the given instance,
+// which holds the instance record, the log of the binary and the generated runtime files.
+func getRunInstanceStorePath(id string) string {
+	return filepath.Join(getRunsStorePath(), id)
+}
+
+func getRunInstanceLogPath(id string) string {
+	return filepath.Join(getRunInstanceStorePath(id), "log")
+}
+
+func saveRunInstance(ri runInstance) error {
+	bs, err := json.MarshalIndent(ri, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling instance: %w", err)
+	}
+	if err = osx.WriteFile(filepath.Join(getRunInstanceStorePath(ri.ID), "instance.json"), bs, 0644); err != nil {
+		return fmt.Errorf("writing instance: %w", err)
+	}
+	return nil
+}
+
+// loadRunInstances returns all recorded instances, ordered by created time.
+func loadRunInstances() ([]runInstance, error) {
+	des, err := os.ReadDir(getRunsStorePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading instances: %w", err)
+	}
+	ris := make([]runInstance, 0, len(des))
+	for _, de := range des {
+		if !de.IsDir() {
+			continue
+		}
+		p := filepath.Join(getRunsStorePath(), de.Name(), "instance.json")
+		bs, err := os.ReadFile(p)
+		if err != nil {
+			// Skip the incomplete instance.
+			continue
+		}
+		var ri runInstance
+		if err = json.Unmarshal(bs, &ri); err != nil {
+			return nil, fmt.Errorf("parsing instance %s: %w", p, err)
+		}
+		ris = append(ris, ri)
+	}
+	sort.SliceStable(ris, func(i, j int) bool {
+		if ris[i].Created == nil || ris[j].Created == nil {
+			return ris[i].Created != nil
+		}
+		return ris[i].Created.Before(*ris[j].Created)
+	})
+	return ris, nil
+}
+
+// getRunInstance returns the instance of the given ID or unique ID prefix.
+func getRunInstance(id string) (runInstance, error) {
+	ris, err := loadRunInstances()
+	if err != nil {
+		return runInstance{}, err
+	}
+	var m []runInstance
+	for _, ri := range ris {
+		if ri.ID == id {
+			return ri, nil
+		}
+		if strings.HasPrefix(ri.ID, id) {
+			m = append(m, ri)
+		}
+	}
+	switch len(m) {
+	case 0:
+		return runInstance{}, fmt.Errorf("instance %q not found", id)
+	case 1:
+		return m[0], nil
+	}
+	return runInstance{}, fmt.Errorf("instance %q is ambiguous", id)
+}
+
+func removeRunInstance(id string) error {
+	if err := os.RemoveAll(getRunInstanceStorePath(id)); err != nil {
+		return fmt.Errorf("removing instance: %w", err)
+	}
+	return nil
+}
+
+// isProcessAlive returns true if the process of the instance is alive,
+// the start time of the process is compared if recorded,
+// so that a process reusing the PID is not regarded as the instance.
+func (ri runInstance) isProcessAlive() bool {
+	if !isProcessAlive(ri.PID) {
+		return false
+	}
+	if ri.PIDStarted == 0 {
+		return true
+	}
+	st, err := getProcessStartTime(ri.PID)
+	return err != nil || st == ri.PIDStarted
+}
+
+// State returns the state of the instance,
+// running, exited, or the container status reported by the engine.
+func (ri runInstance) State(ctx context.Context) string {
+	if ri.Container == "" {
+		return tenary(ri.isProcessAlive(), "running", "exited").(string)
+	}
+	bs, err := exec.
+		CommandContext(ctx, ri.Engine, "inspect", "--format", "{{.State.Status}}", ri.Container).
+		Output()
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(bs))
+}
+
+// Stop stops the instance, and removes the container if any.
+func (ri runInstance) Stop(ctx context.Context) error {
+	if ri.Container == "" {
+		if !ri.isProcessAlive() {
+			return nil
+		}
+		return terminateProcess(ri.PID)
+	}
+	bs, err := exec.
+		CommandContext(ctx, ri.Engine, "rm", "--force", ri.Container).
+		CombinedOutput()
+	if err != nil && !strings.Contains(strings.ToLower(string(bs)), "no such container") {
+		return fmt.Errorf("removing container %s: %s", ri.Container, strings.TrimSpace(string(bs)))
+	}
+	return nil
+}
+
+// errRunInstanceExited is returned if the instance exits before it is healthy.
+var errRunInstanceExited = errors.New("instance exited")
+
+// waitRunInstanceHealthy waits until the health endpoint of the instance responds OK,
+// returns errRunInstanceExited if the instance is not running anymore.
+func waitRunInstanceHealthy(ctx context.Context, ri runInstance, alive func() bool) error {
+	if ri.Port == 0 || ri.HealthPath == "" {
+		return nil
+	}
+	return waitHealthy(ctx, getLocalURL(ri.Host, ri.Port)+ri.HealthPath, alive)
+}
+
+// getLocalURL returns the URL of the given port listened on the given address,
+// which is the loopback if the address is empty or unspecified.
+func getLocalURL(addr string, port int) string {
+	if ip := net.ParseIP(addr); addr == "" || ip != nil && ip.IsUnspecified() {
+		addr = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(addr, strconv.Itoa(port))
+}
+
+// waitHealthy waits until the given health URL responds OK,
+// returns errRunInstanceExited if the given function reports the server is not running anymore,
+// nil function means the server is always running.
+func waitHealthy(ctx context.Context, u string, alive func() bool) error {
+	cli := &http.Client{Timeout: 5 * time.Second}
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return fmt.Errorf("creating health request: %w", err)
+		}
+		if resp, err := cli.Do(req); err == nil {
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		if alive != nil && !alive() {
+			return errRunInstanceExited
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// getProcessStartTime returns the start time of the given process,
+// in microseconds since the epoch.
+func getProcessStartTime(pid int) (uint64, error) {
+	kp, err := unix.SysctlKinfoProc("kern.proc.pid", pid)
+	if err != nil {
+		return 0, err
+	}
+	st := kp.Proc.P_starttime
+	return uint64(st.Sec)*1e6 + uint64(st.Usec), nil
+}
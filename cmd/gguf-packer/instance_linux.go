@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// getProcessStartTime returns the start time of the given process,
+// in clock ticks since the boot, see proc(5).
+func getProcessStartTime(pid int) (uint64, error) {
+	bs, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+	// The command name is parenthesized and may contain spaces,
+	// so the fields are counted from the last parenthesis, which ends the second field.
+	i := bytes.LastIndexByte(bs, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("parsing /proc/%d/stat: malformed", pid)
+	}
+	fs := bytes.Fields(bs[i+1:])
+	// The start time is the 22nd field.
+	if len(fs) < 20 {
+		return 0, fmt.Errorf("parsing /proc/%d/stat: too few fields", pid)
+	}
+	return strconv.ParseUint(string(fs[19]), 10, 64)
+}
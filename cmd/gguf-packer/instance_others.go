@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+// getProcessStartTime returns the start time of the given process,
+// which is not detected on this platform, so zero is returned to skip the comparison.
+func getProcessStartTime(pid int) (uint64, error) {
+	return 0, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// detachedProcAttr starts the process in a new process group,
+// so it is not interrupted by the signals of the console.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+func isProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
+
+// terminateProcess terminates the process tree of the given process,
+// so that the children are terminated as well.
+func terminateProcess(pid int) error {
+	bs, err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("killing process %d: %s", pid, strings.TrimSpace(string(bs)))
+	}
+	return nil
+}
+
+// getProcessStartTime returns the creation time of the given process,
+// in 100-nanosecond intervals since January 1, 1601.
+func getProcessStartTime(pid int) (uint64, error) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = windows.CloseHandle(h) }()
+	var c, e, k, u windows.Filetime
+	if err = windows.GetProcessTimes(h, &c, &e, &k, &u); err != nil {
+		return 0, err
+	}
+	return uint64(c.HighDateTime)<<32 | uint64(c.LowDateTime), nil
+}
@@ -0,0 +1,603 @@
+package main
+
+import (
+	"archive/tar"
+	"cmp"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	conreg "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/gpustack/gguf-packer-go/util/osx"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// lazyChunkSize is the size of a range request.
+	lazyChunkSize = 16 << 20
+	// lazyJobs is the number of the parallel range requests.
+	lazyJobs = 4
+	// lazyIndexBufferSize is the read-ahead size of indexing the layers,
+	// which covers a tar header and the next one of a small file.
+	lazyIndexBufferSize = 64 << 10
+)
+
+// errLazyUnsupported is returned if the model cannot be streamed,
+// e.g. the layers are compressed, or the registry does not support range requests.
+var errLazyUnsupported = errors.New("lazy pull is not supported")
+
+// lazyState is the state of streaming the model files,
+// which is stored next to the layers store path until all files are fetched and verified.
+type lazyState struct {
+	ChunkSize int64      `json:"chunkSize"`
+	Files     []lazyFile `json:"files"`
+}
+
+// lazyFile is a regular file of a layer.
+type lazyFile struct {
+	// Layer is the digest of the layer.
+	Layer string `json:"layer"`
+	// Path is the slash-separated path of the file.
+	Path string `json:"path"`
+	// Mode is the permission bits of the file.
+	Mode os.FileMode `json:"mode"`
+	// Offset is the offset of the file content in the layer.
+	Offset int64 `json:"offset"`
+	// Size is the size of the file.
+	Size int64 `json:"size"`
+	// Done is the bitset of the fetched chunks.
+	Done []uint64 `json:"done,omitempty"`
+}
+
+func (f *lazyFile) chunks(cs int64) int {
+	return int((f.Size + cs - 1) / cs)
+}
+
+func (f *lazyFile) isDone(i int) bool {
+	return i/64 < len(f.Done) && f.Done[i/64]&(1<<(i%64)) != 0
+}
+
+func (f *lazyFile) setDone(i int) {
+	for i/64 >= len(f.Done) {
+		f.Done = append(f.Done, 0)
+	}
+	f.Done[i/64] |= 1 << (i % 64)
+}
+
+// getLazyStatePath returns the state path of the given layers store path.
+func getLazyStatePath(lsp string) string {
+	return lsp + ".lazy"
+}
+
+// isLazyLayers returns true if the given layers store path is streamed partially.
+func isLazyLayers(lsp string) bool {
+	return osx.ExistsFile(getLazyStatePath(lsp))
+}
+
+// isLazyModel returns true if the model files of the given metadata store path are streamed partially.
+func isLazyModel(mdp string) bool {
+	cfp, err := os.Readlink(mdp)
+	return err == nil && isLazyLayers(convertConfigStorePathToLayersStorePath(cfp))
+}
+
+// pullLazily pulls the given model by streaming its files via range requests,
+// and falls back to pull if the model cannot be streamed.
+//
+// The model is linked after all files are fetched and verified,
+// so that the runtime never reads a partial file.
+func pullLazily(c *cobra.Command, app, model string) error {
+	cos := crane.GetOptions(getAuthnKeychainOption())
+	rf, err := name.NewTag(model, cos.Name...)
+	if err != nil {
+		return fmt.Errorf("parsing model reference %q: %w", model, err)
+	}
+	if mdp := getModelMetadataStorePath(rf); osx.ExistsLink(mdp) && !isLazyModel(mdp) {
+		return nil
+	}
+
+	rd, err := remote.Get(rf, cos.Remote...)
+	if err != nil {
+		return fmt.Errorf("getting model remote %q: %w", rf.Name(), err)
+	}
+	img, err := retrieveOCIImage(rd)
+	if err != nil {
+		return err
+	}
+	_, lsp, err := getModelConfigAndLayersStorePaths(img)
+	if err != nil {
+		return err
+	}
+	// Resume the model files streamed partially.
+	err = saveModel(c, rf, img, isLazyLayers(lsp), func(lsp string) error {
+		return fetchLazyLayers(c, rf, cos, img, lsp)
+	})
+	if !errors.Is(err, errLazyUnsupported) {
+		return err
+	}
+	fprintf(c.ErrOrStderr(), "%v, pulling the whole model\n", err)
+	return pull(app).RunE(c, []string{model})
+}
+
+// fetchLazyLayers streams the regular files of the uncompressed layers of the given image into the given layers store path,
+// the files are preallocated sparsely and filled by range requests of the layer blobs,
+// the first chunk of each file comes first, which holds the GGUF metadata.
+//
+// The files are verified against the layer digests after all chunks are fetched.
+func fetchLazyLayers(c *cobra.Command, rf name.Reference, cos crane.Options, img conreg.Image, lsp string) error {
+	lf, err := newLazyFetcher(c.Context(), rf, cos, img, lsp)
+	if err != nil {
+		return err
+	}
+	firsts, rests, total, fetched := lf.chunks()
+
+	pb := newProgressBar(c, total, "[lazy]")
+	_ = pb.Set64(fetched)
+	defer func() { _ = pb.Clear() }()
+
+	if err = lf.fetch(c.Context(), append(firsts, rests...), func(n int64) { _ = pb.Add64(n) }); err != nil {
+		return err
+	}
+	return lf.verify(c.Context())
+}
+
+// lazyFetcher fetches the chunks of the files streamed into a layers store path,
+// and records the fetched chunks in a state file next to the layers store path,
+// so that an interrupted streaming is resumed by the next run --lazy-pull or pull.
+type lazyFetcher struct {
+	cli *lazyClient
+	img conreg.Image
+	lsp string
+	stp string
+
+	mu    sync.Mutex
+	st    lazyState
+	saved time.Time
+}
+
+// lazyChunk is a chunk of a file of the state.
+type lazyChunk struct {
+	file, index int
+}
+
+// newLazyFetcher returns the fetcher of the given layers store path,
+// the layers are indexed if the state is not found.
+func newLazyFetcher(ctx context.Context, rf name.Reference, cos crane.Options, img conreg.Image, lsp string) (*lazyFetcher, error) {
+	cli, err := newLazyClient(ctx, rf.Context(), cos)
+	if err != nil {
+		return nil, err
+	}
+
+	lf := &lazyFetcher{cli: cli, img: img, lsp: lsp, stp: getLazyStatePath(lsp), saved: time.Now()}
+	if bs, err := os.ReadFile(lf.stp); err == nil {
+		if err = json.Unmarshal(bs, &lf.st); err != nil {
+			return nil, fmt.Errorf("parsing lazy state %s: %w", lf.stp, err)
+		}
+		return lf, nil
+	}
+	if lf.st, err = indexLazyLayers(ctx, cli, img, lsp); err != nil {
+		return nil, err
+	}
+	if err = saveLazyState(lf.stp, &lf.st); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+// chunks returns the first chunks of the files and the rest chunks in order to fetch,
+// and the total and fetched size in bytes.
+func (lf *lazyFetcher) chunks() (firsts, rests []lazyChunk, total, fetched int64) {
+	cs := lf.st.ChunkSize
+	for i := range lf.st.Files {
+		f := &lf.st.Files[i]
+		total += f.Size
+		for j, n := 0, f.chunks(cs); j < n; j++ {
+			switch {
+			case f.isDone(j):
+				fetched += min(cs, f.Size-int64(j)*cs)
+			case j == 0:
+				firsts = append(firsts, lazyChunk{file: i, index: j})
+			default:
+				rests = append(rests, lazyChunk{file: i, index: j})
+			}
+		}
+	}
+	return firsts, rests, total, fetched
+}
+
+// fetch fetches the given chunks in parallel, and calls the given function with the size of each fetched chunk,
+// the state is saved every second and at last.
+func (lf *lazyFetcher) fetch(ctx context.Context, cks []lazyChunk, add func(n int64)) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	cs := lf.st.ChunkSize
+	ch := make(chan lazyChunk)
+	var wg sync.WaitGroup
+	for range min(lazyJobs, max(len(cks), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ck := range ch {
+				lf.mu.Lock()
+				f := lf.st.Files[ck.file]
+				lf.mu.Unlock()
+				off := int64(ck.index) * cs
+				n := min(cs, f.Size-off)
+				if err := lf.cli.fetch(ctx, &f, lf.lsp, off, n); err != nil {
+					cancel(err)
+					continue
+				}
+				add(n)
+
+				lf.mu.Lock()
+				lf.st.Files[ck.file].setDone(ck.index)
+				if time.Since(lf.saved) > time.Second {
+					if err := saveLazyState(lf.stp, &lf.st); err != nil {
+						cancel(err)
+					}
+					lf.saved = time.Now()
+				}
+				lf.mu.Unlock()
+			}
+		}()
+	}
+	for _, ck := range cks {
+		if ctx.Err() != nil {
+			break
+		}
+		ch <- ck
+	}
+	close(ch)
+	wg.Wait()
+
+	// Keep the fetched chunks for resuming.
+	err := context.Cause(ctx)
+	if serr := saveLazyState(lf.stp, &lf.st); serr != nil {
+		return errors.Join(err, serr)
+	}
+	return err
+}
+
+// verify verifies the files against the layer digests,
+// each layer is hashed with the file contents read locally and the rest, e.g. the tar headers, requested remotely.
+//
+// The chunks of the files of a mismatched layer are reset to be fetched again,
+// otherwise, the state is removed.
+func (lf *lazyFetcher) verify(ctx context.Context) error {
+	ls, err := lf.img.Layers()
+	if err != nil {
+		return fmt.Errorf("retrieving image layers: %w", err)
+	}
+	for i := range ls {
+		d, err := ls[i].Digest()
+		if err != nil {
+			return fmt.Errorf("getting layer digest: %w", err)
+		}
+		s, err := ls[i].Size()
+		if err != nil {
+			return fmt.Errorf("getting layer size: %w", err)
+		}
+		h, err := conreg.Hasher(d.Algorithm)
+		if err != nil {
+			return fmt.Errorf("verifying layer %q: %w", d, err)
+		}
+
+		var fs []*lazyFile
+		for j := range lf.st.Files {
+			if lf.st.Files[j].Layer == d.String() {
+				fs = append(fs, &lf.st.Files[j])
+			}
+		}
+		slices.SortFunc(fs, func(a, b *lazyFile) int {
+			return cmp.Compare(a.Offset, b.Offset)
+		})
+
+		var off int64
+		for _, f := range fs {
+			if err = lf.hashRemote(ctx, h, d.String(), off, f.Offset-off); err != nil {
+				return err
+			}
+			if err = lf.hashLocal(h, f); err != nil {
+				return err
+			}
+			off = f.Offset + f.Size
+		}
+		if err = lf.hashRemote(ctx, h, d.String(), off, s-off); err != nil {
+			return err
+		}
+
+		if hex.EncodeToString(h.Sum(nil)) != d.Hex {
+			for _, f := range fs {
+				f.Done = nil
+			}
+			if err = saveLazyState(lf.stp, &lf.st); err != nil {
+				return err
+			}
+			return fmt.Errorf("verifying layer %q: digest mismatch, the files are fetched again by the next pull", d)
+		}
+	}
+
+	if err = os.Remove(lf.stp); err != nil {
+		return fmt.Errorf("removing lazy state %s: %w", lf.stp, err)
+	}
+	return nil
+}
+
+// hashRemote writes the range of the given size at the given offset of the given layer to the given hash.
+func (lf *lazyFetcher) hashRemote(ctx context.Context, h hash.Hash, layer string, off, n int64) error {
+	if n <= 0 {
+		return nil
+	}
+	rc, err := lf.cli.get(ctx, layer, off, n)
+	if err != nil {
+		return err
+	}
+	defer osx.Close(rc)
+	if _, err = io.CopyN(h, rc, n); err != nil {
+		return fmt.Errorf("verifying layer %q: %w", layer, err)
+	}
+	return nil
+}
+
+// hashLocal writes the content of the given file to the given hash.
+func (lf *lazyFetcher) hashLocal(h hash.Hash, f *lazyFile) error {
+	p := filepath.Join(lf.lsp, filepath.FromSlash(f.Path))
+	fh, err := osx.Open(p)
+	if err != nil {
+		return fmt.Errorf("opening file %s: %w", p, err)
+	}
+	defer osx.Close(fh)
+	if _, err = io.CopyN(h, fh, f.Size); err != nil {
+		return fmt.Errorf("verifying file %s: %w", p, err)
+	}
+	return nil
+}
+
+// saveLazyState writes the given state to the given path.
+func saveLazyState(p string, st *lazyState) error {
+	bs, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("encoding lazy state: %w", err)
+	}
+	if err = osx.WriteFile(p, bs, 0644); err != nil {
+		return fmt.Errorf("writing lazy state %s: %w", p, err)
+	}
+	return nil
+}
+
+// indexLazyLayers indexes the regular files of the layers of the given image,
+// and creates the directories and the sparse files into the given layers store path.
+func indexLazyLayers(ctx context.Context, cli *lazyClient, img conreg.Image, lsp string) (lazyState, error) {
+	st := lazyState{ChunkSize: lazyChunkSize}
+
+	ls, err := img.Layers()
+	if err != nil {
+		return st, fmt.Errorf("retrieving image layers: %w", err)
+	}
+	for i := range ls {
+		mt, err := ls[i].MediaType()
+		if err != nil {
+			return st, fmt.Errorf("getting layer media type: %w", err)
+		}
+		switch mt {
+		case types.OCIUncompressedLayer, types.OCIUncompressedRestrictedLayer, types.DockerUncompressedLayer:
+		default:
+			return st, fmt.Errorf("%w: layer of %s is not uncompressed", errLazyUnsupported, mt)
+		}
+	}
+
+	idx := map[string]int{}
+	for i := range ls {
+		d, err := ls[i].Digest()
+		if err != nil {
+			return st, fmt.Errorf("getting layer digest: %w", err)
+		}
+		s, err := ls[i].Size()
+		if err != nil {
+			return st, fmt.Errorf("getting layer size: %w", err)
+		}
+
+		r := &lazyReader{ctx: ctx, cli: cli, layer: d.String(), size: s}
+		tr := tar.NewReader(r)
+		for {
+			h, err := tr.Next()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return st, fmt.Errorf("indexing layer %q: %w", d, err)
+			}
+			p := path.Clean(strings.TrimPrefix(h.Name, "/"))
+			if p == "." {
+				continue
+			}
+			if strings.HasPrefix(p, "../") || strings.HasPrefix(path.Base(p), ".wh.") {
+				return st, fmt.Errorf("%w: layer %q has entry %q", errLazyUnsupported, d, h.Name)
+			}
+			switch h.Typeflag {
+			case tar.TypeDir:
+				if err = os.MkdirAll(filepath.Join(lsp, filepath.FromSlash(p)), 0755); err != nil {
+					return st, fmt.Errorf("creating directory %s: %w", p, err)
+				}
+			case tar.TypeReg:
+				f := lazyFile{
+					Layer:  d.String(),
+					Path:   p,
+					Mode:   h.FileInfo().Mode().Perm(),
+					Offset: r.off,
+					Size:   h.Size,
+				}
+				// The file of the upper layer overrides.
+				if j, ok := idx[p]; ok {
+					st.Files[j] = f
+				} else {
+					idx[p] = len(st.Files)
+					st.Files = append(st.Files, f)
+				}
+			default:
+				return st, fmt.Errorf("%w: layer %q has non-regular entry %q", errLazyUnsupported, d, h.Name)
+			}
+		}
+	}
+
+	for _, f := range st.Files {
+		p := filepath.Join(lsp, filepath.FromSlash(f.Path))
+		fh, err := osx.CreateFile(p, f.Mode)
+		if err != nil {
+			return st, fmt.Errorf("creating file %s: %w", p, err)
+		}
+		err = fh.Truncate(f.Size)
+		osx.Close(fh)
+		if err != nil {
+			return st, fmt.Errorf("preallocating file %s: %w", p, err)
+		}
+	}
+	return st, nil
+}
+
+// lazyClient requests the ranges of the layer blobs of a repository.
+type lazyClient struct {
+	cli  *http.Client
+	repo name.Repository
+}
+
+// newLazyClient returns the client of the given repository,
+// which is authenticated as pull does.
+func newLazyClient(ctx context.Context, repo name.Repository, cos crane.Options) (*lazyClient, error) {
+	auth, err := cos.Keychain.Resolve(repo)
+	if err != nil {
+		return nil, fmt.Errorf("resolving authentication of %q: %w", repo.Name(), err)
+	}
+	rt := cos.Transport
+	if rt == nil {
+		rt = remote.DefaultTransport
+	}
+	t, err := transport.NewWithContext(ctx, repo.Registry, auth, rt, []string{repo.Scope(transport.PullScope)})
+	if err != nil {
+		return nil, fmt.Errorf("authenticating to %q: %w", repo.Name(), err)
+	}
+	return &lazyClient{cli: &http.Client{Transport: t}, repo: repo}, nil
+}
+
+// get requests the range of the given size at the given offset of the given layer,
+// the range must be served partially.
+func (c *lazyClient) get(ctx context.Context, layer string, off, n int64) (io.ReadCloser, error) {
+	u := url.URL{
+		Scheme: c.repo.Scheme(),
+		Host:   c.repo.RegistryStr(),
+		Path:   fmt.Sprintf("/v2/%s/blobs/%s", c.repo.RepositoryStr(), layer),
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	resp, err := c.cli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting layer %q: %w", layer, err)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		_ = resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return nil, fmt.Errorf("%w: registry %q does not support range requests", errLazyUnsupported, c.repo.RegistryStr())
+		}
+		return nil, fmt.Errorf("requesting layer %q: unexpected status %s", layer, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// fetch fetches the range of the given size at the given offset of the given file into the given layers store path.
+func (c *lazyClient) fetch(ctx context.Context, f *lazyFile, lsp string, off, n int64) error {
+	p := filepath.Join(lsp, filepath.FromSlash(f.Path))
+	fh, err := osx.OpenFile(p, os.O_WRONLY, f.Mode)
+	if err != nil {
+		return fmt.Errorf("opening file %s: %w", p, err)
+	}
+	defer osx.Close(fh)
+
+	rc, err := c.get(ctx, f.Layer, f.Offset+off, n)
+	if err != nil {
+		return err
+	}
+	defer osx.Close(rc)
+	w, err := io.Copy(io.NewOffsetWriter(fh, off), io.LimitReader(rc, n))
+	if err != nil {
+		return fmt.Errorf("fetching file %s: %w", p, err)
+	}
+	if w != n {
+		return fmt.Errorf("fetching file %s: short read %d of %d bytes", p, w, n)
+	}
+	return nil
+}
+
+// lazyReader is a seekable reader of a layer blob,
+// which reads ahead by range requests,
+// so that the tar reader seeks over the file contents instead of reading them.
+type lazyReader struct {
+	ctx   context.Context
+	cli   *lazyClient
+	layer string
+	size  int64
+
+	off    int64
+	buf    []byte
+	bufOff int64
+}
+
+func (r *lazyReader) Read(p []byte) (int, error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+	if r.off < r.bufOff || r.off >= r.bufOff+int64(len(r.buf)) {
+		n := min(lazyIndexBufferSize, r.size-r.off)
+		rc, err := r.cli.get(r.ctx, r.layer, r.off, n)
+		if err != nil {
+			return 0, err
+		}
+		buf := make([]byte, n)
+		_, err = io.ReadFull(rc, buf)
+		osx.Close(rc)
+		if err != nil {
+			return 0, fmt.Errorf("reading layer %q: %w", r.layer, err)
+		}
+		r.buf, r.bufOff = buf, r.off
+	}
+	n := copy(p, r.buf[r.off-r.bufOff:])
+	r.off += int64(n)
+	return n, nil
+}
+
+func (r *lazyReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.off = offset
+	return offset, nil
+}
@@ -1,45 +1,58 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/dustin/go-humanize"
 	"github.com/gpustack/gguf-packer-go/util/mapx"
 	"github.com/gpustack/gguf-packer-go/util/osx"
+	ggufparser "github.com/gpustack/gguf-parser-go"
 	"github.com/spf13/cobra"
 )
 
 func list(app string) *cobra.Command {
 	var (
-		fullID bool
+		fullID  bool
+		filters []string
+		sorts   []string
 	)
 	c := &cobra.Command{
 		Use:   "list",
 		Short: "List all local models.",
 		Example: sprintf(`  # List all local models
-  %s list`, app),
+  %s list
+
+  # List the local qwen2 models smaller than 5GiB
+  %[1]s list --filter arch=qwen2 --filter usage=text-to-text --filter "size<5GiB"
+
+  # List all local models by size in descending order
+  %[1]s list --sort -size
+
+  # List the names of all local models
+  %[1]s list --format template='{{.Name}}:{{.Tag}}'`, app),
 		Args: cobra.ExactArgs(0),
 		RunE: func(c *cobra.Command, args []string) error {
-			var (
-				hds = [][]any{
-					{
-						"Name",
-						"Tag",
-						"ID",
-						"Arch",
-						"Params",
-						"Bpw",
-						"Type",
-						"Usage",
-						"Created",
-						"Size",
-					},
+			lfs := make([]listFilter, len(filters))
+			for i := range filters {
+				lf, err := parseListFilter(filters[i])
+				if err != nil {
+					return err
+				}
+				lfs[i] = lf
+			}
+			for _, s := range sorts {
+				if !slices.Contains(listKeys, strings.TrimPrefix(s, "-")) {
+					return fmt.Errorf("--sort has invalid key %q, select from %v", s, listKeys)
 				}
-				bds [][]any
-			)
+			}
 
+			var lis []listItem
 			msdp := getModelsMetadataStorePath()
 			if osx.ExistsDir(msdp) {
 				_ = filepath.Walk(msdp, func(mdp string, info os.FileInfo, err error) error {
@@ -67,35 +80,251 @@ func list(app string) *cobra.Command {
 
 					mname := strings.TrimPrefix(filepath.Dir(mdp), msdp+string(filepath.Separator))
 					mtag := filepath.Base(mdp)
-					mid := filepath.Base(cfp)
-					arch := img.Config.Model.Architecture
-					params := img.Config.Model.Parameters
-					bpw := img.Config.Model.BitsPerWeight
-					fileType := img.Config.Model.FileType
-					usage := mapx.Value(img.Config.Labels, "gguf.model.usage", "unknown")
-					created := img.Created
-					size := img.Config.Size
-
-					bds = append(bds, []any{
-						sprintf(tenary(strings.HasPrefix(mname, dockerRegPrefix), mname[16:], mname)),
-						sprintf(tenary(strings.HasPrefix(mtag, oldPrefix), "<none>", mtag)),
-						sprintf(tenary(fullID, mid, mid[:12])),
-						sprintf(arch),
-						sprintf(params),
-						sprintf(bpw),
-						sprintf(fileType),
-						sprintf(usage),
-						sprintf(tenary(created != nil, humanize.Time(*created), "unknown")),
-						sprintf(size),
-					})
+					li := listItem{
+						Name:          tenary(strings.HasPrefix(mname, dockerRegPrefix), mname[16:], mname).(string),
+						Tag:           tenary(strings.HasPrefix(mtag, oldPrefix), "<none>", mtag).(string),
+						ID:            filepath.Base(cfp),
+						Architecture:  img.Config.Model.Architecture,
+						Parameters:    img.Config.Model.Parameters,
+						BitsPerWeight: img.Config.Model.BitsPerWeight,
+						FileType:      img.Config.Model.FileType.String(),
+						Usage:         mapx.Value(img.Config.Labels, "gguf.model.usage", "unknown"),
+						Created:       img.Created,
+						Size:          img.Config.Size,
+					}
+					for _, lf := range lfs {
+						if !lf.match(li) {
+							return nil
+						}
+					}
+					lis = append(lis, li)
 					return nil
 				})
 			}
 
-			tfprint(c.OutOrStdout(), false, hds, bds)
-			return nil
+			// Sort by the last key first, so that the first key is the primary one.
+			for i := len(sorts) - 1; i >= 0; i-- {
+				k, desc := strings.TrimPrefix(sorts[i], "-"), strings.HasPrefix(sorts[i], "-")
+				slices.SortStableFunc(lis, func(a, b listItem) int {
+					r := compareListValues(a.value(k), b.value(k))
+					return tenary(desc, -r, r).(int)
+				})
+			}
+
+			if lis == nil {
+				lis = []listItem{}
+			}
+			return render(c, lis, func() (hds, bds [][]any, border bool) {
+				hds = [][]any{
+					{
+						"Name",
+						"Tag",
+						"ID",
+						"Arch",
+						"Params",
+						"Bpw",
+						"Type",
+						"Usage",
+						"Created",
+						"Size",
+					},
+				}
+				bds = make([][]any, len(lis))
+				for i, li := range lis {
+					bds[i] = []any{
+						sprintf(li.Name),
+						sprintf(li.Tag),
+						sprintf(tenary(fullID, li.ID, li.ID[:12])),
+						sprintf(li.Architecture),
+						sprintf(li.Parameters),
+						sprintf(li.BitsPerWeight),
+						sprintf(li.FileType),
+						sprintf(li.Usage),
+						humanizeTime(li.Created),
+						sprintf(li.Size),
+					}
+				}
+				return hds, bds, false
+			})
 		},
 	}
 	c.Flags().BoolVar(&fullID, "full-id", false, "Display full model ID.")
+	c.Flags().StringArrayVar(&filters, "filter", filters, "Filter the models in form of KEY[=|!=|<|<=|>|>=]VALUE, "+
+		"select KEY from [name, tag, id, arch, params, bpw, type, usage, created, size], "+
+		"the string values support glob pattern, e.g. name=gpustack/*, "+
+		"the created value is a date or RFC 3339 time, e.g. created>2024-08-01. "+
+		"Multiple filters are combined with AND.")
+	c.Flags().StringSliceVar(&sorts, "sort", sorts, "Sort the models by the given keys, "+
+		"select from [name, tag, id, arch, params, bpw, type, usage, created, size], "+
+		"prefix with - to sort in descending order, e.g. -size.")
 	return c
 }
+
+// listItem holds the information of a local model.
+type listItem struct {
+	Name          string                             `json:"name"`
+	Tag           string                             `json:"tag"`
+	ID            string                             `json:"id"`
+	Architecture  string                             `json:"architecture"`
+	Parameters    ggufparser.GGUFParametersScalar    `json:"parameters"`
+	BitsPerWeight ggufparser.GGUFBitsPerWeightScalar `json:"bitsPerWeight"`
+	FileType      string                             `json:"fileType"`
+	Usage         string                             `json:"usage"`
+	Created       *time.Time                         `json:"created,omitempty"`
+	Size          ggufparser.GGUFBytesScalar         `json:"size"`
+}
+
+// listKeys are the keys to filter and sort the listItem.
+var listKeys = []string{"name", "tag", "id", "arch", "params", "bpw", "type", "usage", "created", "size"}
+
+// value returns the value of the given key,
+// which is a string or a float64.
+func (li listItem) value(key string) any {
+	switch key {
+	case "name":
+		return li.Name
+	case "tag":
+		return li.Tag
+	case "id":
+		return li.ID
+	case "arch":
+		return li.Architecture
+	case "params":
+		return float64(li.Parameters)
+	case "bpw":
+		return float64(li.BitsPerWeight)
+	case "type":
+		return li.FileType
+	case "usage":
+		return li.Usage
+	case "created":
+		if li.Created == nil {
+			return float64(0)
+		}
+		return float64(li.Created.Unix())
+	case "size":
+		return float64(li.Size)
+	}
+	return nil
+}
+
+func compareListValues(a, b any) int {
+	switch av := a.(type) {
+	case string:
+		return strings.Compare(av, b.(string))
+	case float64:
+		bv := b.(float64)
+		switch {
+		case av < bv:
+			return -1
+		case av > bv:
+			return 1
+		}
+	}
+	return 0
+}
+
+// listFilter filters the listItem by comparing the value of the key.
+type listFilter struct {
+	key   string
+	op    string
+	value any
+}
+
+func parseListFilter(s string) (lf listFilter, err error) {
+	i := strings.IndexAny(s, "=!<>")
+	if i <= 0 {
+		return lf, fmt.Errorf("--filter %q must be in form of KEY[=|!=|<|<=|>|>=]VALUE", s)
+	}
+	lf.key, lf.op = s[:i], s[i:i+1]
+	if i+1 < len(s) && s[i+1] == '=' && lf.op != "=" {
+		lf.op += "="
+	}
+	v := s[i+len(lf.op):]
+	if lf.op == "!" {
+		return lf, fmt.Errorf("--filter %q has invalid operator", s)
+	}
+
+	switch lf.key {
+	default:
+		return lf, fmt.Errorf("--filter %q has invalid key, select from %v", s, listKeys)
+	case "name", "tag", "id", "arch", "type", "usage":
+		if lf.op != "=" && lf.op != "!=" {
+			return lf, fmt.Errorf("--filter %q only supports = and != for %s", s, lf.key)
+		}
+		if _, err = path.Match(v, ""); err != nil {
+			return lf, fmt.Errorf("--filter %q has invalid pattern: %w", s, err)
+		}
+		lf.value = v
+		return lf, nil
+	case "params":
+		var n float64
+		n, err = parseNumberWithUnit(v)
+		lf.value = n
+	case "bpw":
+		var n float64
+		n, err = strconv.ParseFloat(v, 64)
+		lf.value = n
+	case "size":
+		var n ggufparser.GGUFBytesScalar
+		n, err = ggufparser.ParseGGUFBytesScalar(v)
+		lf.value = float64(n)
+	case "created":
+		var t time.Time
+		if t, err = time.Parse(time.RFC3339, v); err != nil {
+			t, err = time.ParseInLocation(time.DateOnly, v, time.Local)
+		}
+		lf.value = float64(t.Unix())
+	}
+	if err != nil {
+		return lf, fmt.Errorf("--filter %q has invalid value: %w", s, err)
+	}
+	return lf, nil
+}
+
+func (lf listFilter) match(li listItem) bool {
+	v := li.value(lf.key)
+	if sv, ok := v.(string); ok {
+		m, _ := path.Match(lf.value.(string), sv)
+		if !m {
+			// Match the short ID.
+			m = lf.key == "id" && strings.HasPrefix(sv, lf.value.(string))
+		}
+		return m == (lf.op == "=")
+	}
+	r := compareListValues(v, lf.value)
+	switch lf.op {
+	case "=":
+		return r == 0
+	case "!=":
+		return r != 0
+	case "<":
+		return r < 0
+	case "<=":
+		return r <= 0
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	}
+	return false
+}
+
+// parseNumberWithUnit parses the number with the optional unit, select from [K, M, B, T], e.g. 7B.
+func parseNumberWithUnit(s string) (float64, error) {
+	b := float64(1)
+	for _, u := range []struct {
+		unit string
+		base float64
+	}{{"K", 1e3}, {"M", 1e6}, {"B", 1e9}, {"T", 1e12}} {
+		if strings.HasSuffix(strings.ToUpper(s), u.unit) {
+			s, b = s[:len(s)-1], u.base
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * b, nil
+}
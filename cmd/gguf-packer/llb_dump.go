@@ -123,8 +123,7 @@ func llbDump(app string) *cobra.Command {
 			}
 
 			if json {
-				jprint(w, ops)
-				return nil
+				return renderJSON(w, ops)
 			}
 
 			sb := &strings.Builder{}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func logs(app string) *cobra.Command {
+	var (
+		follow bool
+	)
+	c := &cobra.Command{
+		Use:   "logs INSTANCE",
+		Short: "Fetch the logs of a model instance started by run --detach.",
+		Example: sprintf(`  # Fetch the logs of a model instance by ID or ID prefix
+  %s logs 5f2e3c
+
+  # Follow the logs of a model instance
+  %[1]s logs 5f2e3c --follow`, app),
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			ri, err := getRunInstance(args[0])
+			if err != nil {
+				return err
+			}
+
+			// Delegate to the engine if running by container.
+			if ri.Container != "" {
+				cargs := []string{"logs"}
+				if follow {
+					cargs = append(cargs, "--follow")
+				}
+				cmd := exec.CommandContext(c.Context(), ri.Engine, append(cargs, ri.Container)...)
+				cmd.Stdout = c.OutOrStdout()
+				cmd.Stderr = c.ErrOrStderr()
+				return cmd.Run()
+			}
+
+			lf, err := os.Open(getRunInstanceLogPath(ri.ID))
+			if err != nil {
+				return fmt.Errorf("opening log file: %w", err)
+			}
+			defer func() { _ = lf.Close() }()
+			for {
+				if _, err = io.Copy(c.OutOrStdout(), lf); err != nil {
+					return fmt.Errorf("reading log file: %w", err)
+				}
+				if !follow || !ri.isProcessAlive() {
+					return nil
+				}
+				select {
+				case <-c.Context().Done():
+					return nil
+				case <-time.After(500 * time.Millisecond):
+				}
+			}
+		},
+	}
+	c.Flags().BoolVarP(&follow, "follow", "f", follow, "Follow the log output until the instance exits.")
+	return c
+}
@@ -1,19 +1,17 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
-	"strings"
+	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/gpustack/gguf-packer-go/util/anyx"
 	"github.com/gpustack/gguf-packer-go/util/osx"
 	"github.com/gpustack/gguf-packer-go/util/signalx"
-	"github.com/jedib0t/go-pretty/v6/table"
-	"github.com/jedib0t/go-pretty/v6/text"
 	"github.com/spf13/cobra"
 )
 
@@ -58,15 +56,33 @@ func main() {
   # Dump the BuildKit LLB of the current directory
   %[1]s llb-dump
 
+  # Build the model of the current directory via BuildKit
+  %[1]s build
+
   # Pull the model from the registry
   %[1]s pull gpustack/qwen2:0.5b-instruct
 
+  # List the tags of a model repository in the registry
+  %[1]s tags gpustack/qwen2
+
   # Inspect the model
   %[1]s inspect gpustack/qwen2:0.5b-instruct
 
+  # Show how the model was built
+  %[1]s history gpustack/qwen2:0.5b-instruct
+
+  # Show the differences between two models
+  %[1]s diff gpustack/qwen2:0.5b-instruct-q4-k-m gpustack/qwen2:0.5b-instruct-q5-k-m
+
   # Estimate the model memory usage
   %[1]s estimate gpustack/qwen2:0.5b-instruct
 
+  # Compare the memory usage of several models
+  %[1]s compare gpustack/qwen2:0.5b-instruct gpustack/qwen2:1.5b-instruct
+
+  # Detect the local devices as a profile for estimating and running
+  %[1]s devices detect
+
   # List all local models
   %[1]s list
 
@@ -74,10 +90,17 @@ func main() {
   %[1]s remove gpustack/qwen2:0.5b-instruct
 
   # Run a model by container container: ghcr.io/ggerganov/llama.cpp:server
-  %[1]s run gpustack/qwen2:0.5b-instruct`, app),
+  %[1]s run gpustack/qwen2:0.5b-instruct
+
+  # List the model instances started by run --detach
+  %[1]s ps
+
+  # Probe the readiness of a model started by run --detach
+  %[1]s probe gpustack/qwen2:0.5b-instruct`, app),
 	}
+	root.PersistentFlags().StringVar(&outputFormat, "format", outputFormat, formatUsage)
 	for _, cmdCreate := range []func(string) *cobra.Command{
-		llbFrontend, llbDump, inspect, pull, estimate, list, remove, run,
+		llbFrontend, llbDump, build, inspect, history, diff, pull, tags, search, estimate, compare, devices, list, remove, run, serve, generate, probe, ps, logs, stop,
 	} {
 		cmd := cmdCreate(app)
 		root.AddCommand(cmd)
@@ -116,48 +139,6 @@ func fprint(w io.Writer, a ...any) {
 	_, _ = fmt.Fprint(w, a...)
 }
 
-func tfprint(w io.Writer, border bool, headers, bodies [][]any) {
-	tw := table.NewWriter()
-	tw.SetOutputMirror(w)
-	for i := range headers {
-		tw.AppendHeader(headers[i], table.RowConfig{AutoMerge: true, AutoMergeAlign: text.AlignCenter})
-	}
-	for i := range bodies {
-		tw.AppendRow(bodies[i])
-	}
-	tw.SetColumnConfigs(func() (r []table.ColumnConfig) {
-		r = make([]table.ColumnConfig, len(headers[0]))
-		for i := range r {
-			r[i].Number = i + 1
-			r[i].AutoMerge = border
-			if len(headers) > 1 && (strings.HasPrefix(headers[1][i].(string), "Layers") || headers[1][i] == "UMA" || headers[1][i] == "NonUMA") {
-				r[i].AutoMerge = false
-			}
-			r[i].Align = text.AlignCenter
-			if !border {
-				r[i].Align = text.AlignLeft
-			}
-			r[i].AlignHeader = text.AlignCenter
-		}
-		return r
-	}())
-	{
-		tw.Style().Options.DrawBorder = border
-		tw.Style().Options.DrawBorder = border
-		tw.Style().Options.SeparateHeader = border
-		tw.Style().Options.SeparateFooter = border
-		tw.Style().Options.SeparateColumns = border
-		tw.Style().Options.SeparateRows = border
-	}
-	tw.Render()
-}
-
-func jprint(w io.Writer, v any) {
-	enc := json.NewEncoder(w)
-	enc.SetIndent("", "  ")
-	_ = enc.Encode(v)
-}
-
 func sprintf(format any, a ...any) string {
 	if v, ok := format.(string); ok {
 		if len(a) != 0 {
@@ -174,3 +155,10 @@ func tenary(c bool, t, f any) any {
 	}
 	return f
 }
+
+func humanizeTime(t *time.Time) string {
+	if t == nil {
+		return "unknown"
+	}
+	return humanize.Time(*t)
+}
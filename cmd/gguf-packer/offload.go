@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	specs "github.com/gpustack/gguf-packer-go/buildkit/frontend/specs/v1"
+	"github.com/gpustack/gguf-packer-go/llamacpp"
+	"github.com/gpustack/gguf-packer-go/util/osx"
+	"github.com/gpustack/gguf-packer-go/util/ptr"
+	ggufparser "github.com/gpustack/gguf-parser-go"
+)
+
+// GPUDetector detects the local GPUs and their free memory,
+// which is used by run --auto-offload.
+type GPUDetector interface {
+	// Name returns the name of the detector.
+	Name() string
+	// Detect returns the local GPUs, the VRAM of each GPU is its free memory.
+	Detect(ctx context.Context) ([]deviceProfileDevice, error)
+}
+
+// gpuDetectors are the available detectors, in order of detection,
+// the detector is available if its name is found in the PATH.
+var gpuDetectors = []GPUDetector{
+	nvidiaSMIDetector{},
+	rocmSMIDetector{},
+}
+
+// getGPUDetector returns the first available detector,
+// or the fake detector if GGUF_PACKER_FAKE_GPUS is set, e.g. 24GiB,24GiB,
+// nil if none is available.
+func getGPUDetector() GPUDetector {
+	if v := osx.ExpandEnv("GGUF_PACKER_FAKE_GPUS"); v != "" {
+		return fakeGPUDetector{vrams: strings.Split(v, ",")}
+	}
+	for _, d := range gpuDetectors {
+		if _, err := exec.LookPath(d.Name()); err == nil {
+			return d
+		}
+	}
+	return nil
+}
+
+// nvidiaSMIDetector detects the NVIDIA GPUs by nvidia-smi.
+type nvidiaSMIDetector struct{}
+
+func (nvidiaSMIDetector) Name() string {
+	return "nvidia-smi"
+}
+
+func (nvidiaSMIDetector) Detect(ctx context.Context) ([]deviceProfileDevice, error) {
+	bs, err := exec.
+		CommandContext(ctx, "nvidia-smi", "--query-gpu=name,memory.free", "--format=csv,noheader,nounits").
+		Output()
+	if err != nil {
+		return nil, fmt.Errorf("executing nvidia-smi: %w", err)
+	}
+	return parseNvidiaSMIOutput(bs)
+}
+
+// rocmSMIDetector detects the AMD GPUs by rocm-smi.
+type rocmSMIDetector struct{}
+
+func (rocmSMIDetector) Name() string {
+	return "rocm-smi"
+}
+
+func (rocmSMIDetector) Detect(ctx context.Context) ([]deviceProfileDevice, error) {
+	bs, err := exec.
+		CommandContext(ctx, "rocm-smi", "--showproductname", "--showmeminfo", "vram", "--csv").
+		Output()
+	if err != nil {
+		return nil, fmt.Errorf("executing rocm-smi: %w", err)
+	}
+	return parseROCmSMIOutput(bs, true)
+}
+
+// fakeGPUDetector returns the GPUs of the given free VRAMs,
+// which simulates the hardware without GPUs.
+type fakeGPUDetector struct {
+	vrams []string
+}
+
+func (fakeGPUDetector) Name() string {
+	return "fake"
+}
+
+func (d fakeGPUDetector) Detect(context.Context) ([]deviceProfileDevice, error) {
+	ds := make([]deviceProfileDevice, len(d.vrams))
+	for i := range d.vrams {
+		ds[i] = deviceProfileDevice{
+			Name: fmt.Sprintf("Fake GPU %d", i),
+			VRAM: strings.TrimSpace(d.vrams[i]),
+		}
+	}
+	return ds, nil
+}
+
+// autoOffloadMinContextSize is the minimum context size to reduce to,
+// a smaller context size is hardly useful, so the layers are partially offloaded instead.
+const autoOffloadMinContextSize = 2048
+
+// getAutoOffloadArgs returns the llama.cpp arguments which fit the model into the free VRAM of the given detector,
+// which are absent from the given arguments, and prints the choice and the reason to the given writer.
+func getAutoOffloadArgs(ctx context.Context, w io.Writer, d GPUDetector, cf specs.Image, lsp string, args []string) ([]string, error) {
+	a, err := llamacpp.ParseArgs(args)
+	if err != nil {
+		return nil, fmt.Errorf("parsing arguments: %w", err)
+	}
+	if a.GPULayers != nil {
+		fprintf(w, "Auto offload: skipped, the offload layers are given\n")
+		return nil, nil
+	}
+	if d == nil {
+		fprintf(w, "Auto offload: no GPU detector found, running on CPU\n")
+		return nil, nil
+	}
+
+	ds, err := d.Detect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(ds) == 0 {
+		fprintf(w, "Auto offload: no GPU detected by %s, running on CPU\n", d.Name())
+		return nil, nil
+	}
+	vrams := make([]ggufparser.GGUFBytesScalar, len(ds))
+	dss := make([]string, len(ds))
+	for i := range ds {
+		if vrams[i], err = ggufparser.ParseGGUFBytesScalar(ds[i].VRAM); err != nil {
+			return nil, fmt.Errorf("parsing free VRAM of %s: %w", ds[i].Name, err)
+		}
+		dss[i] = fmt.Sprintf("%s (%s free)", ds[i].Name, vrams[i])
+	}
+	fprintf(w, "Auto offload: detected %d GPUs by %s, %s\n", len(ds), d.Name(), strings.Join(dss, ", "))
+
+	err = inflateConfig(&cf, func(d specs.Descriptor) ([]byte, error) {
+		return os.ReadFile(filepath.Join(lsp, filepath.FromSlash(d.Path)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if cf.Config.Model == nil {
+		return nil, fmt.Errorf("model has no model file")
+	}
+	ef := newEstimateFlags()
+	ef.withArgs(a)
+	eopts, err := ef.options()
+	if err != nil {
+		return nil, err
+	}
+	fo := estimateFitOptions{
+		OffloadLayersDraft: ptr.From(a.GPULayersDraft, -1),
+		MMap:               !ef.noMMap,
+		TensorSplit:        len(a.TensorSplit) != 0,
+		OffloadOnly:        true,
+		VRAMs:              vrams,
+	}
+	fo.PlatformRAM, fo.PlatformVRAM = ef.platformFootprints()
+
+	r, err := estimateFit(cf.Config, eopts, fo)
+	if err != nil {
+		r = nil
+	}
+
+	// Reduce the context size to offload all layers,
+	// unless the context size is given.
+	var cs uint64
+	if (r == nil || !r.Estimate.Items[0].FullOffloaded) && a.ContextSize == nil {
+		es := cf.Config.Model.EstimateLLaMACppRun(eopts...)
+		for c := es.ContextSize; c > autoOffloadMinContextSize; {
+			// Round down to the previous power of two.
+			n := uint64(1)
+			for n<<1 < c {
+				n <<= 1
+			}
+			c = max(n, autoOffloadMinContextSize)
+			cr, err := estimateFit(cf.Config, append(eopts[:len(eopts):len(eopts)], ggufparser.WithContextSize(int32(c))), fo)
+			if err != nil {
+				continue
+			}
+			if r == nil || cr.Estimate.Items[0].FullOffloaded {
+				// Prefer offloading all layers, otherwise offloading any layer.
+				cs, r = es.ContextSize, cr
+			}
+			if cr.Estimate.Items[0].FullOffloaded {
+				break
+			}
+		}
+	}
+	if r == nil {
+		fprintf(w, "Auto offload: chose -ngl 0, no layer fits the free VRAM\n")
+		return []string{"-ngl", "0"}, nil
+	}
+	total := cf.Config.Model.EstimateLLaMACppRun(append(eopts[:len(eopts):len(eopts)],
+		ggufparser.WithOffloadLayers(math.MaxUint64))...).SummarizeItem(fo.MMap, fo.PlatformRAM, fo.PlatformVRAM).OffloadLayers
+
+	oargs := r.Flags
+	var why string
+	if cs != 0 {
+		oargs = append(oargs, "-c", strconv.FormatUint(r.ContextSize, 10))
+	}
+	switch esi := r.Estimate.Items[0]; {
+	case cs != 0 && esi.FullOffloaded:
+		why = fmt.Sprintf("all %d layers fit the free VRAM after reducing the context size from %d to %d", total, cs, r.ContextSize)
+	case cs != 0:
+		why = fmt.Sprintf("only %d of %d layers fit the free VRAM after reducing the context size from %d to %d, the rest runs on CPU",
+			esi.OffloadLayers, total, cs, r.ContextSize)
+	case esi.FullOffloaded:
+		why = fmt.Sprintf("all %d layers fit the free VRAM", total)
+	default:
+		why = fmt.Sprintf("only %d of %d layers fit the free VRAM, the rest runs on CPU", esi.OffloadLayers, total)
+	}
+	vs := make([]string, 0, len(r.Estimate.Items[0].VRAMs))
+	for _, v := range r.Estimate.Items[0].VRAMs {
+		if !v.Remote {
+			vs = append(vs, v.NonUMA.String())
+		}
+	}
+	fprintf(w, "Auto offload: chose %s, %s, using %s VRAM\n", strings.Join(oargs, " "), why, strings.Join(vs, " / "))
+	return oargs, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	specs "github.com/gpustack/gguf-packer-go/buildkit/frontend/specs/v1"
+	ggufparser "github.com/gpustack/gguf-parser-go"
+)
+
+// newOffloadTestImage returns the config of a synthetic F16 LLaMA model,
+// which has 32 blocks of 7B and a context size of 32768, about 14GB.
+func newOffloadTestImage() specs.Image {
+	const (
+		blocks   = 32
+		embd     = 4096
+		ff       = 14336
+		kv       = 1024
+		vocab    = 32000
+		ctx      = 32768
+		heads    = 32
+		headsKV  = 8
+		f16Bytes = 2
+	)
+	kvs := ggufparser.GGUFMetadataKVs{
+		{Key: "general.architecture", ValueType: ggufparser.GGUFMetadataValueTypeString, Value: "llama"},
+		{Key: "general.name", ValueType: ggufparser.GGUFMetadataValueTypeString, Value: "offload"},
+		{Key: "llama.block_count", ValueType: ggufparser.GGUFMetadataValueTypeUint32, Value: uint32(blocks)},
+		{Key: "llama.context_length", ValueType: ggufparser.GGUFMetadataValueTypeUint32, Value: uint32(ctx)},
+		{Key: "llama.embedding_length", ValueType: ggufparser.GGUFMetadataValueTypeUint32, Value: uint32(embd)},
+		{Key: "llama.feed_forward_length", ValueType: ggufparser.GGUFMetadataValueTypeUint32, Value: uint32(ff)},
+		{Key: "llama.attention.head_count", ValueType: ggufparser.GGUFMetadataValueTypeUint32, Value: uint32(heads)},
+		{Key: "llama.attention.head_count_kv", ValueType: ggufparser.GGUFMetadataValueTypeUint32, Value: uint32(headsKV)},
+	}
+
+	var (
+		tis    ggufparser.GGUFTensorInfos
+		offset uint64
+		params uint64
+	)
+	add := func(name string, dims ...uint64) {
+		tis = append(tis, ggufparser.GGUFTensorInfo{
+			Name:        name,
+			NDimensions: uint32(len(dims)),
+			Dimensions:  dims,
+			Type:        ggufparser.GGMLTypeF16,
+			Offset:      offset,
+		})
+		n := uint64(1)
+		for _, d := range dims {
+			n *= d
+		}
+		offset += n * f16Bytes
+		params += n
+	}
+	add("token_embd.weight", embd, vocab)
+	for i := 0; i < blocks; i++ {
+		p := "blk." + sprintf(i) + "."
+		add(p+"attn_q.weight", embd, embd)
+		add(p+"attn_k.weight", embd, kv)
+		add(p+"attn_v.weight", embd, kv)
+		add(p+"attn_output.weight", embd, embd)
+		add(p+"ffn_gate.weight", embd, ff)
+		add(p+"ffn_up.weight", embd, ff)
+		add(p+"ffn_down.weight", ff, embd)
+	}
+	add("output.weight", embd, vocab)
+
+	gf := ggufparser.GGUFFile{
+		Header: ggufparser.GGUFHeader{
+			Magic:           ggufparser.GGUFMagicGGUFLe,
+			Version:         ggufparser.GGUFVersionV3,
+			TensorCount:     uint64(len(tis)),
+			MetadataKVCount: uint64(len(kvs)),
+			MetadataKV:      kvs,
+		},
+		TensorInfos:        tis,
+		Size:               ggufparser.GGUFBytesScalar(offset),
+		ModelSize:          ggufparser.GGUFBytesScalar(offset),
+		ModelParameters:    ggufparser.GGUFParametersScalar(params),
+		ModelBitsPerWeight: 16,
+	}
+	var cf specs.Image
+	cf.Config.Cmd = []string{"-m", "offload.gguf"}
+	cf.Config.Model = &specs.GGUFFile{GGUFFile: gf, CmdParameterValue: "offload.gguf", CmdParameterIndex: 1}
+	return cf
+}
+
+func TestGetAutoOffloadArgs(t *testing.T) {
+	cf := newOffloadTestImage()
+
+	testCases := []struct {
+		name     string
+		vrams    []string
+		args     []string
+		expected []string
+		reason   string
+	}{
+		{
+			name:     "full fit",
+			vrams:    []string{"48GiB"},
+			expected: []string{"-ngl", "33"},
+			reason:   "all 33 layers fit the free VRAM,",
+		},
+		{
+			name:     "full fit of multiple GPUs",
+			vrams:    []string{"24GiB", "24GiB"},
+			expected: []string{"-ngl", "33", "-ts", "24576,24576"},
+			reason:   "all 33 layers fit the free VRAM,",
+		},
+		{
+			name:     "context reduction",
+			vrams:    []string{"18GiB"},
+			expected: []string{"-ngl", "33", "-c", "16384"},
+			reason:   "after reducing the context size from 32768 to 16384",
+		},
+		{
+			name:     "partial fit",
+			vrams:    []string{"4GiB"},
+			expected: []string{"-ngl", "2"},
+			reason:   "only 2 of 33 layers fit the free VRAM, the rest runs on CPU",
+		},
+		{
+			name:     "partial fit of given context size",
+			vrams:    []string{"15GiB"},
+			args:     []string{"-c", "32768"},
+			expected: []string{"-ngl", "23"},
+			reason:   "only 23 of 33 layers fit the free VRAM, the rest runs on CPU",
+		},
+		{
+			name:     "no fit",
+			vrams:    []string{"100MiB"},
+			expected: []string{"-ngl", "0"},
+			reason:   "no layer fits the free VRAM",
+		},
+		{
+			name:   "ngl given",
+			vrams:  []string{"48GiB"},
+			args:   []string{"-ngl", "3"},
+			reason: "skipped, the offload layers are given",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var w bytes.Buffer
+			actual, err := getAutoOffloadArgs(context.Background(), &w, fakeGPUDetector{vrams: tc.vrams}, cf, "",
+				append(cf.Config.Cmd[:len(cf.Config.Cmd):len(cf.Config.Cmd)], tc.args...))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(actual, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, actual)
+			}
+			if !strings.Contains(w.String(), tc.reason) {
+				t.Errorf("expected reason %q, got %q", tc.reason, w.String())
+			}
+		})
+	}
+
+	t.Run("no GPU", func(t *testing.T) {
+		var w bytes.Buffer
+		actual, err := getAutoOffloadArgs(context.Background(), &w, fakeGPUDetector{}, cf, "", cf.Config.Cmd)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if actual != nil || !strings.Contains(w.String(), "running on CPU") {
+			t.Errorf("expected running on CPU, got %q: %s", actual, w.String())
+		}
+	})
+}
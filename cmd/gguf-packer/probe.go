@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func probe(app string) *cobra.Command {
+	var (
+		pf         = newProbeFlags()
+		model      string
+		usage      string
+		healthPath = "/health"
+	)
+	c := &cobra.Command{
+		Use:   "probe MODEL|URL",
+		Short: "Probe the readiness of a running model by a smoke request.",
+		Long: "Probe the readiness of a running model, " +
+			"which waits until the health endpoint responds OK, " +
+			"then issues a tiny completion, embedding or rerank request chosen by the gguf.model.usage label, " +
+			"and measures the time to first token and the tokens per second, " +
+			"the request is retried while the model is not found or unavailable. " +
+			"The model is probed through its instance started by run --detach, " +
+			"exits non-zero if the model is not ready in time or the request fails.",
+		Example: sprintf(`  # Probe the model started by run --detach
+  %s probe gpustack/qwen2:0.5b-instruct
+
+  # Probe the instance started by run --detach
+  %[1]s probe 5f2e3c
+
+  # Probe an OpenAI-compatible server, e.g. started by serve
+  %[1]s probe http://127.0.0.1:8000 --model gpustack/qwen2:0.5b-instruct
+
+  # Probe an embedding server within 30 seconds
+  %[1]s probe http://127.0.0.1:8080 --usage embedding --timeout 30s`, app),
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			var (
+				pt    probeTarget
+				alive func() bool
+			)
+			if arg := args[0]; strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+				pt = probeTarget{
+					URL:        strings.TrimSuffix(arg, "/"),
+					HealthPath: healthPath,
+					Usage:      probeUsageCompletion,
+				}
+			} else {
+				ri, err := findRunInstance(arg)
+				if err != nil {
+					return err
+				}
+				if ri.Port == 0 {
+					return fmt.Errorf("instance %s of runtime %q does not serve", ri.ID, ri.Runtime)
+				}
+				pt = probeTarget{
+					URL:        getLocalURL(ri.Host, ri.Port),
+					HealthPath: ri.HealthPath,
+					Model:      ri.Model,
+					Usage:      getProbeUsage(getLocalModelUsage(ri.Model)),
+				}
+				alive = func() bool {
+					return ri.State(c.Context()) == "running"
+				}
+			}
+			if model != "" {
+				pt.Model = model
+			}
+			if usage != "" {
+				pt.Usage = usage
+			}
+
+			pr, err := pf.probe(c.Context(), pt, alive)
+			if err != nil {
+				return err
+			}
+			return render(c, pr, func() (hds, bds [][]any, border bool) {
+				hds = [][]any{
+					{
+						"URL",
+						"Usage",
+						"Time To Healthy",
+						"Time To First Token",
+						"Latency",
+						"Tokens",
+						"Tokens Per Second",
+					},
+				}
+				bds = [][]any{
+					{
+						pr.URL,
+						pr.Usage,
+						sprintf("%.2fs", pr.TimeToHealthy),
+						tenary(pr.Usage == probeUsageCompletion, sprintf("%.2fs", pr.TimeToFirstToken), ""),
+						sprintf("%.2fs", pr.Latency),
+						tenary(pr.Usage == probeUsageCompletion, sprintf(pr.Tokens), ""),
+						tenary(pr.Usage == probeUsageCompletion, sprintf("%.2f", pr.TokensPerSecond), ""),
+					},
+				}
+				return hds, bds, false
+			})
+		},
+	}
+	pf.addFlags(c.Flags())
+	c.Flags().StringVar(&model, "model", model, "Specify the \"model\" field of the request, "+
+		"default is the model reference of the instance.")
+	c.Flags().StringVar(&usage, "usage", usage, "Specify the request to issue, select from "+sprintf(probeUsages)+", "+
+		"default is chosen by the gguf.model.usage label of the model, or completion for URL.")
+	c.Flags().StringVar(&healthPath, "health-path", healthPath, "Specify the HTTP path to probe the health of URL.")
+	return c
+}
+
+const (
+	probeUsageCompletion = "completion"
+	probeUsageEmbedding  = "embedding"
+	probeUsageRerank     = "rerank"
+)
+
+// probeUsages are the available requests to issue.
+var probeUsages = []string{probeUsageCompletion, probeUsageEmbedding, probeUsageRerank}
+
+// getProbeUsage returns the request to issue for the given gguf.model.usage label,
+// e.g. text-embedding is probed by embedding.
+func getProbeUsage(label string) string {
+	switch l := strings.ToLower(label); {
+	case strings.Contains(l, "rerank"):
+		return probeUsageRerank
+	case strings.Contains(l, "embed"):
+		return probeUsageEmbedding
+	}
+	return probeUsageCompletion
+}
+
+// getLocalModelUsage returns the gguf.model.usage label of the given local model,
+// empty if not found.
+func getLocalModelUsage(model string) string {
+	rf, err := name.NewTag(model)
+	if err != nil {
+		return ""
+	}
+	cfp, err := os.Readlink(getModelMetadataStorePath(rf))
+	if err != nil {
+		return ""
+	}
+	cf, err := retrieveConfigByPath(cfp)
+	if err != nil {
+		return ""
+	}
+	return cf.Config.Labels["gguf.model.usage"]
+}
+
+// findRunInstance returns the instance of the given ID, unique ID prefix or model reference,
+// the latest created one is returned if several instances run the model.
+func findRunInstance(s string) (runInstance, error) {
+	ri, err := getRunInstance(s)
+	if err == nil {
+		return ri, nil
+	}
+	ris, lerr := loadRunInstances()
+	if lerr != nil {
+		return runInstance{}, lerr
+	}
+	rf, perr := name.NewTag(s)
+	for i := len(ris) - 1; i >= 0; i-- {
+		if ris[i].Model == s {
+			return ris[i], nil
+		}
+		if perr != nil {
+			continue
+		}
+		if irf, err := name.NewTag(ris[i].Model); err == nil && irf.Name() == rf.Name() {
+			return ris[i], nil
+		}
+	}
+	return runInstance{}, fmt.Errorf("no instance of %q, start it by \"run --detach\" or probe its URL: %w", s, err)
+}
+
+// probeFlags holds the flags to probe a model,
+// which are shared by probe and run --wait.
+type probeFlags struct {
+	prompt    string
+	maxTokens int
+	timeout   time.Duration
+}
+
+func newProbeFlags() probeFlags {
+	return probeFlags{
+		prompt:    "Hello",
+		maxTokens: 16,
+		timeout:   5 * time.Minute,
+	}
+}
+
+func (f *probeFlags) addFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&f.prompt, "prompt", f.prompt, "Specify the prompt of the smoke request.")
+	fs.IntVar(&f.maxTokens, "max-tokens", f.maxTokens, "Specify the maximum tokens to generate by the completion request.")
+	fs.DurationVar(&f.timeout, "timeout", f.timeout, "Specify the timeout to wait for the model ready, including the smoke request.")
+}
+
+// probeTarget holds the OpenAI-compatible server to probe.
+type probeTarget struct {
+	// URL is the base URL, e.g. http://127.0.0.1:8080.
+	URL string
+	// HealthPath is the HTTP path to probe the health, empty means no health endpoint.
+	HealthPath string
+	// Model is the "model" field of the request.
+	Model string
+	// Usage is the request to issue, see probeUsages.
+	Usage string
+}
+
+// probeResult holds the result of probing, durations are in seconds.
+type probeResult struct {
+	URL              string  `json:"url"`
+	Model            string  `json:"model,omitempty"`
+	Usage            string  `json:"usage"`
+	TimeToHealthy    float64 `json:"timeToHealthy"`
+	TimeToFirstToken float64 `json:"timeToFirstToken,omitempty"`
+	Latency          float64 `json:"latency"`
+	Tokens           int     `json:"tokens,omitempty"`
+	TokensPerSecond  float64 `json:"tokensPerSecond,omitempty"`
+}
+
+// String returns the summary of the result.
+func (pr probeResult) String() string {
+	s := fmt.Sprintf("healthy in %.2fs, %s in %.2fs", pr.TimeToHealthy, pr.Usage, pr.Latency)
+	if pr.Usage == probeUsageCompletion {
+		s += fmt.Sprintf(", first token in %.2fs, %d tokens at %.2f tokens/s", pr.TimeToFirstToken, pr.Tokens, pr.TokensPerSecond)
+	}
+	return s
+}
+
+// errProbeNotReady is returned if the server responds the model is not found or unavailable yet,
+// e.g. ollama is healthy before the model is created, the smoke request is retried until the timeout.
+var errProbeNotReady = errors.New("model not ready")
+
+// probe waits until the given target is healthy and issues the smoke request,
+// the given function reports whether the server is still running, nil means always running.
+func (f *probeFlags) probe(ctx context.Context, pt probeTarget, alive func() bool) (pr probeResult, err error) {
+	if !slices.Contains(probeUsages, pt.Usage) {
+		return pr, fmt.Errorf("unknown usage %q, select from %v", pt.Usage, probeUsages)
+	}
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+	pr = probeResult{
+		URL:   pt.URL,
+		Model: pt.Model,
+		Usage: pt.Usage,
+	}
+
+	begin := time.Now()
+	if pt.HealthPath != "" {
+		if err = waitHealthy(ctx, pt.URL+pt.HealthPath, alive); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return pr, fmt.Errorf("%s is not healthy in %s", pt.URL, f.timeout)
+			}
+			return pr, fmt.Errorf("waiting %s healthy: %w", pt.URL, err)
+		}
+	}
+
+	for {
+		// The time of retrying the not ready model is counted as healthy.
+		pr.TimeToHealthy = time.Since(begin).Seconds()
+		start := time.Now()
+		if err = f.request(ctx, pt, &pr, start); err == nil {
+			pr.Latency = time.Since(start).Seconds()
+			return pr, nil
+		}
+		if !errors.Is(err, errProbeNotReady) || (alive != nil && !alive()) {
+			return pr, fmt.Errorf("probing %s by %s: %w", pt.URL, pt.Usage, err)
+		}
+		select {
+		case <-ctx.Done():
+			return pr, fmt.Errorf("%s is not ready in %s: %w", pt.URL, f.timeout, err)
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// request issues the smoke request of the given target.
+func (f *probeFlags) request(ctx context.Context, pt probeTarget, pr *probeResult, start time.Time) error {
+	switch pt.Usage {
+	case probeUsageEmbedding:
+		return f.probeJSON(ctx, pt.URL+"/v1/embeddings", map[string]any{
+			"model": pt.Model,
+			"input": f.prompt,
+		}, func(bs []byte) error {
+			var r struct {
+				Data []struct {
+					Embedding []float64 `json:"embedding"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(bs, &r); err != nil {
+				return fmt.Errorf("parsing embedding response: %w", err)
+			}
+			if len(r.Data) == 0 || len(r.Data[0].Embedding) == 0 {
+				return errors.New("no embedding returned")
+			}
+			return nil
+		})
+	case probeUsageRerank:
+		return f.probeJSON(ctx, pt.URL+"/v1/rerank", map[string]any{
+			"model":     pt.Model,
+			"query":     f.prompt,
+			"documents": []string{f.prompt, "gguf-packer"},
+		}, func(bs []byte) error {
+			var r struct {
+				Results []json.RawMessage `json:"results"`
+			}
+			if err := json.Unmarshal(bs, &r); err != nil {
+				return fmt.Errorf("parsing rerank response: %w", err)
+			}
+			if len(r.Results) == 0 {
+				return errors.New("no rerank result returned")
+			}
+			return nil
+		})
+	}
+	return f.probeCompletion(ctx, pt, pr, start)
+}
+
+// probeCompletion issues a streaming completion request,
+// and measures the time to first token and the tokens per second.
+func (f *probeFlags) probeCompletion(ctx context.Context, pt probeTarget, pr *probeResult, start time.Time) error {
+	resp, err := postJSON(ctx, pt.URL+"/v1/completions", map[string]any{
+		"model":          pt.Model,
+		"prompt":         f.prompt,
+		"max_tokens":     f.maxTokens,
+		"stream":         true,
+		"stream_options": map[string]any{"include_usage": true},
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var (
+		first  time.Time
+		tokens int
+		usage  int
+	)
+	s := bufio.NewScanner(resp.Body)
+	s.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for s.Scan() {
+		l, ok := strings.CutPrefix(s.Text(), "data:")
+		if !ok {
+			continue
+		}
+		l = strings.TrimSpace(l)
+		if l == "[DONE]" {
+			break
+		}
+		var ch struct {
+			Choices []struct {
+				Text string `json:"text"`
+			} `json:"choices"`
+			Usage *struct {
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if err = json.Unmarshal([]byte(l), &ch); err != nil {
+			return fmt.Errorf("parsing completion chunk: %w", err)
+		}
+		if ch.Usage != nil {
+			usage = ch.Usage.CompletionTokens
+		}
+		if len(ch.Choices) == 0 || ch.Choices[0].Text == "" {
+			continue
+		}
+		if tokens == 0 {
+			first = time.Now()
+		}
+		tokens++
+	}
+	if err = s.Err(); err != nil {
+		return fmt.Errorf("reading completion response: %w", err)
+	}
+	if tokens == 0 {
+		return errors.New("no token generated")
+	}
+	end := time.Now()
+
+	// Prefer the token count reported by the server,
+	// as a chunk may carry several tokens.
+	pr.Tokens = max(tokens, usage)
+	pr.TimeToFirstToken = first.Sub(start).Seconds()
+	if d := end.Sub(first).Seconds(); pr.Tokens > 1 && d > 0 {
+		pr.TokensPerSecond = float64(pr.Tokens-1) / d
+	}
+	return nil
+}
+
+// probeJSON issues a JSON request, and validates the response by the given function.
+func (f *probeFlags) probeJSON(ctx context.Context, u string, body any, validate func([]byte) error) error {
+	resp, err := postJSON(ctx, u, body)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	bs, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+	return validate(bs)
+}
+
+// postJSON posts the given body as JSON, and returns the response if it is OK.
+func postJSON(ctx context.Context, u string, body any) (*http.Response, error) {
+	bs, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(bs))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting %s: %w", u, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer func() { _ = resp.Body.Close() }()
+		rbs, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		switch resp.StatusCode {
+		case http.StatusNotFound, http.StatusServiceUnavailable:
+			return nil, fmt.Errorf("requesting %s: %w: %s: %s", u, errProbeNotReady, resp.Status, strings.TrimSpace(string(rbs)))
+		}
+		return nil, fmt.Errorf("requesting %s: %s: %s", u, resp.Status, strings.TrimSpace(string(rbs)))
+	}
+	return resp, nil
+}
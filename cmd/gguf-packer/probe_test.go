@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newProbeTestServer returns an OpenAI-compatible server,
+// which is healthy after the given health checks and serves the model after the given smoke requests,
+// failed is true to respond the smoke requests with an internal error.
+func newProbeTestServer(t *testing.T, unhealthy, unready int32, failed bool) *httptest.Server {
+	var healths, requests atomic.Int32
+	ready := func(w http.ResponseWriter) bool {
+		switch {
+		case failed:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		case requests.Add(1) <= unready:
+			http.Error(w, `{"error":"model not found"}`, http.StatusNotFound)
+		default:
+			return true
+		}
+		return false
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		if healths.Add(1) <= unhealthy {
+			http.Error(w, "loading", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("POST /v1/completions", func(w http.ResponseWriter, r *http.Request) {
+		if !ready(w) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, tk := range []string{"Hi", " there", "!"} {
+			_, _ = fmt.Fprintf(w, "data: {\"choices\":[{\"text\":%q}]}\n\n", tk)
+			w.(http.Flusher).Flush()
+			time.Sleep(5 * time.Millisecond)
+		}
+		_, _ = fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"completion_tokens\":4}}\n\ndata: [DONE]\n\n")
+	})
+	mux.HandleFunc("POST /v1/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		if !ready(w) {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"data": []any{map[string]any{"embedding": []float64{0.1, 0.2}}}})
+	})
+	mux.HandleFunc("POST /v1/rerank", func(w http.ResponseWriter, r *http.Request) {
+		if !ready(w) {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"results": []any{map[string]any{"index": 0, "relevance_score": 0.9}}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProbe(t *testing.T) {
+	testCases := []struct {
+		name      string
+		usage     string
+		unhealthy int32
+		unready   int32
+		failed    bool
+		timeout   time.Duration
+		alive     func() bool
+		expected  string
+	}{
+		{
+			name:  "completion",
+			usage: probeUsageCompletion,
+		},
+		{
+			name:  "embedding",
+			usage: probeUsageEmbedding,
+		},
+		{
+			name:  "rerank",
+			usage: probeUsageRerank,
+		},
+		{
+			name:      "healthy later",
+			usage:     probeUsageCompletion,
+			unhealthy: 1,
+		},
+		{
+			name:    "model ready later",
+			usage:   probeUsageEmbedding,
+			unready: 1,
+		},
+		{
+			name:      "not healthy",
+			usage:     probeUsageCompletion,
+			unhealthy: 100,
+			timeout:   1500 * time.Millisecond,
+			expected:  "is not healthy in",
+		},
+		{
+			name:     "model not ready",
+			usage:    probeUsageCompletion,
+			unready:  100,
+			timeout:  1500 * time.Millisecond,
+			expected: "is not ready in",
+		},
+		{
+			name:      "exited",
+			usage:     probeUsageCompletion,
+			unhealthy: 100,
+			alive:     func() bool { return false },
+			expected:  errRunInstanceExited.Error(),
+		},
+		{
+			name:     "failed",
+			usage:    probeUsageRerank,
+			failed:   true,
+			expected: "500 Internal Server Error: boom",
+		},
+		{
+			name:     "unknown usage",
+			usage:    "chat",
+			expected: "unknown usage",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newProbeTestServer(t, tc.unhealthy, tc.unready, tc.failed)
+			pf := newProbeFlags()
+			if tc.timeout > 0 {
+				pf.timeout = tc.timeout
+			}
+			pt := probeTarget{URL: srv.URL, HealthPath: "/health", Model: "gpustack/qwen2:0.5b-instruct", Usage: tc.usage}
+
+			pr, err := pf.probe(context.Background(), pt, tc.alive)
+			if tc.expected != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expected) {
+					t.Fatalf("expected error containing %q, got %v", tc.expected, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if pr.URL != srv.URL || pr.Usage != tc.usage || pr.Latency <= 0 {
+				t.Errorf("unexpected result: %+v", pr)
+			}
+			if (tc.unhealthy > 0 || tc.unready > 0) && pr.TimeToHealthy < 1 {
+				t.Errorf("expected the retries counted as healthy, got %.2fs", pr.TimeToHealthy)
+			}
+			if tc.usage == probeUsageCompletion {
+				// The usage reported by the server takes precedence over the chunks.
+				if pr.Tokens != 4 || pr.TimeToFirstToken <= 0 || pr.TokensPerSecond <= 0 {
+					t.Errorf("unexpected completion result: %+v", pr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func ps(app string) *cobra.Command {
+	var (
+		noTrunc bool
+	)
+	c := &cobra.Command{
+		Use:   "ps",
+		Short: "List the model instances started by run --detach.",
+		Example: sprintf(`  # List the model instances
+  %s ps
+
+  # List the model instances as JSON
+  %[1]s ps --format json`, app),
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			ris, err := loadRunInstances()
+			if err != nil {
+				return err
+			}
+
+			pis := make([]psItem, len(ris))
+			for i := range ris {
+				pis[i] = psItem{
+					runInstance: ris[i],
+					Status:      ris[i].State(c.Context()),
+				}
+			}
+
+			return render(c, pis, func() (hds, bds [][]any, border bool) {
+				hds = [][]any{
+					{
+						"ID",
+						"Model",
+						"Runtime",
+						"Process",
+						"Port",
+						"Status",
+						"Created",
+					},
+				}
+				bds = make([][]any, len(pis))
+				for i, pi := range pis {
+					p := sprintf(pi.PID)
+					if pi.Container != "" {
+						p = pi.Container
+						if !noTrunc && len(p) > 12 {
+							p = p[:12]
+						}
+						p = pi.Engine + ":" + p
+					}
+					bds[i] = []any{
+						pi.ID,
+						pi.Model,
+						pi.Runtime,
+						p,
+						tenary(pi.Port != 0, sprintf(pi.Port), ""),
+						pi.Status,
+						humanizeTime(pi.Created),
+					}
+				}
+				return hds, bds, false
+			})
+		},
+	}
+	c.Flags().BoolVar(&noTrunc, "no-trunc", noTrunc, "Do not truncate the output.")
+	return c
+}
+
+// psItem holds a model instance with its status.
+type psItem struct {
+	runInstance
+	Status string `json:"status"`
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -64,7 +63,7 @@ func pull(app string) *cobra.Command {
 			}
 
 			mdp := getModelMetadataStorePath(rf)
-			if osx.ExistsLink(mdp) && !force {
+			if osx.ExistsLink(mdp) && !force && !isLazyModel(mdp) {
 				return nil
 			}
 
@@ -80,108 +79,145 @@ func pull(app string) *cobra.Command {
 					return err
 				}
 			}
-			cfp, lsp, err := getModelConfigAndLayersStorePaths(img)
-			if err != nil {
-				return err
-			}
-
-			// Link.
-			if !force {
-				if osx.ExistsLink(mdp) {
-					cfpActual, err := os.Readlink(mdp)
-					if err != nil {
-						return fmt.Errorf("reading link %s: %w", mdp, err)
-					}
-					if cfpActual == cfp {
-						return nil
-					}
-					// Create a tombstone.
-					mdpTomb := filepath.Join(filepath.Dir(mdp), oldPrefix+filepath.Base(cfpActual))
-					if err = os.Rename(mdp, mdpTomb); err != nil {
-						return fmt.Errorf("renaming link %s: %w", mdp, err)
-					}
-					// Restore a tombstone if exists.
-					mdpTomb = filepath.Join(filepath.Dir(mdp), oldPrefix+filepath.Base(cfp))
-					if osx.ExistsLink(mdpTomb) {
-						if err = os.Rename(mdpTomb, mdp); err == nil {
-							return nil
-						}
-						if err = os.Remove(mdpTomb); err != nil && !os.IsNotExist(err) {
-							return fmt.Errorf("force removing link %s: %w", mdpTomb, err)
-						}
-					}
+			// Resume the model files streamed partially by run --lazy-pull.
+			var saveLayers func(lsp string) error
+			if _, lsp, err := getModelConfigAndLayersStorePaths(img); err == nil && isLazyLayers(lsp) {
+				saveLayers = func(lsp string) error {
+					return fetchLazyLayers(c, rf, cos, img, lsp)
 				}
 			}
-			defer func() {
-				if err != nil {
-					return
-				}
-				if err = osx.ForceSymlink(cfp, mdp); err != nil {
-					err = fmt.Errorf("link metadata %s from %s: %w", mdp, cfp, err)
-					return
-				}
-			}()
+			return saveModel(c, rf, img, force || saveLayers != nil, saveLayers)
+		},
+	}
+	c.Flags().BoolVar(&insecure, "insecure", insecure, "Allow model references to be fetched without TLS.")
+	c.Flags().BoolVar(&force, "force", force, "Always pull the model from the registry.")
+	return c
+}
 
-			// Retrieve and save config.
-			_, cfBs, err := retrieveConfigByOCIImage(img)
-			if err != nil {
-				return err
-			}
-			if err = osx.WriteFile(cfp, cfBs, 0644); err != nil {
-				return fmt.Errorf("writing config file: %w", err)
-			}
+// saveModel saves the given image into the store as the given reference,
+// the config is written to the config store, the layers are saved into the layers store by the given function,
+// which extracts and flattens the layers if nil, and the reference is linked to the config at last.
+func saveModel(c *cobra.Command, rf name.Reference, img conreg.Image, force bool, saveLayers func(lsp string) error) (err error) {
+	mdp := getModelMetadataStorePath(rf)
 
-			// Extract and flatten layers.
-			ls, err := img.Layers()
+	cfp, lsp, err := getModelConfigAndLayersStorePaths(img)
+	if err != nil {
+		return err
+	}
+
+	// Link.
+	if !force {
+		if osx.ExistsLink(mdp) {
+			cfpActual, err := os.Readlink(mdp)
 			if err != nil {
-				return fmt.Errorf("retrieving image layers: %w", err)
+				return fmt.Errorf("reading link %s: %w", mdp, err)
 			}
-			if err = os.MkdirAll(lsp, 0755); err != nil {
-				return fmt.Errorf("creating layers directory: %w", err)
+			if cfpActual == cfp {
+				return nil
 			}
-
-			for i := range ls {
-				s, err := ls[i].Size()
-				if err != nil {
-					return fmt.Errorf("getting layer size: %w", err)
-				}
-				d, err := ls[i].Digest()
-				if err != nil {
-					return fmt.Errorf("getting layer digest: %w", err)
-				}
-				l, err := ls[i].Uncompressed()
-				if err != nil {
-					return fmt.Errorf("reading layer contents: %w", err)
-				}
-				pb := progressbar.NewOptions64(s,
-					progressbar.OptionSetDescription(sprintf("[%d/%d]", i+1, len(ls))),
-					progressbar.OptionSetWriter(c.OutOrStderr()),
-					progressbar.OptionSetWidth(30),
-					progressbar.OptionThrottle(65*time.Millisecond),
-					progressbar.OptionShowBytes(true),
-					progressbar.OptionShowCount(),
-					progressbar.OptionSetPredictTime(false),
-					progressbar.OptionSpinnerType(14),
-					progressbar.OptionSetRenderBlankState(true))
-				if _, err = archive.Apply(c.Context(), lsp, ptr.To(progressbar.NewReader(l, pb)), archive.WithNoSameOwner()); err != nil {
-					_ = l.Close()
-					_ = pb.Clear()
-					return fmt.Errorf("extracting layer %q: %w", d, err)
+			// Create a tombstone.
+			mdpTomb := filepath.Join(filepath.Dir(mdp), oldPrefix+filepath.Base(cfpActual))
+			if err = os.Rename(mdp, mdpTomb); err != nil {
+				return fmt.Errorf("renaming link %s: %w", mdp, err)
+			}
+			// Restore a tombstone if exists.
+			mdpTomb = filepath.Join(filepath.Dir(mdp), oldPrefix+filepath.Base(cfp))
+			if osx.ExistsLink(mdpTomb) {
+				if err = os.Rename(mdpTomb, mdp); err == nil {
+					return nil
 				}
-				_ = pb.Clear()
-				if cl, ok := l.(cacheLayerReadCloser); ok {
-					if err = cl.Complete(); err != nil {
-						return fmt.Errorf("completing layer %q: %w", d, err)
-					}
+				if err = os.Remove(mdpTomb); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("force removing link %s: %w", mdpTomb, err)
 				}
 			}
+		}
+	}
+	defer func() {
+		if err != nil {
+			return
+		}
+		if err = osx.ForceSymlink(cfp, mdp); err != nil {
+			err = fmt.Errorf("link metadata %s from %s: %w", mdp, cfp, err)
+			return
+		}
+	}()
 
-			return nil
-		},
+	// Retrieve and save config.
+	_, cfBs, err := retrieveConfigByOCIImage(img)
+	if err != nil {
+		return err
 	}
-	c.Flags().BoolVar(&insecure, "insecure", insecure, "Allow model references to be fetched without TLS.")
-	c.Flags().BoolVar(&force, "force", force, "Always pull the model from the registry.")
-	return c
+	if err = osx.WriteFile(cfp, cfBs, 0644); err != nil {
+		return fmt.Errorf("writing config file: %w", err)
+	}
+
+	// Retrieve and save manifest, whose digest identifies the model as a parent, see history --lineage.
+	mfBs, err := img.RawManifest()
+	if err != nil {
+		return fmt.Errorf("retrieving manifest: %w", err)
+	}
+	if err = osx.WriteFile(convertConfigStorePathToManifestStorePath(cfp), mfBs, 0644); err != nil {
+		return fmt.Errorf("writing manifest file: %w", err)
+	}
+
+	if saveLayers != nil {
+		return saveLayers(lsp)
+	}
+	return extractLayers(c, img, lsp)
+}
+
+// extractLayers extracts and flattens the layers of the given image into the given layers store path.
+func extractLayers(c *cobra.Command, img conreg.Image, lsp string) error {
+	ls, err := img.Layers()
+	if err != nil {
+		return fmt.Errorf("retrieving image layers: %w", err)
+	}
+	if err = os.MkdirAll(lsp, 0755); err != nil {
+		return fmt.Errorf("creating layers directory: %w", err)
+	}
+
+	for i := range ls {
+		s, err := ls[i].Size()
+		if err != nil {
+			return fmt.Errorf("getting layer size: %w", err)
+		}
+		d, err := ls[i].Digest()
+		if err != nil {
+			return fmt.Errorf("getting layer digest: %w", err)
+		}
+		l, err := ls[i].Uncompressed()
+		if err != nil {
+			return fmt.Errorf("reading layer contents: %w", err)
+		}
+		pb := newProgressBar(c, s, sprintf("[%d/%d]", i+1, len(ls)))
+		if _, err = archive.Apply(c.Context(), lsp, ptr.To(progressbar.NewReader(l, pb)), archive.WithNoSameOwner()); err != nil {
+			_ = l.Close()
+			_ = pb.Clear()
+			return fmt.Errorf("extracting layer %q: %w", d, err)
+		}
+		_ = pb.Clear()
+		if cl, ok := l.(cacheLayerReadCloser); ok {
+			if err = cl.Complete(); err != nil {
+				return fmt.Errorf("completing layer %q: %w", d, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// newProgressBar returns the progress bar of the given size in bytes.
+func newProgressBar(c *cobra.Command, size int64, desc string) *progressbar.ProgressBar {
+	return progressbar.NewOptions64(size,
+		progressbar.OptionSetDescription(desc),
+		progressbar.OptionSetWriter(c.OutOrStderr()),
+		progressbar.OptionSetWidth(30),
+		progressbar.OptionThrottle(65*time.Millisecond),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionShowCount(),
+		progressbar.OptionSetPredictTime(false),
+		progressbar.OptionSpinnerType(14),
+		progressbar.OptionSetRenderBlankState(true))
 }
 
 func getAuthnKeychainOption() crane.Option {
@@ -230,10 +266,11 @@ func retrieveOCIImage(rd *remote.Descriptor) (img conreg.Image, err error) {
 		if err != nil {
 			return nil, fmt.Errorf("getting model index manifest: %w", err)
 		}
-		if len(idxMs.Manifests) == 0 {
+		ms := filterImageManifests(idxMs.Manifests)
+		if len(ms) == 0 {
 			return nil, errors.New("empty model index")
 		}
-		img, err = idx.Image(idxMs.Manifests[0].Digest)
+		img, err = idx.Image(ms[0].Digest)
 		if err != nil {
 			return nil, fmt.Errorf("getting model from index: %w", err)
 		}
@@ -247,22 +284,31 @@ func retrieveOCIImage(rd *remote.Descriptor) (img conreg.Image, err error) {
 	return img, nil
 }
 
+const (
+	annotationReferenceType            = "vnd.docker.reference.type"
+	annotationReferenceDigest          = "vnd.docker.reference.digest"
+	annotationReferenceTypeAttestation = "attestation-manifest"
+)
+
+// filterImageManifests returns the manifests which are not attestation manifests.
+func filterImageManifests(ms []conreg.Descriptor) []conreg.Descriptor {
+	r := make([]conreg.Descriptor, 0, len(ms))
+	for i := range ms {
+		if ms[i].Annotations[annotationReferenceType] == annotationReferenceTypeAttestation {
+			continue
+		}
+		r = append(r, ms[i])
+	}
+	return r
+}
+
 func retrieveConfigByOCIImage(img conreg.Image) (cf specs.Image, cfBs []byte, err error) {
 	cfBs, err = img.RawConfigFile()
 	if err != nil {
 		return cf, cfBs, fmt.Errorf("getting config: %w", err)
 	}
-	if err = json.Unmarshal(cfBs, &cf); err != nil {
-		return cf, cfBs, fmt.Errorf("unmarshalling config: %w", err)
-	}
-	if !isConfigAvailable(&cf) {
-		return cf, cfBs, errors.New("unavailable model config")
-	}
-	return cf, cfBs, nil
-}
-
-func isConfigAvailable(cf *specs.Image) bool {
-	return cf.Config.Model != nil && len(cf.Config.Model.Header.MetadataKV) != 0 && len(cf.Config.Model.TensorInfos) != 0
+	cf, err = specs.ParseImage(cfBs)
+	return cf, cfBs, err
 }
 
 func getBlobsStorePath() string {
@@ -74,6 +74,10 @@ func remove(app string) *cobra.Command {
 					q[i].err = fmt.Errorf("removing config: %w", err)
 					continue
 				}
+				if err = os.Remove(convertConfigStorePathToManifestStorePath(cfp)); err != nil && !os.IsNotExist(err) {
+					q[i].err = fmt.Errorf("removing manifest: %w", err)
+					continue
+				}
 				if err = os.Remove(mdp); err != nil && !os.IsNotExist(err) {
 					q[i].err = fmt.Errorf("removing metadata: %w", err)
 					continue
@@ -129,6 +133,10 @@ func remove(app string) *cobra.Command {
 							q[i].err = fmt.Errorf("removing config: %w", err)
 							continue
 						}
+						if err := os.Remove(convertConfigStorePathToManifestStorePath(cfp)); err != nil && !os.IsNotExist(err) {
+							q[i].err = fmt.Errorf("removing manifest: %w", err)
+							continue
+						}
 						if err := os.Remove(mdp); err != nil && !os.IsNotExist(err) {
 							q[i].err = fmt.Errorf("removing metadata: %w", err)
 							continue
@@ -137,24 +145,52 @@ func remove(app string) *cobra.Command {
 				}
 			}
 
-			we, wo := c.ErrOrStderr(), c.OutOrStderr()
+			if outputFormat == "" {
+				we, wo := c.ErrOrStderr(), c.OutOrStderr()
+				for i := range q {
+					if err := q[i].err; err != nil {
+						fprintf(we, "removing model %s failed: %v\n", args[i], err)
+						continue
+					}
+					fprintf(wo, "removed model %s\n", args[i])
+				}
+				return nil
+			}
+
+			ris := make([]removeItem, len(q))
 			for i := range q {
-				if err := q[i].err; err != nil {
-					fprintf(we, "removing model %s failed: %v\n", args[i], err)
-					continue
+				ris[i] = removeItem{Model: args[i], Removed: q[i].err == nil}
+				if q[i].err != nil {
+					ris[i].Error = q[i].err.Error()
 				}
-				fprintf(wo, "removed model %s\n", args[i])
 			}
-			return nil
+			return render(c, ris, func() (hds, bds [][]any, border bool) {
+				bds = make([][]any, len(ris))
+				for i := range ris {
+					bds[i] = []any{ris[i].Model, tenary(ris[i].Removed, "Removed", "Failed: "+ris[i].Error)}
+				}
+				return [][]any{{"Model", "Status"}}, bds, false
+			})
 		},
 	}
 	return c
 }
 
+// removeItem holds the removal result of a model.
+type removeItem struct {
+	Model   string `json:"model"`
+	Removed bool   `json:"removed"`
+	Error   string `json:"error,omitempty"`
+}
+
 func convertConfigStorePathToLayersStorePath(cfp string) (lsp string) {
 	return filepath.Join(getModelsLayersStorePath(), strings.TrimPrefix(cfp, getModelsConfigStorePath()))
 }
 
+func convertConfigStorePathToManifestStorePath(cfp string) (mfp string) {
+	return cfp + ".manifest"
+}
+
 func isIDAvailable(id string) bool {
 	if len(id) < 12 || len(id) > 64 {
 		return false
@@ -2,25 +2,39 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
 	specs "github.com/gpustack/gguf-packer-go/buildkit/frontend/specs/v1"
+	"github.com/gpustack/gguf-packer-go/llamacpp"
 	"github.com/gpustack/gguf-packer-go/util/osx"
+	"github.com/gpustack/gguf-packer-go/util/ptr"
 	"github.com/gpustack/gguf-packer-go/util/strconvx"
+	ggufparser "github.com/gpustack/gguf-parser-go"
 	"github.com/gpustack/gguf-parser-go/util/stringx"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func run(app string) *cobra.Command {
 	var (
-		by     = "ghcr.io/ggerganov/llama.cpp:server"
+		rf     = newRunFlags()
+		pf     = newProbeFlags()
+		detach bool
+		wait   bool
 		dryRun bool
 	)
 	c := &cobra.Command{
@@ -35,6 +49,36 @@ func run(app string) *cobra.Command {
   # Run a model by executable binary: llama-box
   %[1]s run gpustack/qwen2:0.5b-instruct --by llama-box
 
+  # Run a model by Ollama, which creates the model from a generated Modelfile
+  %[1]s run gpustack/qwen2:0.5b-instruct --runtime ollama
+
+  # Chat with a model by llama-cli executable binary
+  %[1]s run gpustack/qwen2:0.5b-instruct --runtime llama-cli --by llama-cli -- -cnv
+
+  # Run a model by Podman with the NVIDIA GPUs exposed via CDI
+  %[1]s run gpustack/qwen2:0.5b-instruct --engine podman --gpus nvidia-cdi
+
+  # Run a model with the split and offload flags chosen by the device profile
+  %[1]s run gpustack/qwen2:0.5b-instruct --profile a100x2
+
+  # Run a model with the offload flags fitting the free VRAM of the local GPUs
+  %[1]s run gpustack/qwen2:0.5b-instruct --auto-offload
+
+  # Run a model by streaming its files instead of pulling the whole layers
+  %[1]s run gpustack/qwen2:0.5b-instruct --lazy-pull
+
+  # Run a model with limited resources, an extra environment variable and a LoRA adapters directory
+  %[1]s run gpustack/qwen2:0.5b-instruct --cpus 8 --memory 16GiB --env LLAMA_ARG_THREADS=8 --mount ./loras:/loras:ro
+
+  # Run a model published on the loopback only
+  %[1]s run gpustack/qwen2:0.5b-instruct --publish-address 127.0.0.1
+
+  # Run a model in background, see "ps", "logs" and "stop" commands
+  %[1]s run gpustack/qwen2:0.5b-instruct --detach
+
+  # Run a model in background, and fail if it cannot answer a smoke request in 2 minutes
+  %[1]s run gpustack/qwen2:0.5b-instruct --detach --wait --wait-timeout 2m
+
   # Dry run to print the command that would be executed
   %[1]s run gpustack/qwen2:0.5b-instruct --dry-run`, app),
 		Args:                  cobra.MinimumNArgs(1),
@@ -43,159 +87,833 @@ func run(app string) *cobra.Command {
 			UnknownFlags: true,
 		},
 		RunE: func(c *cobra.Command, args []string) error {
-			isByContainer := true
-			if _, err := name.ParseReference(by, name.StrictValidation); err != nil {
-				isByContainer = false
-				if !dryRun {
-					if _, err = exec.LookPath(by); err != nil {
-						return fmt.Errorf("looking up binary %s: %v", by, err)
-					}
-				}
+			rp, err := rf.plan(c, app, args, detach, dryRun)
+			if err != nil {
+				return err
 			}
 
-			var cfp, lsp string
-			{
-				model := args[0]
-				rf, err := name.NewTag(model)
-				if err != nil {
-					return fmt.Errorf("parsing model reference %q: %w", model, err)
-				}
-				mdp := getModelMetadataStorePath(rf)
-				if !osx.ExistsLink(mdp) {
-					if err = pull(app).RunE(c, []string{model}); err != nil {
-						return err
-					}
-				}
-				cfp, err = os.Readlink(mdp)
-				if err != nil {
-					return fmt.Errorf("reading link %s: %w", mdp, err)
-				}
-				lsp = convertConfigStorePathToLayersStorePath(cfp)
+			if dryRun {
+				rp.print(c.OutOrStdout(), c.ErrOrStderr())
+				return nil
 			}
 
-			img, err := retrieveConfigByPath(cfp)
-			if err != nil {
-				return err
+			if wait && rp.Port == 0 {
+				return fmt.Errorf("--wait requires the runtime to serve, but %q does not", rp.Runtime.Name())
 			}
 
-			wdp := lsp
-			if isByContainer {
-				wdp = "/gp-" + stringx.RandomHex(4)
+			if err = rp.writeFiles(); err != nil {
+				return err
 			}
 
-			var (
-				cmdExec string
-				cmdArgs []string
-			)
-
-			if isByContainer {
-				cmdExec = "docker"
-				cmdArgs = []string{
-					"run",
-					"--rm",
-					"--interactive",
-					"--tty",
-				}
-				if isDockerGPUSupported(c.Context()) {
-					cmdArgs = append(cmdArgs,
-						"--gpus", "all")
-				} else {
-					cmdArgs = append(cmdArgs,
-						"--privileged")
-				}
-				port := "8080"
-				for i, s := 1, len(args); i < s; i++ {
-					if args[i] == "--port" {
-						if i+1 >= s {
-							return fmt.Errorf("missing value for %q", args[i])
-						}
-						port = args[i+1]
-						args = append(args[:i], args[i+2:]...)
-						break
-					}
-				}
-				cmdArgs = append(cmdArgs,
-					"--publish", fmt.Sprintf("%s:8080", port),
-					"--volume", fmt.Sprintf("%s:%s", lsp, wdp),
-					by,
-				)
-			} else {
-				cmdExec = by
-			}
-
-			execArgs := img.Config.Cmd
-			{
-				cfg := img.Config
-				join := filepath.Join
-				if isByContainer {
-					join = path.Join
+			if detach {
+				ins, alive, err := startRunInstance(rp)
+				if err != nil {
+					return err
 				}
-				for _, v := range append([]*specs.GGUFFile{cfg.Model, cfg.Drafter, cfg.Projector}, cfg.Adapters...) {
-					if v == nil {
-						continue
+				if wait {
+					var pr probeResult
+					pr, err = pf.probe(c.Context(), rp.probeTarget(), alive)
+					if err == nil {
+						fprintf(c.ErrOrStderr(), "Instance %s is ready, %s\n", ins.ID, pr)
 					}
-					execArgs[v.CmdParameterIndex] = join(wdp, v.CmdParameterValue)
+				} else {
+					err = waitRunInstanceHealthy(c.Context(), ins, alive)
 				}
-				for i, s := 0, len(execArgs); i < s; i++ {
-					if strings.HasPrefix(execArgs[i], "-") {
-						if !strings.HasSuffix(execArgs[i], "-file") {
-							continue
-						}
-						if i+1 >= s {
-							continue
-						}
-						i++
-						execArgs[i] = join(wdp, execArgs[i])
+				if err != nil {
+					if errors.Is(err, errRunInstanceExited) {
+						return fmt.Errorf("instance %s exited before healthy, see \"logs %[1]s\"", ins.ID)
 					}
-					execArgs[i] = strconvx.Quote(execArgs[i])
+					return fmt.Errorf("waiting instance %s ready: %w", ins.ID, err)
 				}
-			}
-			cmdArgs = append(cmdArgs, execArgs...)
-
-			cmdArgs = append(cmdArgs, args[1:]...)
-
-			if isByContainer {
-				cmdArgs = append(cmdArgs, "--host", "0.0.0.0")
-			}
-
-			if dryRun {
-				fprintf(c.OutOrStdout(), "%s %s", cmdExec, strings.Join(cmdArgs, " "))
+				fprintf(c.OutOrStdout(), "%s\n", ins.ID)
 				return nil
 			}
+			defer func() { _ = os.RemoveAll(rp.FilesDir) }()
 
-			cmd := exec.CommandContext(c.Context(), cmdExec, cmdArgs...)
+			ctx, cancel := context.WithCancel(c.Context())
+			defer cancel()
+			cmd := exec.CommandContext(ctx, rp.Exec, rp.Args...)
 			cmd.Stdin = c.InOrStdin()
 			cmd.Stdout = c.OutOrStdout()
 			cmd.Stderr = c.ErrOrStderr()
-			err = cmd.Run()
-			if err != nil && strings.Contains(err.Error(), "signal: killed") {
+			if !rp.Container && len(rp.Env) != 0 {
+				cmd.Env = getRunEnviron(rp.Env)
+			}
+			cmd.Dir = rp.Dir
+			if !wait {
+				err = cmd.Run()
+				if err != nil && strings.Contains(err.Error(), "signal: killed") {
+					return nil
+				}
+				return err
+			}
+
+			// Interrupt the process if the probing fails,
+			// which allows the container engine to remove the container.
+			cmd.Cancel = func() error {
+				if err := cmd.Process.Signal(os.Interrupt); err != nil {
+					return cmd.Process.Kill()
+				}
+				return nil
+			}
+			cmd.WaitDelay = 10 * time.Second
+			if err = cmd.Start(); err != nil {
+				return err
+			}
+			done, perrc := make(chan struct{}), make(chan error, 1)
+			go func() {
+				pr, err := pf.probe(ctx, rp.probeTarget(), func() bool {
+					select {
+					case <-done:
+						return false
+					default:
+						return true
+					}
+				})
+				if err != nil {
+					perrc <- err
+					cancel()
+					return
+				}
+				fprintf(c.ErrOrStderr(), "Model is ready, %s\n", pr)
+				perrc <- nil
+			}()
+			err = cmd.Wait()
+			close(done)
+			if perr := <-perrc; perr != nil && !errors.Is(perr, errRunInstanceExited) && c.Context().Err() == nil {
+				return fmt.Errorf("waiting model ready: %w", perr)
+			}
+			if err != nil && c.Context().Err() != nil {
 				return nil
 			}
 			return err
 		},
 	}
-	c.Flags().StringVar(&by, "by", by, "Specify how to run the model. "+
-		"If given a strict format container image reference, it will be run via Docker container, "+
-		"otherwise it will be run via executable binary.")
+	rf.addFlags(c.Flags())
+	c.Flags().BoolVarP(&detach, "detach", "d", detach, "Run the model in background and wait until it is healthy, "+
+		"see \"ps\", \"logs\" and \"stop\" commands.")
+	c.Flags().BoolVar(&wait, "wait", wait, "Wait until the model answers a smoke request as \"probe\" does, "+
+		"exits non-zero if it is not ready in --wait-timeout.")
+	c.Flags().DurationVar(&pf.timeout, "wait-timeout", pf.timeout, "Specify the timeout of --wait.")
+	c.Flags().StringVar(&rf.name, "name", rf.name, "Specify the name of the container, "+
+		"which is also the instance ID if --detach, see \"ps\", \"logs\" and \"stop\" commands.")
+	c.Flags().StringVar(&rf.publishAddress, "publish-address", rf.publishAddress, "Specify the host address to publish the port, "+
+		"e.g. 127.0.0.1, default is all addresses for the container, or the runtime default for the executable binary.")
 	c.Flags().BoolVar(&dryRun, "dry-run", dryRun, "Print the command that would be executed, but do not execute it.")
 	return c
 }
 
-func isDockerGPUSupported(ctx context.Context) bool {
-	bs, err := exec.
-		CommandContext(ctx, "docker", "info", "--format", "json").
-		CombinedOutput()
+// runFlags holds the flags to build the command of a model,
+// which are shared by run and serve.
+type runFlags struct {
+	by          string
+	runtime     string
+	engine      string
+	gpus        string
+	profile     string
+	autoOffload bool
+	lazyPull    bool
+	env         []string
+	cpus        float64
+	memory      string
+	mounts      []string
+	workdir     string
+	network     string
+
+	// name and publishAddress are given by run only.
+	name           string
+	publishAddress string
+
+	fs *pflag.FlagSet
+}
+
+func newRunFlags() runFlags {
+	return runFlags{
+		runtime: runtimes[0].Name(),
+		gpus:    gpuKindAuto,
+	}
+}
+
+func (f *runFlags) addFlags(fs *pflag.FlagSet) {
+	f.fs = fs
+	fs.StringVar(&f.by, "by", f.by, "Specify how to run the model, default is the container image of the runtime, "+
+		"or the executable binary if the runtime has no container image. "+
+		"If given a strict format container image reference, it will be run via container engine, "+
+		"otherwise it will be run via executable binary.")
+	fs.StringVar(&f.runtime, "runtime", f.runtime, "Specify the runtime to map the model to its arguments, "+
+		"select from "+sprintf(getRuntimeNames())+". "+
+		"If not given, it is chosen by the executable binary of --by, e.g. llama-box.")
+	fs.StringVar(&f.engine, "engine", f.engine, "Specify the container engine to run the container image, "+
+		"select from "+sprintf(getContainerEngineNames())+", "+
+		"default is the first one found in the PATH.")
+	fs.StringVar(&f.gpus, "gpus", f.gpus, "Specify the GPUs to expose to the container, "+
+		"select from "+sprintf(gpuKinds)+", "+
+		"nvidia uses the NVIDIA container runtime, nvidia-cdi uses the NVIDIA Container Device Interface, "+
+		"auto detects the GPUs supported by the container engine.")
+	fs.StringVar(&f.profile, "profile", f.profile, "Specify the device profile to choose the split and offload flags, "+
+		"the flags given explicitly take precedence, see \"devices\" command.")
+	fs.BoolVar(&f.autoOffload, "auto-offload", f.autoOffload, "Choose the offload layers, the tensor split and, if needed, a reduced context size, "+
+		"which fit the free VRAM of the local GPUs, the flags given explicitly take precedence.")
+	fs.BoolVar(&f.lazyPull, "lazy-pull", f.lazyPull, "Stream the model files by range requests instead of pulling the whole layers, "+
+		"the runtime starts after all files are fetched and verified against the layer digests, "+
+		"an interrupted streaming is resumed by the next run or pull, "+
+		"falls back to pull if the layers are compressed or the registry does not support range requests.")
+	fs.StringArrayVarP(&f.env, "env", "e", f.env, "Specify the environment variable in KEY=VALUE, "+
+		"or KEY to pass the variable of the host by name, whose value is never recorded, can be given multiple times.")
+	fs.Float64Var(&f.cpus, "cpus", f.cpus, "Specify the number of CPUs to limit, "+
+		"the executable binary is limited via systemd-run, zero means no limit.")
+	fs.StringVar(&f.memory, "memory", f.memory, "Specify the memory to limit, e.g. 16GiB, "+
+		"the executable binary is limited via systemd-run, empty means no limit.")
+	fs.StringArrayVar(&f.mounts, "mount", f.mounts, "Specify the directory to bind-mount into the container in SRC[:DST][:ro], "+
+		"e.g. LoRA adapters or prompt caches, the destination defaults to the absolute source, "+
+		"not supported by the executable binary, can be given multiple times.")
+	fs.StringVar(&f.workdir, "workdir", f.workdir, "Specify the working directory, e.g. of the prompt caches, "+
+		"which must be absolute in the container, or an existing directory of the host for the executable binary.")
+	fs.StringVar(&f.network, "network", f.network, "Specify the network of the container, "+
+		"the executable binary allows host only.")
+}
+
+// getRuntime returns the runtime selected by the flags.
+func (f *runFlags) getRuntime() (Runtime, error) {
+	rt, err := getRuntime(f.runtime)
 	if err != nil {
-		return false
+		return nil, err
+	}
+	if (f.fs == nil || !f.fs.Changed("runtime")) && f.by != "" {
+		// Choose the runtime by the binary, e.g. --by llama-box.
+		if brt := getRuntimeByBinary(f.by); brt != nil {
+			rt = brt
+		}
+	}
+	return rt, nil
+}
+
+// runNameRegex matches the name given by --name, which is also a valid container name.
+var runNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// resources validates the resource flags for the container or the executable binary,
+// returns the environment variables, the mounts, the working directory and the memory limit in bytes.
+func (f *runFlags) resources(isByContainer, detach bool) (env []string, mounts []runMount, workdir string, memory uint64, err error) {
+	if f.name != "" {
+		if !runNameRegex.MatchString(f.name) {
+			return nil, nil, "", 0, fmt.Errorf("invalid name %q, must match %s", f.name, runNameRegex)
+		}
+		if !isByContainer && !detach {
+			return nil, nil, "", 0, errors.New("--name requires --detach to name the instance of the executable binary")
+		}
+		if detach && osx.ExistsDir(getRunInstanceStorePath(f.name)) {
+			return nil, nil, "", 0, fmt.Errorf("instance %q already exists", f.name)
+		}
+	}
+	for _, e := range f.env {
+		if k, _, ok := strings.Cut(e, "="); ok {
+			if k == "" {
+				return nil, nil, "", 0, fmt.Errorf("invalid environment variable %q", e)
+			}
+			env = append(env, e)
+		} else if _, ok := os.LookupEnv(e); ok {
+			// Keep the variable of the host by name,
+			// so that its value is never recorded, e.g. in the instance.
+			env = append(env, e)
+		}
+	}
+	if f.cpus < 0 {
+		return nil, nil, "", 0, fmt.Errorf("invalid --cpus %v", f.cpus)
+	}
+	if f.memory != "" {
+		m, err := ggufparser.ParseGGUFBytesScalar(f.memory)
+		if err != nil || m == 0 {
+			return nil, nil, "", 0, fmt.Errorf("invalid --memory %q", f.memory)
+		}
+		memory = uint64(m)
+	}
+	if !isByContainer && len(f.mounts) != 0 {
+		return nil, nil, "", 0, errors.New("--mount requires a container, the executable binary sees the host paths as is, " +
+			"see --workdir to run it in a directory")
+	}
+	for _, s := range f.mounts {
+		m, err := parseRunMount(s)
+		if err != nil {
+			return nil, nil, "", 0, err
+		}
+		mounts = append(mounts, m)
+	}
+	if workdir = f.workdir; workdir != "" {
+		if isByContainer {
+			if !path.IsAbs(workdir) {
+				return nil, nil, "", 0, fmt.Errorf("invalid --workdir %q, must be absolute in the container", workdir)
+			}
+		} else {
+			if workdir, err = filepath.Abs(osx.InlineTilde(workdir)); err != nil {
+				return nil, nil, "", 0, fmt.Errorf("invalid --workdir %q: %w", f.workdir, err)
+			}
+			if !osx.ExistsDir(workdir) {
+				return nil, nil, "", 0, fmt.Errorf("invalid --workdir %q, directory not found", f.workdir)
+			}
+		}
+	}
+	if !isByContainer && f.network != "" && f.network != "host" {
+		return nil, nil, "", 0, fmt.Errorf("--network %s: the executable binary runs in the host network", f.network)
+	}
+	return env, mounts, workdir, memory, nil
+}
+
+// scopeArgs returns the systemd-run arguments to run the executable binary in a transient scope unit,
+// which limits the CPUs and the given memory in bytes via cgroup, nil if no limit.
+func (f *runFlags) scopeArgs(memory uint64) []string {
+	if f.cpus <= 0 && memory == 0 {
+		return nil
+	}
+	args := []string{"--scope", "--quiet", "--collect"}
+	if os.Geteuid() > 0 {
+		args = append(args, "--user")
+	}
+	if f.cpus > 0 {
+		args = append(args, "--property", fmt.Sprintf("CPUQuota=%d%%", int(math.Round(f.cpus*100))))
+	}
+	if memory > 0 {
+		args = append(args, "--property", fmt.Sprintf("MemoryMax=%d", memory))
+	}
+	return args
+}
+
+// runMount is a bind mount given by --mount.
+type runMount struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+// parseRunMount parses the given mount in SRC[:DST][:ro|rw],
+// the source is made absolute, and the target defaults to the source.
+func parseRunMount(s string) (m runMount, err error) {
+	ss := strings.Split(s, ":")
+	if n := len(ss); n > 1 && (ss[n-1] == "ro" || ss[n-1] == "rw") {
+		m.ReadOnly = ss[n-1] == "ro"
+		ss = ss[:n-1]
+	}
+	if len(ss) > 2 || ss[0] == "" {
+		return m, fmt.Errorf("invalid mount %q, must be SRC[:DST][:ro]", s)
+	}
+	if m.Source, err = filepath.Abs(ss[0]); err != nil {
+		return m, fmt.Errorf("getting absolute path of %s: %w", ss[0], err)
+	}
+	if !osx.ExistsDir(m.Source) && !osx.ExistsFile(m.Source) {
+		return m, fmt.Errorf("mount source %s not found", m.Source)
 	}
+	m.Target = m.Source
+	if len(ss) == 2 {
+		if !path.IsAbs(ss[1]) {
+			return m, fmt.Errorf("invalid mount %q, the destination must be absolute", s)
+		}
+		m.Target = ss[1]
+	}
+	return m, nil
+}
 
-	var r struct {
-		Runtimes map[string]any `json:"Runtimes"`
+// String returns the --volume value of the container engine.
+func (m runMount) String() string {
+	return m.Source + ":" + m.Target + tenary(m.ReadOnly, ":ro", "").(string)
+}
+
+// runPlan holds the command to run a model.
+type runPlan struct {
+	// Runtime is the runtime of the command.
+	Runtime Runtime
+	// Model is the model reference.
+	Model string
+	// ModelID is the model ID.
+	ModelID string
+	// InstanceID is the instance ID, empty if not detached.
+	InstanceID string
+	// Container is true if the command runs a container.
+	Container bool
+	// Exec is the executable, the container engine if Container.
+	Exec string
+	// Args are the arguments of the executable.
+	Args []string
+	// Env are the environment variables of the executable binary in KEY=VALUE, or KEY to inherit from the host,
+	// which are passed via --env to the container instead if Container.
+	Env []string
+	// Dir is the working directory of the executable binary, empty means the current one,
+	// which is passed via --workdir to the container instead if Container.
+	Dir string
+	// Host is the address to probe on the host, empty means the loopback.
+	Host string
+	// Port is the port to probe on the host, zero means the runtime does not serve.
+	Port int
+	// Usage is the gguf.model.usage label of the model.
+	Usage string
+	// Files are the generated runtime files, which are placed in FilesDir on the host.
+	Files map[string][]byte
+	// FilesDir is the directory of the generated runtime files on the host.
+	FilesDir string
+	// FilesPath returns the path of the given generated runtime file as seen by the runtime.
+	FilesPath func(name string) string
+}
+
+// plan builds the command of the given model and arguments,
+// the model is pulled if not found locally.
+func (f *runFlags) plan(c *cobra.Command, app string, args []string, detach, dryRun bool) (rp runPlan, err error) {
+	rt, err := f.getRuntime()
+	if err != nil {
+		return rp, err
 	}
-	if err = json.Unmarshal(bs, &r); err != nil {
-		return false
+	by := f.by
+	if by == "" {
+		by = tenary(rt.Image() != "", rt.Image(), rt.Binary()).(string)
 	}
 
-	_, ok := r.Runtimes["nvidia"]
-	return ok
+	isByContainer := true
+	if _, err := name.ParseReference(by, name.StrictValidation); err != nil {
+		isByContainer = false
+		if !dryRun {
+			if _, err = exec.LookPath(by); err != nil {
+				return rp, fmt.Errorf("looking up binary %s: %v", by, err)
+			}
+		}
+	}
+
+	if f.autoOffload && f.profile != "" {
+		return rp, errors.New("--auto-offload and --profile are mutually exclusive")
+	}
+	env, mounts, workdir, memory, err := f.resources(isByContainer, detach)
+	if err != nil {
+		return rp, err
+	}
+	rm, err := resolveRunModel(c, app, f.profile, args, f.lazyPull)
+	if err != nil {
+		return rp, err
+	}
+	if f.autoOffload {
+		cmd := rm.Config.Config.Cmd
+		oargs, err := getAutoOffloadArgs(c.Context(), c.ErrOrStderr(), getGPUDetector(), rm.Config, rm.LayersPath,
+			append(cmd[:len(cmd):len(cmd)], rm.Args[1:]...))
+		if err != nil {
+			return rp, err
+		}
+		rm.Args = append(rm.Args, oargs...)
+	}
+	var (
+		cfp, lsp = rm.ConfigPath, rm.LayersPath
+		img      = rm.Config
+		port     = rm.Port
+	)
+	args = rm.Args
+
+	rp = runPlan{
+		Runtime:   rt,
+		Model:     args[0],
+		ModelID:   filepath.Base(cfp),
+		Container: isByContainer,
+		Usage:     img.Config.Labels["gguf.model.usage"],
+		Host:      f.publishAddress,
+	}
+	if rt.Port() != 0 {
+		rp.Port = tenary(port != 0, port, rt.Port()).(int)
+	}
+
+	// Place the generated files of the detached instance in its store path,
+	// which lives until the instance is stopped.
+	if detach {
+		rp.InstanceID = tenary(f.name != "", f.name, stringx.RandomHex(6)).(string)
+		rp.FilesDir = filepath.Join(getRunInstanceStorePath(rp.InstanceID), "runtime")
+	} else {
+		rp.FilesDir = filepath.Join(os.TempDir(), "gp-"+stringx.RandomHex(4))
+	}
+
+	ri := runtimeInput{
+		Name:   args[0],
+		Config: img.Config,
+		Exec:   by,
+		Dir:    lsp,
+		GenDir: rp.FilesDir,
+		Join:   filepath.Join,
+		Args:   args[1:],
+		Host:   f.publishAddress,
+		Port:   port,
+	}
+	if isByContainer {
+		ri.Exec = rt.Binary()
+		ri.Dir = "/gp-" + stringx.RandomHex(4)
+		ri.GenDir = ri.Dir + "-runtime"
+		ri.Join = path.Join
+		ri.Host = "0.0.0.0"
+		ri.Port = 0
+		if f.network == "host" {
+			// Listen on the host directly instead of publishing.
+			ri.Host = tenary(f.publishAddress != "", f.publishAddress, ri.Host).(string)
+			ri.Port = rp.Port
+		}
+	}
+	rc, err := rt.Command(ri)
+	if err != nil {
+		return rp, err
+	}
+	rp.Files = rc.Files
+	rp.FilesPath = func(n string) string {
+		return ri.Join(ri.GenDir, n)
+	}
+
+	if !isByContainer {
+		rp.Exec = tenary(rc.Entrypoint != "", rc.Entrypoint, by).(string)
+		rp.Args = rc.Args
+		rp.Env = slices.Concat(rc.Env, env)
+		rp.Dir = workdir
+		// Limit the resources in a transient scope unit.
+		if sargs := f.scopeArgs(memory); len(sargs) != 0 {
+			if !dryRun {
+				if _, err = exec.LookPath("systemd-run"); err != nil {
+					return rp, fmt.Errorf("--cpus and --memory require systemd-run to limit the executable binary: %w", err)
+				}
+			}
+			rp.Args = slices.Concat(sargs, []string{"--", rp.Exec}, rp.Args)
+			rp.Exec = "systemd-run"
+		}
+		return rp, nil
+	}
+
+	eng, err := getContainerEngine(f.engine)
+	if err != nil {
+		return rp, err
+	}
+	gargs, err := getContainerGPUArgs(c.Context(), eng, f.gpus)
+	if err != nil {
+		return rp, err
+	}
+	rp.Exec = eng.Name()
+	if detach {
+		rp.Args = []string{
+			"run",
+			"--detach",
+			"--name", tenary(f.name != "", f.name, "gp-"+rp.InstanceID).(string),
+		}
+	} else {
+		rp.Args = []string{
+			"run",
+			"--rm",
+			"--interactive",
+			"--tty",
+		}
+		if f.name != "" {
+			rp.Args = append(rp.Args,
+				"--name", f.name)
+		}
+	}
+	rp.Args = append(rp.Args, gargs...)
+	if f.cpus > 0 {
+		rp.Args = append(rp.Args,
+			"--cpus", strconv.FormatFloat(f.cpus, 'f', -1, 64))
+	}
+	if memory > 0 {
+		rp.Args = append(rp.Args,
+			"--memory", strconv.FormatUint(memory, 10))
+	}
+	if f.network != "" {
+		rp.Args = append(rp.Args,
+			"--network", f.network)
+	}
+	if rt.Port() != 0 && f.network != "host" {
+		pa := fmt.Sprintf("%d:%d", rp.Port, rt.Port())
+		if f.publishAddress != "" {
+			pa = net.JoinHostPort(f.publishAddress, strconv.Itoa(rp.Port)) + ":" + strconv.Itoa(rt.Port())
+		}
+		rp.Args = append(rp.Args,
+			"--publish", pa)
+	}
+	rp.Args = append(rp.Args,
+		"--volume", fmt.Sprintf("%s:%s", lsp, ri.Dir))
+	if len(rc.Files) != 0 {
+		rp.Args = append(rp.Args,
+			"--volume", fmt.Sprintf("%s:%s", rp.FilesDir, ri.GenDir))
+	}
+	for _, m := range mounts {
+		rp.Args = append(rp.Args,
+			"--volume", m.String())
+	}
+	if workdir != "" {
+		rp.Args = append(rp.Args,
+			"--workdir", workdir)
+	}
+	for _, e := range slices.Concat(rc.Env, env) {
+		rp.Args = append(rp.Args,
+			"--env", e)
+	}
+	if rc.Entrypoint != "" {
+		rp.Args = append(rp.Args,
+			"--entrypoint", rc.Entrypoint)
+	}
+	rp.Args = append(rp.Args, by)
+	rp.Args = append(rp.Args, rc.Args...)
+	return rp, nil
+}
+
+// runModel holds the local model to run.
+type runModel struct {
+	// Config is the config of the model.
+	Config specs.Image
+	// ConfigPath is the store path of the config.
+	ConfigPath string
+	// LayersPath is the store path of the model files.
+	LayersPath string
+	// Args are the model reference and the extra arguments,
+	// the arguments chosen by the device profile are appended, and the --port is removed.
+	Args []string
+	// Port is the value of the --port, zero if not given.
+	Port int
+}
+
+// resolveRunModel resolves the given model and arguments,
+// the model is pulled if not found or streamed partially locally,
+// or streamed via range requests if lazy.
+func resolveRunModel(c *cobra.Command, app, profile string, args []string, lazy bool) (rm runModel, err error) {
+	var cfp, lsp string
+	{
+		model := args[0]
+		rf, err := name.NewTag(model)
+		if err != nil {
+			return rm, fmt.Errorf("parsing model reference %q: %w", model, err)
+		}
+		mdp := getModelMetadataStorePath(rf)
+		switch {
+		case lazy:
+			if err = pullLazily(c, app, model); err != nil {
+				return rm, err
+			}
+		case !osx.ExistsLink(mdp) || isLazyModel(mdp):
+			if err = pull(app).RunE(c, []string{model}); err != nil {
+				return rm, err
+			}
+		}
+		cfp, err = os.Readlink(mdp)
+		if err != nil {
+			return rm, fmt.Errorf("reading link %s: %w", mdp, err)
+		}
+		lsp = convertConfigStorePathToLayersStorePath(cfp)
+	}
+
+	img, err := retrieveConfigByPath(cfp)
+	if err != nil {
+		return rm, err
+	}
+
+	if profile != "" {
+		pargs, err := getDeviceProfileArgs(img, lsp, profile, append(img.Config.Cmd[:len(img.Config.Cmd):len(img.Config.Cmd)], args[1:]...))
+		if err != nil {
+			return rm, err
+		}
+		args = append(args, pargs...)
+	}
+
+	// Extract the port to publish.
+	args, port, err := extractPortArg(args)
+	if err != nil {
+		return rm, err
+	}
+
+	rm.Config, rm.ConfigPath, rm.LayersPath, rm.Args, rm.Port = img, cfp, lsp, args, port
+	return rm, nil
+}
+
+// extractPortArg removes the --port from the given model arguments,
+// and returns the rest arguments and the port, zero if not given.
+func extractPortArg(args []string) ([]string, int, error) {
+	var (
+		port int
+		err  error
+	)
+	args = slices.Clone(args)
+	for i, s := 1, len(args); i < s; i++ {
+		if args[i] == "--port" {
+			if i+1 >= s {
+				return nil, 0, fmt.Errorf("missing value for %q", args[i])
+			}
+			if port, err = strconv.Atoi(args[i+1]); err != nil {
+				return nil, 0, fmt.Errorf("invalid value for %q: %w", args[i], err)
+			}
+			args = append(args[:i], args[i+2:]...)
+			break
+		}
+	}
+	return args, port, nil
+}
+
+// getRunEnviron returns the environment of the executable binary with the given variables,
+// the variables given by name are inherited from the host.
+func getRunEnviron(env []string) []string {
+	environ := os.Environ()
+	for _, e := range env {
+		if strings.Contains(e, "=") {
+			environ = append(environ, e)
+		}
+	}
+	return environ
+}
+
+// print prints the command to the given writer, and the generated files to the given file writer.
+func (rp runPlan) print(w, fw io.Writer) {
+	var sb strings.Builder
+	if rp.Dir != "" {
+		sb.WriteString("cd " + strconvx.Quote(rp.Dir) + " && ")
+	}
+	if !rp.Container {
+		for _, e := range rp.Env {
+			if !strings.Contains(e, "=") {
+				// Refer to the variable of the host instead of printing its value.
+				sb.WriteString(e + "=\"$" + e + "\" ")
+				continue
+			}
+			sb.WriteString(strconvx.Quote(e) + " ")
+		}
+	}
+	sb.WriteString(rp.Exec)
+	for _, a := range rp.Args {
+		sb.WriteString(" " + strconvx.Quote(a))
+	}
+	for n, bs := range rp.Files {
+		fprintf(fw, "# %s\n%s", rp.FilesPath(n), bs)
+	}
+	fprintf(w, "%s", sb.String())
+}
+
+// probeTarget returns the target to probe the running command.
+func (rp runPlan) probeTarget() probeTarget {
+	return probeTarget{
+		URL:        getLocalURL(rp.Host, rp.Port),
+		HealthPath: rp.Runtime.HealthPath(),
+		Model:      rp.Model,
+		Usage:      getProbeUsage(rp.Usage),
+	}
+}
+
+// writeFiles writes the generated runtime files into FilesDir.
+func (rp runPlan) writeFiles() error {
+	for n, bs := range rp.Files {
+		if err := osx.WriteFile(filepath.Join(rp.FilesDir, n), bs, 0644); err != nil {
+			return fmt.Errorf("writing runtime file %s: %w", n, err)
+		}
+	}
+	return nil
+}
+
+// getDeviceProfileArgs returns the llama.cpp arguments chosen by the given device profile,
+// which are absent from the given arguments.
+func getDeviceProfileArgs(cf specs.Image, lsp, profile string, args []string) ([]string, error) {
+	// The arguments take precedence over the profile.
+	ef := newEstimateFlags()
+	ef.profile = profile
+	if err := ef.applyProfile(); err != nil {
+		return nil, err
+	}
+	a, err := llamacpp.ParseArgs(args)
+	if err != nil {
+		return nil, fmt.Errorf("parsing arguments: %w", err)
+	}
+	ef.withArgs(a)
+	eopts, err := ef.options()
+	if err != nil {
+		return nil, err
+	}
+
+	var pargs []string
+	if ef.tensorSplit != "" && len(a.TensorSplit) == 0 {
+		pargs = append(pargs, "--tensor-split", ef.tensorSplit)
+	}
+	if ef.rpcServers != "" && len(a.RPCServers) == 0 {
+		pargs = append(pargs, "--rpc", ef.rpcServers)
+	}
+	if a.GPULayers != nil {
+		return pargs, nil
+	}
+
+	err = inflateConfig(&cf, func(d specs.Descriptor) ([]byte, error) {
+		return os.ReadFile(filepath.Join(lsp, filepath.FromSlash(d.Path)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	fo := estimateFitOptions{
+		OffloadLayersDraft: ptr.From(a.GPULayersDraft, -1),
+		MMap:               !ef.noMMap,
+		TensorSplit:        true,
+		OffloadOnly:        true,
+	}
+	fo.PlatformRAM, fo.PlatformVRAM = ef.platformFootprints()
+	if fo.RAM, fo.VRAMs, err = ef.dp.resources(); err != nil {
+		return nil, err
+	}
+	r, err := estimateFit(cf.Config, eopts, fo)
+	if err != nil {
+		return nil, fmt.Errorf("fitting profile %q: %w", profile, err)
+	}
+	return append(pargs, "--gpu-layers", strconv.FormatUint(r.OffloadLayers, 10)), nil
+}
+
+// startRunInstance starts the command of the given detached plan in background and records the instance,
+// returns the instance and a function to check if the instance is still running.
+func startRunInstance(rp runPlan) (ins runInstance, alive func() bool, err error) {
+	now := time.Now()
+	ins = runInstance{
+		ID:         rp.InstanceID,
+		Model:      rp.Model,
+		ModelID:    rp.ModelID,
+		Runtime:    rp.Runtime.Name(),
+		Host:       rp.Host,
+		Port:       rp.Port,
+		HealthPath: rp.Runtime.HealthPath(),
+		Command:    append([]string{rp.Exec}, rp.Args...),
+		Created:    &now,
+	}
+
+	cmd := exec.Command(rp.Exec, rp.Args...)
+	if rp.Container {
+		ins.Engine = rp.Exec
+		var stderr strings.Builder
+		cmd.Stderr = &stderr
+		bs, err := cmd.Output()
+		if err != nil {
+			_ = removeRunInstance(ins.ID)
+			return ins, nil, fmt.Errorf("starting container: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		ins.Container = strings.TrimSpace(string(bs))
+		alive = func() bool {
+			return ins.State(context.Background()) == "running"
+		}
+	} else {
+		if len(rp.Env) != 0 {
+			cmd.Env = getRunEnviron(rp.Env)
+		}
+		cmd.Dir = rp.Dir
+		lf, err := osx.CreateFile(getRunInstanceLogPath(ins.ID), 0644)
+		if err != nil {
+			return ins, nil, fmt.Errorf("creating log file: %w", err)
+		}
+		defer func() { _ = lf.Close() }()
+		cmd.Stdout = lf
+		cmd.Stderr = lf
+		cmd.SysProcAttr = detachedProcAttr()
+		if err = cmd.Start(); err != nil {
+			_ = removeRunInstance(ins.ID)
+			return ins, nil, fmt.Errorf("starting process: %w", err)
+		}
+		ins.PID = cmd.Process.Pid
+		ins.PIDStarted, _ = getProcessStartTime(ins.PID)
+		exited := make(chan struct{})
+		go func() {
+			_ = cmd.Wait()
+			close(exited)
+		}()
+		alive = func() bool {
+			select {
+			case <-exited:
+				return false
+			default:
+				return true
+			}
+		}
+	}
+	if err = saveRunInstance(ins); err != nil {
+		return ins, nil, err
+	}
+	return ins, alive, nil
 }
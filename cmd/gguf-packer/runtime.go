@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	specs "github.com/gpustack/gguf-packer-go/buildkit/frontend/specs/v1"
+	"github.com/gpustack/gguf-packer-go/llamacpp"
+)
+
+// Runtime maps a model to the command of a specific inference runtime,
+// which is selected by the --runtime flag of run.
+type Runtime interface {
+	// Name returns the name of the runtime.
+	Name() string
+	// Binary returns the default executable binary of the runtime.
+	Binary() string
+	// Image returns the default container image of the runtime,
+	// empty means the runtime is run via executable binary by default.
+	Image() string
+	// Port returns the default listening port of the runtime,
+	// zero means the runtime does not serve.
+	Port() int
+	// HealthPath returns the HTTP path to probe the health of the runtime,
+	// empty means the runtime does not serve.
+	HealthPath() string
+	// Command returns the command to run the given model.
+	Command(in runtimeInput) (runtimeCommand, error)
+}
+
+// runtimeHealthCommander is implemented by the Runtime,
+// whose container image has no HTTP client to probe the HealthPath,
+// the returned command probes the health inside the container instead.
+type runtimeHealthCommander interface {
+	HealthCommand() []string
+}
+
+// runtimeInput holds the input of a Runtime to generate the command.
+type runtimeInput struct {
+	// Name is the name of the model, e.g. gpustack/qwen2:0.5b-instruct.
+	Name string
+	// Config is the config of the model.
+	Config specs.ImageConfig
+	// Exec is the executable of the runtime as seen by the runtime.
+	Exec string
+	// Dir is the directory of the model files as seen by the runtime.
+	Dir string
+	// GenDir is the directory of the generated files as seen by the runtime.
+	GenDir string
+	// Join joins the path elements as seen by the runtime.
+	Join func(elem ...string) string
+	// Args are the extra llama.cpp arguments given by the user.
+	Args []string
+	// Host is the address to listen, empty means the runtime default.
+	Host string
+	// Port is the port to listen, zero means the runtime default.
+	Port int
+}
+
+// cmdArgs returns the CMD of the model,
+// the model file paths and the -file suffixed flag values are joined with the model directory.
+func (in runtimeInput) cmdArgs() []string {
+	cfg := in.Config
+	args := slices.Clone(cfg.Cmd)
+	for _, v := range append([]*specs.GGUFFile{cfg.Model, cfg.Drafter, cfg.Projector}, cfg.Adapters...) {
+		if v == nil {
+			continue
+		}
+		args[v.CmdParameterIndex] = in.Join(in.Dir, v.CmdParameterValue)
+	}
+	for i, s := 0, len(args); i < s; i++ {
+		if strings.HasPrefix(args[i], "-") && strings.HasSuffix(args[i], "-file") && i+1 < s {
+			i++
+			args[i] = in.Join(in.Dir, args[i])
+		}
+	}
+	return args
+}
+
+// runtimeCommand holds the command generated by a Runtime.
+type runtimeCommand struct {
+	// Entrypoint overrides the executable of the runtime if not empty.
+	Entrypoint string
+	// Args are the arguments.
+	Args []string
+	// Env are the environment variables in form of KEY=VALUE.
+	Env []string
+	// Files are the generated files, which are placed in the GenDir of the runtimeInput.
+	Files map[string][]byte
+}
+
+// runtimes are the available runtimes, the first one is the default.
+var runtimes = []Runtime{
+	llamaCppServerRuntime{},
+	llamaBoxRuntime{},
+	llamaCppCLIRuntime{},
+	ollamaRuntime{},
+}
+
+// getRuntime returns the runtime of the given name.
+func getRuntime(name string) (Runtime, error) {
+	for _, rt := range runtimes {
+		if rt.Name() == name {
+			return rt, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown runtime %q, select from %v", name, getRuntimeNames())
+}
+
+// getRuntimeByBinary returns the runtime whose default binary is the base name of the given binary,
+// or nil if not found.
+func getRuntimeByBinary(bin string) Runtime {
+	bn := strings.TrimSuffix(filepath.Base(bin), filepath.Ext(bin))
+	for _, rt := range runtimes {
+		if rt.Binary() == bn {
+			return rt
+		}
+	}
+	return nil
+}
+
+func getRuntimeNames() []string {
+	ns := make([]string, len(runtimes))
+	for i := range runtimes {
+		ns[i] = runtimes[i].Name()
+	}
+	return ns
+}
+
+// llamaCppServerRuntime runs the model by llama.cpp server,
+// see https://github.com/ggerganov/llama.cpp/tree/master/examples/server.
+type llamaCppServerRuntime struct{}
+
+func (llamaCppServerRuntime) Name() string {
+	return "llama.cpp"
+}
+
+func (llamaCppServerRuntime) Binary() string {
+	return "llama-server"
+}
+
+func (llamaCppServerRuntime) Image() string {
+	return "ghcr.io/ggerganov/llama.cpp:server"
+}
+
+func (llamaCppServerRuntime) Port() int {
+	return 8080
+}
+
+func (llamaCppServerRuntime) HealthPath() string {
+	return "/health"
+}
+
+func (llamaCppServerRuntime) Command(in runtimeInput) (rc runtimeCommand, err error) {
+	rc.Args = append(in.cmdArgs(), in.Args...)
+	if in.Host != "" {
+		rc.Args = append(rc.Args, "--host", in.Host)
+	}
+	if in.Port != 0 {
+		rc.Args = append(rc.Args, "--port", strconv.Itoa(in.Port))
+	}
+	return rc, nil
+}
+
+// llamaBoxRuntime runs the model by llama-box,
+// which shares the arguments with llama.cpp server,
+// see https://github.com/gpustack/llama-box.
+type llamaBoxRuntime struct {
+	llamaCppServerRuntime
+}
+
+func (llamaBoxRuntime) Name() string {
+	return "llama-box"
+}
+
+func (llamaBoxRuntime) Binary() string {
+	return "llama-box"
+}
+
+func (llamaBoxRuntime) Image() string {
+	return ""
+}
+
+// llamaCppCLIRuntime runs the model by llama.cpp cli interactively,
+// the server only arguments are removed,
+// see https://github.com/ggerganov/llama.cpp/tree/master/examples/main.
+type llamaCppCLIRuntime struct{}
+
+func (llamaCppCLIRuntime) Name() string {
+	return "llama-cli"
+}
+
+func (llamaCppCLIRuntime) Binary() string {
+	return "llama-cli"
+}
+
+func (llamaCppCLIRuntime) Image() string {
+	return "ghcr.io/ggerganov/llama.cpp:light"
+}
+
+func (llamaCppCLIRuntime) Port() int {
+	return 0
+}
+
+func (llamaCppCLIRuntime) HealthPath() string {
+	return ""
+}
+
+// llamaCppServerOnlyFlags are the server only flags of llama.cpp,
+// the value is true if the flag takes a value.
+var llamaCppServerOnlyFlags = map[string]bool{
+	"--host":                    true,
+	"--port":                    true,
+	"--path":                    true,
+	"--api-key":                 true,
+	"--api-key-file":            true,
+	"--ssl-key-file":            true,
+	"--ssl-cert-file":           true,
+	"-to":                       true,
+	"--timeout":                 true,
+	"--threads-http":            true,
+	"-a":                        true,
+	"--alias":                   true,
+	"--slot-save-path":          true,
+	"-np":                       true,
+	"--parallel":                true,
+	"-sps":                      true,
+	"--slot-prompt-similarity":  true,
+	"--metrics":                 false,
+	"--slots":                   false,
+	"--no-slots":                false,
+	"--props":                   false,
+	"--embedding":               false,
+	"--embeddings":              false,
+	"--reranking":               false,
+	"--rerank":                  false,
+	"-cb":                       false,
+	"--cont-batching":           false,
+	"-nocb":                     false,
+	"--no-cont-batching":        false,
+	"--lora-init-without-apply": false,
+	"--system-prompt-file":      true,
+	"--cache-reuse":             true,
+	"--spm-infill":              false,
+}
+
+func (llamaCppCLIRuntime) Command(in runtimeInput) (rc runtimeCommand, err error) {
+	args := append(in.cmdArgs(), in.Args...)
+	for i, s := 0, len(args); i < s; i++ {
+		f, _, hasV := strings.Cut(args[i], "=")
+		withV, ok := llamaCppServerOnlyFlags[f]
+		if !ok {
+			rc.Args = append(rc.Args, args[i])
+			continue
+		}
+		if withV && !hasV {
+			i++
+		}
+	}
+	return rc, nil
+}
+
+// ollamaRuntime runs the model by ollama serve,
+// the model is created from a generated Modelfile after serving,
+// see https://github.com/ollama/ollama/blob/main/docs/modelfile.md.
+type ollamaRuntime struct{}
+
+func (ollamaRuntime) Name() string {
+	return "ollama"
+}
+
+func (ollamaRuntime) Binary() string {
+	return "ollama"
+}
+
+func (ollamaRuntime) Image() string {
+	return "docker.io/ollama/ollama:latest"
+}
+
+func (ollamaRuntime) Port() int {
+	return 11434
+}
+
+func (ollamaRuntime) HealthPath() string {
+	return "/api/version"
+}
+
+func (ollamaRuntime) HealthCommand() []string {
+	return []string{"ollama", "list"}
+}
+
+func (r ollamaRuntime) Command(in runtimeInput) (rc runtimeCommand, err error) {
+	a, err := llamacpp.ParseArgs(append(in.cmdArgs(), in.Args...))
+	if err != nil {
+		return rc, fmt.Errorf("parsing arguments: %w", err)
+	}
+	if a.Model == "" {
+		return rc, fmt.Errorf("model %q has no model file", in.Name)
+	}
+
+	mf := &bytes.Buffer{}
+	fprintf(mf, "FROM %s\n", a.Model)
+	if a.MMProj != "" {
+		fprintf(mf, "FROM %s\n", a.MMProj)
+	}
+	for _, l := range a.LoRAs {
+		fprintf(mf, "ADAPTER %s\n", l)
+	}
+	if a.ContextSize != nil {
+		fprintf(mf, "PARAMETER num_ctx %d\n", *a.ContextSize)
+	}
+	if a.BatchSize != nil {
+		fprintf(mf, "PARAMETER num_batch %d\n", *a.BatchSize)
+	}
+	if a.GPULayers != nil {
+		fprintf(mf, "PARAMETER num_gpu %d\n", *a.GPULayers)
+	}
+	if a.MainGPU != nil {
+		fprintf(mf, "PARAMETER main_gpu %d\n", *a.MainGPU)
+	}
+	rc.Files = map[string][]byte{"Modelfile": mf.Bytes()}
+
+	if in.Host != "" || in.Port != 0 {
+		rc.Env = append(rc.Env, fmt.Sprintf("OLLAMA_HOST=%s:%d",
+			tenary(in.Host != "", in.Host, "127.0.0.1"), tenary(in.Port != 0, in.Port, r.Port())))
+	}
+	if a.Parallel != nil {
+		rc.Env = append(rc.Env, fmt.Sprintf("OLLAMA_NUM_PARALLEL=%d", *a.Parallel))
+	}
+	if a.FlashAttention {
+		rc.Env = append(rc.Env, "OLLAMA_FLASH_ATTENTION=1")
+	}
+	if a.CacheTypeK != nil {
+		rc.Env = append(rc.Env, "OLLAMA_KV_CACHE_TYPE="+strings.ToLower(a.CacheTypeK.String()))
+	}
+
+	// Serve in background, create the model once ready, and wait for the server.
+	var (
+		exe = shellQuote(in.Exec)
+		mfp = shellQuote(in.Join(in.GenDir, "Modelfile"))
+	)
+	script := exe + " serve & " +
+		"until " + exe + " list >/dev/null 2>&1; do sleep 1; done; " +
+		exe + " create " + shellQuote(in.Name) + " -f " + mfp + " || exit 1; " +
+		"wait"
+	rc.Entrypoint = "/bin/sh"
+	rc.Args = []string{"-c", script}
+	return rc, nil
+}
+
+// shellQuote quotes the given string for POSIX shell if needed.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:@=+,", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
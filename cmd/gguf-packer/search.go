@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+)
+
+func search(app string) *cobra.Command {
+	var (
+		insecure bool
+		registry = name.DefaultRegistry
+		limit    int
+	)
+	c := &cobra.Command{
+		Use:   "search QUERY",
+		Short: "Search the model repositories in the registry.",
+		Long: "Search the model repositories in the registry via the catalog API, " +
+			"which is not supported by all registries, e.g. Docker Hub.",
+		Example: sprintf(`  # Search the repositories containing qwen
+  %s search qwen --registry registry.example.com
+
+  # Search the repositories matching a glob pattern
+  %[1]s search 'gpustack/qwen*' --registry registry.example.com`, app),
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			query := args[0]
+			if _, err := path.Match(query, ""); err != nil {
+				return fmt.Errorf("parsing query %q: %w", query, err)
+			}
+
+			var cos crane.Options
+			{
+				co := []crane.Option{
+					getAuthnKeychainOption(),
+					crane.WithContext(c.Context()),
+				}
+				if insecure {
+					co = append(co, crane.Insecure)
+				}
+				cos = crane.GetOptions(co...)
+			}
+
+			rg, err := name.NewRegistry(registry, cos.Name...)
+			if err != nil {
+				return fmt.Errorf("parsing registry %q: %w", registry, err)
+			}
+			rps, err := remote.Catalog(c.Context(), rg, cos.Remote...)
+			if err != nil {
+				return fmt.Errorf("listing catalog of %q: %w", rg.Name(), err)
+			}
+
+			sis := []searchItem{}
+			for _, rp := range rps {
+				if !matchSearchQuery(query, rp) {
+					continue
+				}
+				sis = append(sis, searchItem{
+					Name: rp,
+					Repo: rg.Repo(rp).Name(),
+				})
+				if limit > 0 && len(sis) >= limit {
+					break
+				}
+			}
+
+			return render(c, sis, func() (hds, bds [][]any, border bool) {
+				hds = [][]any{
+					{"Name", "Repo"},
+				}
+				bds = make([][]any, len(sis))
+				for i, si := range sis {
+					bds[i] = []any{si.Name, si.Repo}
+				}
+				return hds, bds, false
+			})
+		},
+	}
+	c.Flags().BoolVar(&insecure, "insecure", insecure, "Allow the registry to be fetched without TLS.")
+	c.Flags().StringVar(&registry, "registry", registry, "Specify the registry to search.")
+	c.Flags().IntVar(&limit, "limit", limit, "Specify the maximum number of results, zero means no limit.")
+	return c
+}
+
+// searchItem holds a repository of the registry.
+type searchItem struct {
+	Name string `json:"name"`
+	Repo string `json:"repo"`
+}
+
+// matchSearchQuery returns true if the given repository matches the query,
+// which is a glob pattern if it contains any wildcard, otherwise, a case-insensitive substring.
+func matchSearchQuery(query, repo string) bool {
+	if strings.ContainsAny(query, "*?[") {
+		m, _ := path.Match(query, repo)
+		return m
+	}
+	return strings.Contains(strings.ToLower(repo), strings.ToLower(query))
+}
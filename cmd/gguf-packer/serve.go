@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+)
+
+func serve(app string) *cobra.Command {
+	var (
+		rf          = newRunFlags()
+		host        = "127.0.0.1"
+		port        = 8000
+		lazy        bool
+		idleTimeout time.Duration
+	)
+	c := &cobra.Command{
+		Use:   "serve MODEL [MODEL...] [-- ARG...]",
+		Short: "Serve several models behind one OpenAI-compatible endpoint.",
+		Long: "Serve several models behind one OpenAI-compatible endpoint, " +
+			"each model is run in background on an ephemeral port as run --detach does, " +
+			"and the requests are routed to the model by the \"model\" field.",
+		Example: sprintf(`  # Serve several models
+  %s serve gpustack/qwen2:0.5b-instruct gpustack/qwen2:1.5b-instruct
+
+  # Serve several models with customized arguments
+  %[1]s serve gpustack/qwen2:0.5b-instruct gpustack/qwen2:1.5b-instruct -- -c 8192 -np 4
+
+  # Start the models on the first request, and stop them after 10 minutes idle
+  %[1]s serve gpustack/qwen2:0.5b-instruct gpustack/qwen2:1.5b-instruct --lazy --idle-timeout 10m
+
+  # Chat with a served model
+  curl http://127.0.0.1:8000/v1/chat/completions \
+    -d '{"model":"gpustack/qwen2:0.5b-instruct","messages":[{"role":"user","content":"Hi"}]}'`, app),
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			models, margs := args, []string(nil)
+			if i := c.ArgsLenAtDash(); i >= 0 {
+				models, margs = args[:i], args[i:]
+			}
+			if len(models) == 0 {
+				return errors.New("requires at least 1 model")
+			}
+			for _, a := range margs {
+				if a == "--port" || strings.HasPrefix(a, "--port=") {
+					return errors.New("--port is chosen for each model, see --port of serve for the endpoint")
+				}
+			}
+			// Publish the models on the loopback only, which are reached via the endpoint.
+			rf.publishAddress = "127.0.0.1"
+
+			rt, err := rf.getRuntime()
+			if err != nil {
+				return err
+			}
+			if rt.Port() == 0 {
+				return fmt.Errorf("runtime %q does not serve", rt.Name())
+			}
+
+			sbs := make([]*serveBackend, 0, len(models))
+			sbm := make(map[string]*serveBackend, len(models))
+			for _, model := range models {
+				ref, err := name.NewTag(model)
+				if err != nil {
+					return fmt.Errorf("parsing model reference %q: %w", model, err)
+				}
+				n := strings.TrimPrefix(ref.Context().Name(), dockerRegPrefix) + ":" + ref.TagStr()
+				if _, ok := sbm[n]; ok {
+					return fmt.Errorf("duplicated model %q", n)
+				}
+				sb := &serveBackend{
+					name: n,
+					args: append([]string{n}, margs...),
+				}
+				sbs = append(sbs, sb)
+				sbm[n] = sb
+			}
+
+			// Stop the backends at exiting.
+			defer func() {
+				for _, sb := range sbs {
+					sb.stop()
+				}
+			}()
+
+			for _, sb := range sbs {
+				sb.launch = func(ctx context.Context, port int) (serveInstance, error) {
+					rp, err := rf.plan(c, app, append(sb.args[:len(sb.args):len(sb.args)], "--port", strconv.Itoa(port)), true, false)
+					if err != nil {
+						return serveInstance{}, err
+					}
+					return launchServeInstance(ctx, sb.name, rp)
+				}
+				if lazy {
+					// Pull the model and validate the arguments in advance.
+					if _, err = rf.plan(c, app, sb.args, false, true); err != nil {
+						return err
+					}
+					continue
+				}
+				if err = sb.start(c.Context()); err != nil {
+					return err
+				}
+				fprintf(c.ErrOrStderr(), "Started %s as instance %s\n", sb.name, sb.ins.ID)
+			}
+
+			if idleTimeout > 0 {
+				go func() {
+					t := time.NewTicker(min(idleTimeout/2, 10*time.Second))
+					defer t.Stop()
+					for {
+						select {
+						case <-c.Context().Done():
+							return
+						case <-t.C:
+						}
+						for _, sb := range sbs {
+							if sb.stopIfIdle(idleTimeout) {
+								fprintf(c.ErrOrStderr(), "Stopped %s after idle\n", sb.name)
+							}
+						}
+					}
+				}()
+			}
+
+			srv := &http.Server{
+				Addr:              net.JoinHostPort(host, strconv.Itoa(port)),
+				Handler:           newServeHandler(sbs, sbm),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			go func() {
+				<-c.Context().Done()
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				_ = srv.Shutdown(ctx)
+			}()
+			fprintf(c.ErrOrStderr(), "Serving %d models on http://%s\n", len(sbs), srv.Addr)
+			if err = srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("serving: %w", err)
+			}
+			return nil
+		},
+	}
+	rf.addFlags(c.Flags())
+	c.Flags().StringVar(&host, "host", host, "Specify the address to listen.")
+	c.Flags().IntVar(&port, "port", port, "Specify the port to listen.")
+	c.Flags().BoolVar(&lazy, "lazy", lazy, "Start the model on its first request instead of at startup.")
+	c.Flags().DurationVar(&idleTimeout, "idle-timeout", idleTimeout, "Stop the model after idle for the given duration, "+
+		"which is started again on the next request, zero means never.")
+	return c
+}
+
+// serveBackend holds a model served by serve,
+// which is started on demand and stopped if idle.
+type serveBackend struct {
+	name string
+	args []string
+	// launch starts the model on the given port and waits until it is healthy.
+	launch func(ctx context.Context, port int) (serveInstance, error)
+
+	mu       sync.Mutex
+	ins      *serveInstance
+	proxy    *httputil.ReverseProxy
+	inflight int
+	lastUsed time.Time
+}
+
+// serveInstance holds a healthy instance of a serveBackend.
+type serveInstance struct {
+	ID    string
+	Port  int
+	Alive func() bool
+	Stop  func()
+}
+
+// launchServeInstance starts the given plan as run --detach does, and waits until it is healthy,
+// the instance is removed at stopping.
+func launchServeInstance(ctx context.Context, name string, rp runPlan) (serveInstance, error) {
+	if err := rp.writeFiles(); err != nil {
+		return serveInstance{}, err
+	}
+	ins, alive, err := startRunInstance(rp)
+	if err != nil {
+		return serveInstance{}, err
+	}
+	stop := func() {
+		_ = ins.Stop(context.Background())
+		_ = removeRunInstance(ins.ID)
+	}
+	if err = waitRunInstanceHealthy(ctx, ins, alive); err != nil {
+		stop()
+		if errors.Is(err, errRunInstanceExited) {
+			return serveInstance{}, fmt.Errorf("model %s exited before healthy, see \"logs %s\"", name, ins.ID)
+		}
+		return serveInstance{}, fmt.Errorf("waiting model %s healthy: %w", name, err)
+	}
+	return serveInstance{ID: ins.ID, Port: ins.Port, Alive: alive, Stop: stop}, nil
+}
+
+// start starts the backend on an ephemeral port,
+// must be called with the lock held or before serving.
+func (sb *serveBackend) start(ctx context.Context) error {
+	p, err := getFreePort()
+	if err != nil {
+		return err
+	}
+	si, err := sb.launch(ctx, p)
+	if err != nil {
+		return err
+	}
+	sb.ins = &si
+	u := &url.URL{Scheme: "http", Host: net.JoinHostPort("127.0.0.1", strconv.Itoa(si.Port))}
+	sb.proxy = httputil.NewSingleHostReverseProxy(u)
+	// Flush immediately for the streaming responses.
+	sb.proxy.FlushInterval = -1
+	sb.lastUsed = time.Now()
+	return nil
+}
+
+// acquire returns the proxy of the backend, which is started if not running,
+// the returned function must be called after proxying.
+func (sb *serveBackend) acquire(ctx context.Context) (*httputil.ReverseProxy, func(), error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if sb.ins != nil && !sb.ins.Alive() {
+		sb.stopLocked()
+	}
+	if sb.ins == nil {
+		if err := sb.start(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+	sb.inflight++
+	return sb.proxy, func() {
+		sb.mu.Lock()
+		defer sb.mu.Unlock()
+		sb.inflight--
+		sb.lastUsed = time.Now()
+	}, nil
+}
+
+// stopIfIdle stops the backend if it has been idle longer than the given timeout,
+// returns true if stopped.
+func (sb *serveBackend) stopIfIdle(timeout time.Duration) bool {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if sb.ins == nil || sb.inflight > 0 || time.Since(sb.lastUsed) < timeout {
+		return false
+	}
+	sb.stopLocked()
+	return true
+}
+
+func (sb *serveBackend) stop() {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	sb.stopLocked()
+}
+
+func (sb *serveBackend) stopLocked() {
+	if sb.ins == nil {
+		return
+	}
+	sb.ins.Stop()
+	sb.ins, sb.proxy = nil, nil
+}
+
+// getFreePort returns a free TCP port of the loopback.
+func getFreePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("getting free port: %w", err)
+	}
+	defer func() { _ = l.Close() }()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// openAIModel holds a model of the OpenAI models API.
+type openAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// newServeHandler returns the OpenAI-compatible handler,
+// which lists the models and routes the other requests by the "model" field of the JSON body.
+func newServeHandler(sbs []*serveBackend, sbm map[string]*serveBackend) http.Handler {
+	created := time.Now().Unix()
+	toModel := func(sb *serveBackend) openAIModel {
+		return openAIModel{
+			ID:      sb.name,
+			Object:  "model",
+			Created: created,
+			OwnedBy: "gguf-packer",
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("GET /v1/models", func(w http.ResponseWriter, r *http.Request) {
+		ms := make([]openAIModel, len(sbs))
+		for i := range sbs {
+			ms[i] = toModel(sbs[i])
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": ms})
+	})
+	mux.HandleFunc("GET /v1/models/{model...}", func(w http.ResponseWriter, r *http.Request) {
+		sb, ok := sbm[r.PathValue("model")]
+		if !ok {
+			writeOpenAIError(w, http.StatusNotFound, "model_not_found", fmt.Sprintf("model %q not found", r.PathValue("model")))
+			return
+		}
+		writeJSON(w, http.StatusOK, toModel(sb))
+	})
+	mux.HandleFunc("/v1/", func(w http.ResponseWriter, r *http.Request) {
+		// Read the model from the body, and restore the body for proxying.
+		var m struct {
+			Model string `json:"model"`
+		}
+		if r.Body != nil {
+			bs, err := io.ReadAll(r.Body)
+			if err != nil {
+				writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("reading body: %v", err))
+				return
+			}
+			if len(bs) != 0 && json.Unmarshal(bs, &m) != nil {
+				writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "body is not a JSON object")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(bs))
+			r.ContentLength = int64(len(bs))
+		}
+
+		var sb *serveBackend
+		switch {
+		case m.Model != "":
+			sb = sbm[m.Model]
+		case len(sbs) == 1:
+			sb = sbs[0]
+		}
+		if sb == nil {
+			writeOpenAIError(w, http.StatusNotFound, "model_not_found", fmt.Sprintf("model %q not found", m.Model))
+			return
+		}
+
+		proxy, release, err := sb.acquire(r.Context())
+		if err != nil {
+			writeOpenAIError(w, http.StatusServiceUnavailable, "model_not_ready", err.Error())
+			return
+		}
+		defer release()
+		proxy.ServeHTTP(w, r)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeOpenAIError writes the error in the format of the OpenAI API.
+func writeOpenAIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{
+			"message": message,
+			"type":    "invalid_request_error",
+			"code":    code,
+		},
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeServeBackend returns a backend which launches a HTTP server echoing its name,
+// and counts the launches and stops.
+func fakeServeBackend(t *testing.T, name string, launches, stops *atomic.Int32) *serveBackend {
+	return &serveBackend{
+		name: name,
+		args: []string{name},
+		launch: func(ctx context.Context, port int) (serveInstance, error) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				bs, _ := io.ReadAll(r.Body)
+				writeJSON(w, http.StatusOK, map[string]string{"backend": name, "path": r.URL.Path, "body": string(bs)})
+			}))
+			t.Cleanup(srv.Close)
+			u, _ := url.Parse(srv.URL)
+			p, _ := strconv.Atoi(u.Port())
+			launches.Add(1)
+			var stopped atomic.Bool
+			return serveInstance{
+				ID:    name,
+				Port:  p,
+				Alive: func() bool { return !stopped.Load() },
+				Stop: func() {
+					stopped.Store(true)
+					stops.Add(1)
+					srv.Close()
+				},
+			}, nil
+		},
+	}
+}
+
+func TestServeHandler(t *testing.T) {
+	var (
+		launches [2]atomic.Int32
+		stops    [2]atomic.Int32
+	)
+	sbs := []*serveBackend{
+		fakeServeBackend(t, "gpustack/a:1", &launches[0], &stops[0]),
+		fakeServeBackend(t, "gpustack/b:1", &launches[1], &stops[1]),
+	}
+	sbm := map[string]*serveBackend{}
+	for _, sb := range sbs {
+		sbm[sb.name] = sb
+	}
+	srv := httptest.NewServer(newServeHandler(sbs, sbm))
+	defer srv.Close()
+
+	post := func(t *testing.T, model string) (int, map[string]string) {
+		t.Helper()
+		resp, err := http.Post(srv.URL+"/v1/chat/completions", "application/json",
+			strings.NewReader(`{"model":"`+model+`","messages":[]}`))
+		if err != nil {
+			t.Fatalf("posting: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var r map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&r)
+		return resp.StatusCode, r
+	}
+
+	t.Run("models", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/v1/models")
+		if err != nil {
+			t.Fatalf("getting: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var r struct {
+			Object string        `json:"object"`
+			Data   []openAIModel `json:"data"`
+		}
+		if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+			t.Fatalf("decoding: %v", err)
+		}
+		if r.Object != "list" || len(r.Data) != 2 || r.Data[0].ID != "gpustack/a:1" || r.Data[1].ID != "gpustack/b:1" {
+			t.Errorf("unexpected models: %+v", r)
+		}
+
+		resp, err = http.Get(srv.URL + "/v1/models/gpustack/b:1")
+		if err != nil {
+			t.Fatalf("getting: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected model found, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("lazy start", func(t *testing.T) {
+		// Listing the models does not start the backends.
+		if n := launches[0].Load() + launches[1].Load(); n != 0 {
+			t.Fatalf("expected no launches before requests, got %d", n)
+		}
+		code, r := post(t, "gpustack/b:1")
+		if code != http.StatusOK || r["backend"] != "gpustack/b:1" {
+			t.Errorf("expected routed to gpustack/b:1, got %d %v", code, r)
+		}
+		if launches[0].Load() != 0 || launches[1].Load() != 1 {
+			t.Errorf("expected only gpustack/b:1 launched, got %d and %d", launches[0].Load(), launches[1].Load())
+		}
+	})
+
+	t.Run("routing", func(t *testing.T) {
+		for _, model := range []string{"gpustack/a:1", "gpustack/b:1", "gpustack/a:1"} {
+			code, r := post(t, model)
+			if code != http.StatusOK || r["backend"] != model || r["path"] != "/v1/chat/completions" {
+				t.Errorf("expected routed to %s, got %d %v", model, code, r)
+			}
+			if !strings.Contains(r["body"], model) {
+				t.Errorf("expected the body is proxied, got %q", r["body"])
+			}
+		}
+		// Started backends are reused.
+		if launches[0].Load() != 1 || launches[1].Load() != 1 {
+			t.Errorf("expected each launched once, got %d and %d", launches[0].Load(), launches[1].Load())
+		}
+
+		if code, _ := post(t, "gpustack/c:1"); code != http.StatusNotFound {
+			t.Errorf("expected unknown model not found, got %d", code)
+		}
+	})
+
+	t.Run("idle stop", func(t *testing.T) {
+		if sbs[0].stopIfIdle(time.Hour) {
+			t.Error("expected not stopped before the idle timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+		for i, sb := range sbs {
+			if !sb.stopIfIdle(time.Millisecond) {
+				t.Errorf("expected %s stopped after the idle timeout", sb.name)
+			}
+			if stops[i].Load() != 1 {
+				t.Errorf("expected %s stopped once, got %d", sb.name, stops[i].Load())
+			}
+		}
+		if sbs[0].stopIfIdle(time.Millisecond) {
+			t.Error("expected a stopped backend not stopped again")
+		}
+
+		// Started again on the next request.
+		code, r := post(t, "gpustack/a:1")
+		if code != http.StatusOK || r["backend"] != "gpustack/a:1" {
+			t.Errorf("expected routed to gpustack/a:1, got %d %v", code, r)
+		}
+		if launches[0].Load() != 2 {
+			t.Errorf("expected gpustack/a:1 launched again, got %d", launches[0].Load())
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func stop(app string) *cobra.Command {
+	var (
+		all bool
+	)
+	c := &cobra.Command{
+		Use:   "stop [INSTANCE...]",
+		Short: "Stop one or more model instances started by run --detach.",
+		Example: sprintf(`  # Stop a model instance by ID or ID prefix
+  %s stop 5f2e3c
+
+  # Stop all model instances
+  %[1]s stop --all`, app),
+		Args: func(c *cobra.Command, args []string) error {
+			if all {
+				return cobra.NoArgs(c, args)
+			}
+			return cobra.MinimumNArgs(1)(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			var ris []runInstance
+			if all {
+				var err error
+				ris, err = loadRunInstances()
+				if err != nil {
+					return err
+				}
+			} else {
+				ris = make([]runInstance, len(args))
+				for i := range args {
+					ri, err := getRunInstance(args[i])
+					if err != nil {
+						return err
+					}
+					ris[i] = ri
+				}
+			}
+
+			for _, ri := range ris {
+				if err := ri.Stop(c.Context()); err != nil {
+					return fmt.Errorf("stopping instance %s: %w", ri.ID, err)
+				}
+				if err := removeRunInstance(ri.ID); err != nil {
+					return err
+				}
+				fprintf(c.OutOrStdout(), "%s\n", ri.ID)
+			}
+			return nil
+		},
+	}
+	c.Flags().BoolVar(&all, "all", all, "Stop all model instances.")
+	return c
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/gpustack/gguf-packer-go/util/mapx"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+func tags(app string) *cobra.Command {
+	var (
+		insecure    bool
+		fullID      bool
+		concurrency = 8
+	)
+	c := &cobra.Command{
+		Use:   "tags REPO",
+		Short: "List the tags of a model repository in the registry.",
+		Example: sprintf(`  # List the tags of a model repository
+  %s tags gpustack/qwen2
+
+  # List the tags of a model repository as JSON
+  %[1]s tags gpustack/qwen2 --format json`, app),
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			repo := args[0]
+
+			var cos crane.Options
+			{
+				co := []crane.Option{
+					getAuthnKeychainOption(),
+					crane.WithContext(c.Context()),
+				}
+				if insecure {
+					co = append(co, crane.Insecure)
+				}
+				cos = crane.GetOptions(co...)
+			}
+
+			rp, err := name.NewRepository(repo, cos.Name...)
+			if err != nil {
+				return fmt.Errorf("parsing model repository %q: %w", repo, err)
+			}
+			ts, err := remote.List(rp, cos.Remote...)
+			if err != nil {
+				return fmt.Errorf("listing tags of %q: %w", rp.Name(), err)
+			}
+
+			// Retrieve the config of each tag in parallel,
+			// the failure is recorded into the item, e.g. non-model tags.
+			tis := make([]tagItem, len(ts))
+			eg := errgroup.Group{}
+			eg.SetLimit(max(concurrency, 1))
+			for i := range ts {
+				i := i
+				eg.Go(func() error {
+					tis[i] = retrieveTagItem(rp.Tag(ts[i]), cos.Remote...)
+					return nil
+				})
+			}
+			_ = eg.Wait()
+
+			return render(c, tis, func() (hds, bds [][]any, border bool) {
+				hds = [][]any{
+					{
+						"Tag",
+						"ID",
+						"Arch",
+						"Params",
+						"Bpw",
+						"Type",
+						"Usage",
+						"Created",
+						"Size",
+					},
+				}
+				bds = make([][]any, len(tis))
+				for i, ti := range tis {
+					if ti.Error != "" {
+						bds[i] = []any{ti.Tag, "", ti.Error, "", "", "", "", "", ""}
+						continue
+					}
+					bds[i] = []any{
+						ti.Tag,
+						tenary(fullID, ti.ID, ti.ID[:12]),
+						ti.Architecture,
+						sprintf(ti.Parameters),
+						sprintf(ti.BitsPerWeight),
+						ti.FileType,
+						ti.Usage,
+						humanizeTime(ti.Created),
+						sprintf(ti.Size),
+					}
+				}
+				return hds, bds, false
+			})
+		},
+	}
+	c.Flags().BoolVar(&insecure, "insecure", insecure, "Allow model repositories to be fetched without TLS.")
+	c.Flags().BoolVar(&fullID, "full-id", fullID, "Display full model ID.")
+	c.Flags().IntVar(&concurrency, "concurrency", concurrency, "Specify the number of tags to retrieve in parallel.")
+	return c
+}
+
+// tagItem holds the information of a remote model,
+// the Error is not empty if the tag is not a model.
+type tagItem struct {
+	listItem
+	Error string `json:"error,omitempty"`
+}
+
+func retrieveTagItem(rf name.Tag, opts ...remote.Option) (ti tagItem) {
+	ti.Name, ti.Tag = strings.TrimPrefix(rf.Context().Name(), dockerRegPrefix), rf.TagStr()
+
+	rd, err := remote.Get(rf, opts...)
+	if err != nil {
+		ti.Error = fmt.Sprintf("getting model remote: %v", err)
+		return ti
+	}
+	img, err := retrieveOCIImage(rd)
+	if err != nil {
+		ti.Error = err.Error()
+		return ti
+	}
+	cn, err := img.ConfigName()
+	if err != nil {
+		ti.Error = fmt.Sprintf("getting config name: %v", err)
+		return ti
+	}
+	cf, _, err := retrieveConfigByOCIImage(img)
+	if err != nil {
+		ti.Error = err.Error()
+		return ti
+	}
+	ti.ID = cn.Hex
+	ti.Architecture = cf.Config.Model.Architecture
+	ti.Parameters = cf.Config.Model.Parameters
+	ti.BitsPerWeight = cf.Config.Model.BitsPerWeight
+	ti.FileType = cf.Config.Model.FileType.String()
+	ti.Usage = mapx.Value(cf.Config.Labels, "gguf.model.usage", "unknown")
+	ti.Created = cf.Created
+	ti.Size = cf.Config.Size
+	return ti
+}
@@ -0,0 +1,340 @@
+// Package llamacpp models the arguments of llama.cpp server,
+// which is shared by the GGUFPackerfile frontend and the CLI.
+package llamacpp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	ggufparser "github.com/gpustack/gguf-parser-go"
+
+	"github.com/gpustack/gguf-packer-go/util/ptr"
+)
+
+// Args holds the typed llama.cpp server arguments,
+// nil or empty means the argument is not specified.
+type Args struct {
+	// Model is the value of -m/--model.
+	Model string
+	// ModelDraft is the value of -md/--model-draft.
+	ModelDraft string
+	// MMProj is the value of --mmproj.
+	MMProj string
+	// LoRAs are the values of --lora and --lora-scaled.
+	LoRAs []string
+
+	// ContextSize is the value of -c/--ctx-size.
+	ContextSize *int32
+	// BatchSize is the value of -b/--batch-size.
+	BatchSize *int32
+	// UBatchSize is the value of -ub/--ubatch-size.
+	UBatchSize *int32
+	// Parallel is the value of -np/--parallel.
+	Parallel *int32
+	// CacheTypeK is the value of -ctk/--cache-type-k.
+	CacheTypeK *ggufparser.GGMLType
+	// CacheTypeV is the value of -ctv/--cache-type-v.
+	CacheTypeV *ggufparser.GGMLType
+	// NoKVOffload is true if -nkvo/--no-kv-offload is specified.
+	NoKVOffload bool
+	// FlashAttention is true if -fa/--flash-attn is specified.
+	FlashAttention bool
+	// NoMMap is true if --no-mmap is specified.
+	NoMMap bool
+	// Embedding is true if --embedding/--embeddings is specified.
+	Embedding bool
+	// Reranking is true if --reranking/--rerank is specified.
+	Reranking bool
+
+	// GPULayers is the value of -ngl/--gpu-layers/--n-gpu-layers.
+	GPULayers *int
+	// GPULayersDraft is the value of -ngld/--gpu-layers-draft/--n-gpu-layers-draft.
+	GPULayersDraft *int
+	// SplitMode is the value of -sm/--split-mode.
+	SplitMode *ggufparser.LLaMACppSplitMode
+	// TensorSplit is the value of -ts/--tensor-split, in proportions.
+	TensorSplit []float64
+	// MainGPU is the value of -mg/--main-gpu.
+	MainGPU *int
+	// RPCServers is the value of --rpc.
+	RPCServers []string
+}
+
+// ParseArgs parses the given llama.cpp server arguments,
+// both of the short and long forms, and the --flag=value form are supported.
+//
+// The unrelated arguments are ignored,
+// an error is returned if a related argument has an invalid value.
+//
+// The arguments which do not affect the estimate are unrelated as well,
+// e.g. -dt/--defrag-thold only changes when the KV cache is defragmented, not its size.
+func ParseArgs(args []string) (a Args, err error) {
+	for i, s := 0, len(args); i < s; i++ {
+		f := args[i]
+		if !strings.HasPrefix(f, "-") {
+			continue
+		}
+		var (
+			v    string
+			hasV bool
+		)
+		if k, kv, ok := strings.Cut(f, "="); ok {
+			f, v, hasV = k, kv, true
+		}
+
+		str := func() (string, error) {
+			if hasV {
+				return v, nil
+			}
+			if i+1 >= s {
+				return "", fmt.Errorf("%s requires a value", f)
+			}
+			i++
+			return args[i], nil
+		}
+		integer := func(bitSize int) (int64, error) {
+			v, err := str()
+			if err != nil {
+				return 0, err
+			}
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 10, bitSize)
+			if err != nil {
+				return 0, fmt.Errorf("%s has invalid integer %q", f, v)
+			}
+			return n, nil
+		}
+		int32p := func() (*int32, error) {
+			n, err := integer(32)
+			if err != nil {
+				return nil, err
+			}
+			return ptr.To(int32(n)), nil
+		}
+		intp := func() (*int, error) {
+			n, err := integer(0)
+			if err != nil {
+				return nil, err
+			}
+			return ptr.To(int(n)), nil
+		}
+		ggmlType := func() (*ggufparser.GGMLType, error) {
+			v, err := str()
+			if err != nil {
+				return nil, err
+			}
+			t, err := ParseGGMLType(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f, err)
+			}
+			return &t, nil
+		}
+
+		switch f {
+		case "-m", "--model":
+			a.Model, err = str()
+		case "-md", "--model-draft":
+			a.ModelDraft, err = str()
+		case "--mmproj":
+			a.MMProj, err = str()
+		case "--lora":
+			var l string
+			if l, err = str(); err == nil {
+				a.LoRAs = append(a.LoRAs, l)
+			}
+		case "--lora-scaled":
+			var l string
+			if l, err = str(); err == nil {
+				a.LoRAs = append(a.LoRAs, l)
+				if i+1 >= s {
+					err = fmt.Errorf("%s requires two values", f)
+				}
+				i++
+			}
+		case "-c", "--ctx-size":
+			a.ContextSize, err = int32p()
+		case "-b", "--batch-size":
+			a.BatchSize, err = int32p()
+		case "-ub", "--ubatch-size":
+			a.UBatchSize, err = int32p()
+		case "-np", "--parallel":
+			a.Parallel, err = int32p()
+		case "-ctk", "--cache-type-k":
+			a.CacheTypeK, err = ggmlType()
+		case "-ctv", "--cache-type-v":
+			a.CacheTypeV, err = ggmlType()
+		case "-nkvo", "--no-kv-offload":
+			a.NoKVOffload = true
+		case "-fa", "--flash-attn":
+			a.FlashAttention = true
+		case "--no-mmap":
+			a.NoMMap = true
+		case "--embedding", "--embeddings":
+			a.Embedding = true
+		case "--reranking", "--rerank":
+			a.Reranking = true
+		case "-ngl", "--gpu-layers", "--n-gpu-layers":
+			a.GPULayers, err = intp()
+		case "-ngld", "--gpu-layers-draft", "--n-gpu-layers-draft":
+			a.GPULayersDraft, err = intp()
+		case "-sm", "--split-mode":
+			var v string
+			if v, err = str(); err == nil {
+				var m ggufparser.LLaMACppSplitMode
+				if m, err = ParseSplitMode(v); err != nil {
+					err = fmt.Errorf("%s: %w", f, err)
+				} else {
+					a.SplitMode = &m
+				}
+			}
+		case "-ts", "--tensor-split":
+			var v string
+			if v, err = str(); err == nil {
+				if a.TensorSplit, err = ParseTensorSplit(v); err != nil {
+					err = fmt.Errorf("%s: %w", f, err)
+				}
+			}
+		case "-mg", "--main-gpu":
+			a.MainGPU, err = intp()
+		case "--rpc":
+			var v string
+			if v, err = str(); err == nil {
+				if a.RPCServers, err = ParseRPCServers(v); err != nil {
+					err = fmt.Errorf("%s: %w", f, err)
+				}
+			}
+		}
+		if err != nil {
+			return a, err
+		}
+	}
+	return a, nil
+}
+
+// EstimateOptions returns the estimate options of the arguments,
+// the model files and offload layers are not included.
+func (a Args) EstimateOptions() (eopts []ggufparser.LLaMACppRunEstimateOption, err error) {
+	if a.ContextSize != nil {
+		eopts = append(eopts, ggufparser.WithContextSize(*a.ContextSize))
+	}
+	if bs := a.BatchSize; bs != nil {
+		// Embedding and reranking requires the logical batch to be fully processed at once,
+		// so llama.cpp reduces the logical batch size to the physical batch size.
+		if ubs := a.UBatchSize; (a.Embedding || a.Reranking) && ubs != nil && *bs > *ubs {
+			bs = ubs
+		}
+		eopts = append(eopts, ggufparser.WithLogicalBatchSize(*bs))
+	}
+	if a.UBatchSize != nil {
+		eopts = append(eopts, ggufparser.WithPhysicalBatchSize(*a.UBatchSize))
+	}
+	if a.Parallel != nil {
+		eopts = append(eopts, ggufparser.WithParallelSize(*a.Parallel))
+	}
+	if a.CacheTypeK != nil {
+		eopts = append(eopts, ggufparser.WithCacheKeyType(*a.CacheTypeK))
+	}
+	if a.CacheTypeV != nil {
+		eopts = append(eopts, ggufparser.WithCacheValueType(*a.CacheTypeV))
+	}
+	if a.NoKVOffload {
+		eopts = append(eopts, ggufparser.WithoutOffloadKVCache())
+	}
+	if a.FlashAttention {
+		eopts = append(eopts, ggufparser.WithFlashAttention())
+	}
+	if a.SplitMode != nil {
+		eopts = append(eopts, ggufparser.WithSplitMode(*a.SplitMode))
+	}
+	if len(a.TensorSplit) != 0 {
+		eopts = append(eopts, ggufparser.WithTensorSplitFraction(TensorSplitFraction(a.TensorSplit)))
+		if a.MainGPU != nil {
+			if *a.MainGPU < 0 || *a.MainGPU >= len(a.TensorSplit) {
+				return nil, errors.New("main GPU must be less than item size of tensor split")
+			}
+			eopts = append(eopts, ggufparser.WithMainGPUIndex(*a.MainGPU))
+		}
+		if len(a.RPCServers) != 0 {
+			if len(a.RPCServers) > len(a.TensorSplit) {
+				return nil, errors.New("RPC servers has more items than tensor split")
+			}
+			eopts = append(eopts, ggufparser.WithRPCServers(a.RPCServers))
+		}
+	}
+	return eopts, nil
+}
+
+// ParseGGMLType parses the given GGML type name case-insensitively, e.g. f16, q8_0, iq4_nl.
+func ParseGGMLType(s string) (ggufparser.GGMLType, error) {
+	s = strings.TrimSpace(s)
+	for t := ggufparser.GGMLTypeF32; ; t++ {
+		n := t.String()
+		if n == "Unknown" || strings.HasPrefix(n, "GGMLType(") {
+			break
+		}
+		if strings.EqualFold(n, s) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid GGML type %q", s)
+}
+
+// ParseSplitMode parses the given split mode, select from layer, row and none.
+func ParseSplitMode(s string) (ggufparser.LLaMACppSplitMode, error) {
+	switch strings.TrimSpace(s) {
+	case "layer":
+		return ggufparser.LLaMACppSplitModeLayer, nil
+	case "row":
+		return ggufparser.LLaMACppSplitModeRow, nil
+	case "none":
+		return ggufparser.LLaMACppSplitModeNone, nil
+	}
+	return 0, fmt.Errorf("invalid split mode %q", s)
+}
+
+// ParseTensorSplit parses the given comma-separated tensor split proportions, e.g. 3,1.
+func ParseTensorSplit(s string) ([]float64, error) {
+	ss := strings.Split(s, ",")
+	ts := make([]float64, len(ss))
+	var sum float64
+	for i := range ss {
+		v, err := strconv.ParseFloat(strings.TrimSpace(ss[i]), 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid tensor split proportion %q", ss[i])
+		}
+		ts[i] = v
+		sum += v
+	}
+	if sum == 0 {
+		return nil, errors.New("tensor split proportions sum to zero")
+	}
+	return ts, nil
+}
+
+// TensorSplitFraction converts the given tensor split proportions to the cumulative fractions.
+func TensorSplitFraction(ts []float64) []float64 {
+	var sum float64
+	fs := make([]float64, len(ts))
+	for i := range ts {
+		sum += ts[i]
+		fs[i] = sum
+	}
+	for i := range fs {
+		fs[i] /= sum
+	}
+	return fs
+}
+
+// ParseRPCServers parses the given comma-separated RPC servers in form of host:port.
+func ParseRPCServers(s string) ([]string, error) {
+	ss := strings.Split(s, ",")
+	for i := range ss {
+		ss[i] = strings.TrimSpace(ss[i])
+		if _, _, err := net.SplitHostPort(ss[i]); err != nil {
+			return nil, fmt.Errorf("invalid RPC server %q", ss[i])
+		}
+	}
+	return ss, nil
+}